@@ -0,0 +1,174 @@
+package canbus
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmsghdr is the struct mmsghdr of recvmmsg and sendmmsg.
+type mmsghdr struct {
+	Hdr unix.Msghdr
+	Len uint32
+}
+
+// Batch holds the buffers to receive or send many frames with a single
+// system call. The buffers are allocated once by NewBatch and reused by
+// every RecvBatch and SendBatch call, so no memory is allocated per frame.
+// A Batch must not be used by several goroutines at the same time.
+type Batch struct {
+	// Frames holds the received frames after RecvBatch. The Data of a
+	// frame refers to the batch buffers and is overwritten by the next
+	// call; copy it to keep it.
+	Frames []Frame
+	// Dropped is the number of frames the kernel dropped because the
+	// socket receive queue was full, as of the last received frame.
+	Dropped uint32
+
+	raw  []byte // frame buffers, fdFrameSize each
+	data []byte // payload buffers, MaxFDDataLen each
+	oob  []byte // control message buffers, oobSize each
+	addr []unix.RawSockaddrCAN
+	iovs []unix.Iovec
+	hdrs []mmsghdr
+}
+
+// NewBatch returns a Batch for up to n frames per system call. The
+// buffers are sized for CAN FD frames: a CAN XL frame with more than 60
+// bytes of payload makes RecvBatch fail, receive those with Recv.
+func NewBatch(n int) *Batch {
+	if n < 1 {
+		n = 1
+	}
+	b := &Batch{
+		Frames: make([]Frame, n),
+		raw:    make([]byte, n*int(fdFrameSize)),
+		data:   make([]byte, n*MaxFDDataLen),
+		oob:    make([]byte, n*oobSize),
+		addr:   make([]unix.RawSockaddrCAN, n),
+		iovs:   make([]unix.Iovec, n),
+		hdrs:   make([]mmsghdr, n),
+	}
+	for i := range b.hdrs {
+		b.iovs[i].Base = &b.raw[i*int(fdFrameSize)]
+		b.hdrs[i].Hdr.Iov = &b.iovs[i]
+		b.hdrs[i].Hdr.SetIovlen(1)
+	}
+	return b
+}
+
+// Len returns the maximum number of frames of the batch.
+func (b *Batch) Len() int {
+	return len(b.hdrs)
+}
+
+// RecvBatch receives up to b.Len() frames with one recvmmsg system call
+// and stores them in b.Frames. It blocks until at least one frame is
+// available and returns the number of received frames.
+// CAN XL frames with more than 60 bytes of payload, which are only
+// received with SetXLFrames, are not supported and make RecvBatch fail.
+func (sck *Socket) RecvBatch(b *Batch) (int, error) {
+	for i := range b.hdrs {
+		b.iovs[i].SetLen(int(fdFrameSize))
+		b.hdrs[i].Hdr.Control = &b.oob[i*oobSize]
+		b.hdrs[i].Hdr.SetControllen(oobSize)
+		b.hdrs[i].Hdr.Name = (*byte)(unsafe.Pointer(&b.addr[i]))
+		b.hdrs[i].Hdr.Namelen = unix.SizeofSockaddrCAN
+		b.hdrs[i].Hdr.Flags = 0
+		b.hdrs[i].Len = 0
+	}
+
+	n, err := sck.dev.mmsg(unix.SYS_RECVMMSG, b.hdrs, sck.dev.rc.Read)
+	if err != nil {
+		return 0, err
+	}
+
+	var now time.Time
+	for i := 0; i < n; i++ {
+		hdr := &b.hdrs[i]
+		raw := b.raw[i*int(fdFrameSize) : i*int(fdFrameSize)+int(hdr.Len)]
+		buf := b.data[i*MaxFDDataLen : (i+1)*MaxFDDataLen]
+		msg := &b.Frames[i]
+		if err := decodeFrameInto(msg, raw, buf[:0]); err != nil {
+			return i, err
+		}
+		ts, drops, ok := parseControl(b.oob[i*oobSize : i*oobSize+int(hdr.Hdr.Controllen)])
+		if ok {
+			b.Dropped = drops
+			sck.drops.Store(drops)
+		}
+		msg.Local = hdr.Hdr.Flags&unix.MSG_DONTROUTE != 0
+		msg.Ifindex = 0
+		msg.Iface = ""
+		if hdr.Hdr.Namelen >= unix.SizeofSockaddrCAN && b.addr[i].Family == unix.AF_CAN {
+			msg.Ifindex = int(b.addr[i].Ifindex)
+			msg.Iface = sck.names.name(msg.Ifindex)
+		}
+		msg.Timestamp = ts
+		if msg.Timestamp.IsZero() {
+			if now.IsZero() {
+				now = time.Now()
+			}
+			msg.Timestamp = now
+		}
+	}
+	return n, nil
+}
+
+// SendBatch sends the frames with as few sendmmsg system calls as
+// possible, using b as buffer. Frames beyond b.Len() are sent in further
+// system calls. It returns the number of sent frames.
+// CAN FD frames require SetFDFrames to be enabled on the socket.
+func (sck *Socket) SendBatch(b *Batch, frames []Frame) (int, error) {
+	sent := 0
+	for sent < len(frames) {
+		chunk := min(len(frames)-sent, len(b.hdrs))
+		for i := 0; i < chunk; i++ {
+			msg := frames[sent+i]
+			if msg.IsFD() && !sck.fd {
+				return sent, errFDNotEnabled
+			}
+			size, err := encodeFrame(b.raw[i*int(fdFrameSize):(i+1)*int(fdFrameSize)], msg)
+			if err != nil {
+				return sent, err
+			}
+			b.iovs[i].SetLen(size)
+			b.hdrs[i].Hdr.Name = nil
+			b.hdrs[i].Hdr.Namelen = 0
+			if msg.Ifindex > 0 {
+				b.addr[i] = unix.RawSockaddrCAN{Family: unix.AF_CAN, Ifindex: int32(msg.Ifindex)}
+				b.hdrs[i].Hdr.Name = (*byte)(unsafe.Pointer(&b.addr[i]))
+				b.hdrs[i].Hdr.Namelen = unix.SizeofSockaddrCAN
+			}
+			b.hdrs[i].Hdr.Control = nil
+			b.hdrs[i].Hdr.SetControllen(0)
+			b.hdrs[i].Len = 0
+		}
+		n, err := sck.dev.mmsg(unix.SYS_SENDMMSG, b.hdrs[:chunk], sck.dev.rc.Write)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// mmsg runs the recvmmsg or sendmmsg system call trap on the headers,
+// waiting on the netpoller with wait while the socket would block.
+func (d device) mmsg(trap uintptr, hdrs []mmsghdr, wait func(func(uintptr) bool) error) (int, error) {
+	var n int
+	var err error
+	werr := wait(func(fd uintptr) bool {
+		r, _, e := unix.Syscall6(trap, fd, uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+		n, err = int(r), nil
+		if e != 0 {
+			n, err = 0, e
+		}
+		return err != unix.EAGAIN
+	})
+	if werr != nil {
+		return 0, d.pollErr(werr)
+	}
+	return n, err
+}
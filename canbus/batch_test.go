@@ -0,0 +1,100 @@
+package canbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	tx, rx := newSocketPair(t)
+
+	frames := make([]Frame, 10)
+	for i := range frames {
+		frames[i] = Frame{ID: uint32(0x100 + i), Data: bytes.Repeat([]byte{byte(i)}, i%9), Kind: SFF}
+	}
+	frames[9] = Frame{ID: 0x1ABCDEF, Data: make([]byte, 48), Kind: EFF, Flags: BRS}
+
+	// the batch is smaller than the frames to cover several system calls
+	b := NewBatch(4)
+	n, err := tx.SendBatch(b, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(frames) {
+		t.Fatalf("sent %d frames, want %d", n, len(frames))
+	}
+
+	var got []Frame
+	for len(got) < len(frames) {
+		n, err := rx.RecvBatch(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range b.Frames[:n] {
+			msg.Data = bytes.Clone(msg.Data)
+			got = append(got, msg)
+		}
+	}
+	for i, want := range frames {
+		if got[i].ID != want.ID || got[i].Kind != want.Kind || !bytes.Equal(got[i].Data, want.Data) {
+			t.Errorf("frame %d: got %+v, want %+v", i, got[i], want)
+		}
+		if got[i].Timestamp.IsZero() {
+			t.Errorf("frame %d: missing timestamp", i)
+		}
+	}
+}
+
+const benchBatch = 32
+
+func benchFrame() Frame {
+	return Frame{ID: 0x123, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Kind: SFF}
+}
+
+// BenchmarkSendRecv sends and receives one frame per system call.
+func BenchmarkSendRecv(b *testing.B) {
+	tx, rx := newSocketPair(b)
+	msg := benchFrame()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += benchBatch {
+		n := min(benchBatch, b.N-i)
+		for j := 0; j < n; j++ {
+			if _, err := tx.Send(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for j := 0; j < n; j++ {
+			if _, err := rx.Recv(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkSendRecvBatch sends and receives up to benchBatch frames per
+// system call.
+func BenchmarkSendRecvBatch(b *testing.B) {
+	tx, rx := newSocketPair(b)
+	frames := make([]Frame, benchBatch)
+	for i := range frames {
+		frames[i] = benchFrame()
+	}
+	txb := NewBatch(benchBatch)
+	rxb := NewBatch(benchBatch)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += benchBatch {
+		n := min(benchBatch, b.N-i)
+		if _, err := tx.SendBatch(txb, frames[:n]); err != nil {
+			b.Fatal(err)
+		}
+		for n > 0 {
+			m, err := rx.RecvBatch(rxb)
+			if err != nil {
+				b.Fatal(err)
+			}
+			n -= m
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package canbus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// BCMOp is the opcode of a broadcast manager message.
+type BCMOp uint32
+
+const (
+	BCMTxSetup   BCMOp = iota + 1 // create (cyclic) transmission task
+	BCMTxDelete                   // remove (cyclic) transmission task
+	BCMTxRead                     // read properties of (cyclic) transmission task
+	BCMTxSend                     // send one CAN frame
+	BCMRxSetup                    // create RX content filter subscription
+	BCMRxDelete                   // remove RX content filter subscription
+	BCMRxRead                     // read properties of RX content filter subscription
+	BCMTxStatus                   // reply to TX_READ request
+	BCMTxExpired                  // notification on performed transmissions (count=0)
+	BCMRxStatus                   // reply to RX_READ request
+	BCMRxTimeout                  // cyclic message is absent
+	BCMRxChanged                  // updated CAN frame (detected content change)
+)
+
+// flags of the bcm_msg_head.
+const (
+	bcmSetTimer         = 0x0001
+	bcmStartTimer       = 0x0002
+	bcmRxFilterID       = 0x0020
+	bcmRxAnnounceResume = 0x0100
+	bcmTxResetMultiIdx  = 0x0200
+	bcmCanFDFrame       = 0x0800
+)
+
+// maxBCMFrames is the maximum number of frames of one BCM message.
+const maxBCMFrames = 256
+
+var (
+	errBCMNoFrames   = errors.New("canbus: no frames for BCM")
+	errBCMTooMany    = errors.New("canbus: too many frames for BCM")
+	errBCMMixedFrame = errors.New("canbus: mixed CAN and CAN FD frames for BCM")
+	errBCMXLFrame    = errors.New("canbus: CAN XL frames not supported by BCM")
+)
+
+type bcmTimeval struct {
+	Sec  int // long
+	Usec int // long
+}
+
+// bcmMsgHead is the struct bcm_msg_head without the frames.
+type bcmMsgHead struct {
+	Opcode  uint32
+	Flags   uint32
+	Count   uint32
+	Ival1   bcmTimeval
+	Ival2   bcmTimeval
+	CanID   uint32
+	Nframes uint32
+}
+
+// bcmHeadSize is the offset of the frames, which are 8 byte aligned.
+const bcmHeadSize = (unsafe.Sizeof(bcmMsgHead{}) + 7) &^ 7
+
+// BCMEvent is a message received from the broadcast manager.
+type BCMEvent struct {
+	Op     BCMOp
+	ID     uint32
+	Kind   Kind
+	Frames []Frame
+}
+
+// BCM is a CAN broadcast manager socket. The kernel sends cyclic frames
+// with accurate timing and filters received frames by content, even
+// while the user space process is busy.
+type BCM struct {
+	iface *net.Interface
+	dev   device
+}
+
+// NewBCM returns a new CAN broadcast manager socket.
+func NewBCM() (*BCM, error) {
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_DGRAM, unix.CAN_BCM)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := newDevice(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &BCM{dev: dev}, nil
+}
+
+// Connect connects the socket to the CAN interface with the given name.
+func (bcm *BCM) Connect(addr string) error {
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return err
+	}
+	bcm.iface = iface
+
+	return unix.Connect(bcm.dev.fd, &unix.SockaddrCAN{Ifindex: iface.Index})
+}
+
+// Name returns the device name the socket is connected to.
+func (bcm *BCM) Name() string {
+	if bcm.iface == nil {
+		return "N/A"
+	}
+	return bcm.iface.Name
+}
+
+// Close closes the socket. The kernel removes all jobs of the socket.
+func (bcm *BCM) Close() error {
+	return bcm.dev.Close()
+}
+
+// SetupTx creates or updates a cyclic transmission job for the ID and
+// kind of the first frame. The frames are sent in turn. The first count
+// frames are sent with interval ival1, then the frames are sent with
+// interval ival2 until the job is deleted. A running job with the same ID
+// is restarted with the new timers.
+func (bcm *BCM) SetupTx(frames []Frame, count uint32, ival1, ival2 time.Duration) error {
+	if len(frames) == 0 {
+		return errBCMNoFrames
+	}
+	head := bcmMsgHead{
+		Opcode: uint32(BCMTxSetup),
+		Flags:  bcmSetTimer | bcmStartTimer | bcmTxResetMultiIdx,
+		Count:  count,
+		Ival1:  toBCMTimeval(ival1),
+		Ival2:  toBCMTimeval(ival2),
+		CanID:  rawCanID(frames[0].ID, frames[0].Kind),
+	}
+	return bcm.write(head, frames)
+}
+
+// UpdateTx changes the content of a running transmission job without
+// changing its timers.
+func (bcm *BCM) UpdateTx(frames []Frame) error {
+	if len(frames) == 0 {
+		return errBCMNoFrames
+	}
+	head := bcmMsgHead{
+		Opcode: uint32(BCMTxSetup),
+		CanID:  rawCanID(frames[0].ID, frames[0].Kind),
+	}
+	return bcm.write(head, frames)
+}
+
+// DeleteTx removes the transmission job for the ID and kind.
+func (bcm *BCM) DeleteTx(id uint32, kind Kind) error {
+	head := bcmMsgHead{
+		Opcode: uint32(BCMTxDelete),
+		CanID:  rawCanID(id, kind),
+	}
+	return bcm.write(head, nil)
+}
+
+// SendOnce sends a single frame through the broadcast manager.
+func (bcm *BCM) SendOnce(msg Frame) error {
+	head := bcmMsgHead{
+		Opcode: uint32(BCMTxSend),
+		CanID:  rawCanID(msg.ID, msg.Kind),
+	}
+	return bcm.write(head, []Frame{msg})
+}
+
+// SetupRx subscribes to the frames with the ID and kind. With a nil mask
+// every received frame is reported as BCMRxChanged; otherwise only frames
+// whose data changed in the bits set in mask. With a timeout greater than
+// zero a BCMRxTimeout is reported when no frame is received in time.
+// Throttle limits the rate of BCMRxChanged events, zero disables it.
+func (bcm *BCM) SetupRx(id uint32, kind Kind, mask []byte, timeout, throttle time.Duration) error {
+	head := bcmMsgHead{
+		Opcode: uint32(BCMRxSetup),
+		Flags:  bcmRxAnnounceResume,
+		Ival1:  toBCMTimeval(timeout),
+		Ival2:  toBCMTimeval(throttle),
+		CanID:  rawCanID(id, kind),
+	}
+	if timeout > 0 || throttle > 0 {
+		head.Flags |= bcmSetTimer | bcmStartTimer
+	}
+	if mask == nil {
+		head.Flags |= bcmRxFilterID
+		return bcm.write(head, nil)
+	}
+	return bcm.write(head, []Frame{{ID: id, Kind: kind, Data: mask}})
+}
+
+// DeleteRx removes the subscription for the ID and kind.
+func (bcm *BCM) DeleteRx(id uint32, kind Kind) error {
+	head := bcmMsgHead{
+		Opcode: uint32(BCMRxDelete),
+		CanID:  rawCanID(id, kind),
+	}
+	return bcm.write(head, nil)
+}
+
+// Recv receives the next message of the broadcast manager, such as
+// BCMRxChanged, BCMRxTimeout or BCMTxExpired.
+func (bcm *BCM) Recv() (BCMEvent, error) {
+	buf := make([]byte, int(bcmHeadSize)+maxBCMFrames*int(fdFrameSize))
+	n, err := bcm.dev.Read(buf)
+	if err != nil {
+		return BCMEvent{}, err
+	}
+	if n < int(bcmHeadSize) {
+		return BCMEvent{}, fmt.Errorf("canbus: short BCM message of %d bytes", n)
+	}
+
+	head := *(*bcmMsgHead)(unsafe.Pointer(&buf[0]))
+	ev := BCMEvent{Op: BCMOp(head.Opcode)}
+	ev.ID, ev.Kind = splitCanID(head.CanID)
+
+	size := int(frameSize)
+	if head.Flags&bcmCanFDFrame != 0 {
+		size = int(fdFrameSize)
+	}
+	data := buf[bcmHeadSize:n]
+	for i := 0; i < int(head.Nframes) && len(data) >= size; i++ {
+		msg, err := decodeFrame(data[:size])
+		if err != nil {
+			return ev, err
+		}
+		msg.Timestamp = time.Now()
+		ev.Frames = append(ev.Frames, msg)
+		data = data[size:]
+	}
+	return ev, nil
+}
+
+// write sends the message head with the frames to the broadcast manager.
+func (bcm *BCM) write(head bcmMsgHead, frames []Frame) error {
+	if len(frames) > maxBCMFrames {
+		return errBCMTooMany
+	}
+	size := int(frameSize)
+	if len(frames) > 0 && frames[0].IsFD() {
+		size = int(fdFrameSize)
+		head.Flags |= bcmCanFDFrame
+	}
+	head.Nframes = uint32(len(frames))
+
+	buf := make([]byte, int(bcmHeadSize)+len(frames)*size)
+	*(*bcmMsgHead)(unsafe.Pointer(&buf[0])) = head
+	for i, msg := range frames {
+		if msg.IsXL() {
+			return errBCMXLFrame
+		}
+		if msg.IsFD() != (size == int(fdFrameSize)) {
+			return errBCMMixedFrame
+		}
+		off := int(bcmHeadSize) + i*size
+		n, err := encodeFrame(buf[off:off+size], msg)
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return errBCMMixedFrame
+		}
+	}
+
+	_, err := bcm.dev.Write(buf)
+	if err != nil {
+		return fmt.Errorf("could not write BCM message: %w", err)
+	}
+	return nil
+}
+
+func toBCMTimeval(d time.Duration) bcmTimeval {
+	return bcmTimeval{
+		Sec:  int(d / time.Second),
+		Usec: int((d % time.Second) / time.Microsecond),
+	}
+}
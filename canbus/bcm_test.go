@@ -0,0 +1,135 @@
+package canbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// newBCMPair returns a BCM writing to a datagram socket instead of the
+// kernel, and the file descriptor of the other end.
+func newBCMPair(t *testing.T) (*BCM, int) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := newDevice(fds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcm := &BCM{dev: dev}
+	t.Cleanup(func() {
+		bcm.Close()
+		unix.Close(fds[1])
+	})
+	return bcm, fds[1]
+}
+
+func TestBCMHeadLayout(t *testing.T) {
+	// offsets of struct bcm_msg_head with a long sized timeval
+	want := map[uintptr][6]uintptr{
+		8: {4, 8, 16, 32, 48, 52},
+		4: {4, 8, 12, 20, 28, 32},
+	}[unsafe.Sizeof(int(0))]
+	var head bcmMsgHead
+	got := [6]uintptr{
+		unsafe.Offsetof(head.Flags), unsafe.Offsetof(head.Count),
+		unsafe.Offsetof(head.Ival1), unsafe.Offsetof(head.Ival2),
+		unsafe.Offsetof(head.CanID), unsafe.Offsetof(head.Nframes),
+	}
+	if got != want {
+		t.Errorf("offsets = %v, want %v", got, want)
+	}
+	size := map[uintptr]uintptr{8: 56, 4: 40}[unsafe.Sizeof(int(0))]
+	if bcmHeadSize != size {
+		t.Errorf("head size = %d, want %d", bcmHeadSize, size)
+	}
+}
+
+func TestBCMWrite(t *testing.T) {
+	bcm, peer := newBCMPair(t)
+	classic := Frame{ID: 0x123, Kind: SFF, Data: []byte{1, 2, 3}}
+	fd := Frame{ID: 0x123, Kind: SFF, Flags: FDF, Data: bytes.Repeat([]byte{0xAA}, 12)}
+
+	for _, tc := range []struct {
+		name   string
+		frames []Frame
+		flag   bool
+		stride int
+	}{
+		{"classic", []Frame{classic, classic}, false, int(frameSize)},
+		{"fd", []Frame{fd, fd, fd}, true, int(fdFrameSize)},
+	} {
+		if err := bcm.SetupTx(tc.frames, 0, 0, 100*time.Millisecond); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		buf := make([]byte, 4096)
+		n, err := unix.Read(peer, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = buf[:n]
+		if want := int(bcmHeadSize) + len(tc.frames)*tc.stride; n != want {
+			t.Fatalf("%s: wrote %d bytes, want %d", tc.name, n, want)
+		}
+		head := *(*bcmMsgHead)(unsafe.Pointer(&buf[0]))
+		if BCMOp(head.Opcode) != BCMTxSetup || head.CanID != 0x123 || head.Nframes != uint32(len(tc.frames)) {
+			t.Errorf("%s: head %+v", tc.name, head)
+		}
+		if head.Ival2 != (bcmTimeval{Usec: 100000}) {
+			t.Errorf("%s: ival2 %+v", tc.name, head.Ival2)
+		}
+		if flag := head.Flags&bcmCanFDFrame != 0; flag != tc.flag {
+			t.Errorf("%s: CAN_FD_FRAME = %v, want %v", tc.name, flag, tc.flag)
+		}
+		for i, want := range tc.frames {
+			off := int(bcmHeadSize) + i*tc.stride
+			got, err := decodeFrame(buf[off : off+tc.stride])
+			if err != nil || got.ID != want.ID || !bytes.Equal(got.Data, want.Data) {
+				t.Errorf("%s: frame %d = %+v, %v", tc.name, i, got, err)
+			}
+		}
+	}
+
+	for _, frames := range [][]Frame{{classic, fd}, {fd, classic}} {
+		if err := bcm.SetupTx(frames, 0, 0, time.Second); !errors.Is(err, errBCMMixedFrame) {
+			t.Errorf("mixed frames: %v, want %v", err, errBCMMixedFrame)
+		}
+	}
+}
+
+func TestBCMRecv(t *testing.T) {
+	bcm, peer := newBCMPair(t)
+
+	head := bcmMsgHead{
+		Opcode:  uint32(BCMRxChanged),
+		CanID:   0x1F334455 | unix.CAN_EFF_FLAG,
+		Nframes: 1,
+	}
+	buf := make([]byte, int(bcmHeadSize)+int(frameSize))
+	*(*bcmMsgHead)(unsafe.Pointer(&buf[0])) = head
+	frame := buf[bcmHeadSize:]
+	binary.NativeEndian.PutUint32(frame, head.CanID)
+	frame[4] = 2
+	copy(frame[8:], []byte{0xBE, 0xEF})
+	if _, err := unix.Write(peer, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := bcm.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Op != BCMRxChanged || ev.ID != 0x1F334455 || ev.Kind != EFF || len(ev.Frames) != 1 {
+		t.Fatalf("event %+v", ev)
+	}
+	if msg := ev.Frames[0]; msg.ID != 0x1F334455 || msg.Kind != EFF || !bytes.Equal(msg.Data, []byte{0xBE, 0xEF}) {
+		t.Errorf("frame %+v", msg)
+	}
+}
@@ -0,0 +1,31 @@
+package canbus
+
+import "context"
+
+// Bus is an endpoint on a CAN bus, independent of the transport.
+// Socket implements Bus for SocketCAN, VirtualEndpoint for an in-process
+// bus without kernel support, SLCAN for a serial line CAN adapter and
+// SocketCAND for an interface of a remote host running socketcand.
+type Bus interface {
+	// Name returns the name of the bus.
+	Name() string
+	// Send sends the frame on the bus.
+	Send(msg Frame) (int, error)
+	// Recv receives the next frame from the bus.
+	Recv() (Frame, error)
+	// RecvContext receives the next frame until ctx is done.
+	RecvContext(ctx context.Context) (Frame, error)
+	// SetFilterSet passes only the frames matched by the filter set.
+	SetFilterSet(fs FilterSet) error
+	// ResetFilters passes all frames again.
+	ResetFilters() error
+	// Close closes the endpoint and unblocks pending receives.
+	Close() error
+}
+
+var (
+	_ Bus = (*Socket)(nil)
+	_ Bus = (*VirtualEndpoint)(nil)
+	_ Bus = (*SLCAN)(nil)
+	_ Bus = (*SocketCAND)(nil)
+)
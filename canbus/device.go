@@ -0,0 +1,142 @@
+package canbus
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// device is a nonblocking socket registered with the runtime netpoller,
+// so that reads and writes can be interrupted by deadlines and Close.
+type device struct {
+	fd   int
+	file *os.File
+	rc   syscall.RawConn
+	dl   *deadline
+	cl   *atomic.Bool
+}
+
+// deadline is the read deadline set by the user. A cancelled context
+// overrides it temporarily.
+type deadline struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newDevice(fd int) (device, error) {
+	err := unix.SetNonblock(fd, true)
+	if err != nil {
+		return device{}, err
+	}
+	file := os.NewFile(uintptr(fd), "canbus")
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return device{}, err
+	}
+
+	return device{fd: fd, file: file, rc: rc, dl: &deadline{}, cl: &atomic.Bool{}}, nil
+}
+
+// pollErr maps the error of the netpoller to the errors of os.File.
+func (d device) pollErr(err error) error {
+	if d.cl.Load() {
+		return os.ErrClosed
+	}
+	return err
+}
+
+func (d device) Read(data []byte) (n int, err error) {
+	rerr := d.rc.Read(func(fd uintptr) bool {
+		n, err = unix.Read(int(fd), data)
+		return err != unix.EAGAIN
+	})
+	if rerr != nil {
+		return 0, d.pollErr(rerr)
+	}
+	return n, err
+}
+
+func (d device) Write(data []byte) (n int, err error) {
+	werr := d.rc.Write(func(fd uintptr) bool {
+		n, err = unix.Write(int(fd), data)
+		return err != unix.EAGAIN
+	})
+	if werr != nil {
+		return 0, d.pollErr(werr)
+	}
+	return n, err
+}
+
+func (d device) Recvmsg(data, oob []byte) (n, oobn, flags int, from unix.Sockaddr, err error) {
+	rerr := d.rc.Read(func(fd uintptr) bool {
+		n, oobn, flags, from, err = unix.Recvmsg(int(fd), data, oob, 0)
+		return err != unix.EAGAIN
+	})
+	if rerr != nil {
+		return 0, 0, 0, nil, d.pollErr(rerr)
+	}
+	return n, oobn, flags, from, err
+}
+
+func (d device) Sendto(data []byte, to unix.Sockaddr) (err error) {
+	werr := d.rc.Write(func(fd uintptr) bool {
+		err = unix.Sendto(int(fd), data, 0, to)
+		return err != unix.EAGAIN
+	})
+	if werr != nil {
+		return d.pollErr(werr)
+	}
+	return err
+}
+
+func (d device) Close() error {
+	d.cl.Store(true)
+	return d.file.Close()
+}
+
+func (d device) SetReadDeadline(t time.Time) error {
+	d.dl.mu.Lock()
+	defer d.dl.mu.Unlock()
+	d.dl.t = t
+	return d.file.SetReadDeadline(t)
+}
+
+func (d device) SetWriteDeadline(t time.Time) error {
+	return d.file.SetWriteDeadline(t)
+}
+
+// withContext runs the blocking read fn and interrupts it when ctx is
+// done. The user read deadline is restored afterwards.
+func (d device) withContext(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(done)
+		d.dl.mu.Lock()
+		defer d.dl.mu.Unlock()
+		d.file.SetReadDeadline(time.Unix(1, 0))
+	})
+
+	err := fn()
+	if !stop() {
+		<-done
+		d.dl.mu.Lock()
+		d.file.SetReadDeadline(d.dl.t)
+		d.dl.mu.Unlock()
+		if err != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
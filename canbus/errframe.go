@@ -0,0 +1,289 @@
+package canbus
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrorClass is the set of CAN_ERR_* class bits of an error frame ID.
+type ErrorClass uint32
+
+const (
+	ErrTxTimeout  ErrorClass = unix.CAN_ERR_TX_TIMEOUT // TX timeout (by netdevice driver)
+	ErrLostArb    ErrorClass = unix.CAN_ERR_LOSTARB    // lost arbitration
+	ErrController ErrorClass = unix.CAN_ERR_CRTL       // controller problems
+	ErrProtocol   ErrorClass = unix.CAN_ERR_PROT       // protocol violations
+	ErrTrx        ErrorClass = unix.CAN_ERR_TRX        // transceiver status
+	ErrAck        ErrorClass = unix.CAN_ERR_ACK        // received no ACK on transmission
+	ErrBusOff     ErrorClass = unix.CAN_ERR_BUSOFF     // bus off
+	ErrBusError   ErrorClass = unix.CAN_ERR_BUSERROR   // bus error
+	ErrRestarted  ErrorClass = unix.CAN_ERR_RESTARTED  // controller restarted
+	ErrCounter    ErrorClass = unix.CAN_ERR_CNT        // TX error counter / RX error counter
+
+	// ErrAll subscribes to all error classes.
+	ErrAll ErrorClass = unix.CAN_ERR_MASK
+)
+
+var errorClassNames = []struct {
+	class ErrorClass
+	name  string
+	key   string
+}{
+	{ErrTxTimeout, "TX timeout", "txtimeout"},
+	{ErrLostArb, "lost arbitration", "lostarb"},
+	{ErrController, "controller problem", "ctrl"},
+	{ErrProtocol, "protocol violation", "prot"},
+	{ErrTrx, "transceiver status", "trx"},
+	{ErrAck, "no ACK", "ack"},
+	{ErrBusOff, "bus-off", "busoff"},
+	{ErrBusError, "bus error", "buserror"},
+	{ErrRestarted, "restarted", "restarted"},
+	{ErrCounter, "error counter", "cnt"},
+}
+
+// ErrorClasses returns all single error classes in bit order.
+func ErrorClasses() []ErrorClass {
+	classes := make([]ErrorClass, len(errorClassNames))
+	for i, n := range errorClassNames {
+		classes[i] = n.class
+	}
+	return classes
+}
+
+// ParseErrorClass parses a comma separated list of error class keys
+// such as "busoff,ctrl,restarted". The keys are txtimeout, lostarb,
+// ctrl, prot, trx, ack, busoff, buserror, restarted and cnt; "all"
+// selects every class and "none" or the empty string no class.
+func ParseErrorClass(s string) (ErrorClass, error) {
+	var mask ErrorClass
+	for _, key := range strings.Split(s, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch key {
+		case "", "none":
+			continue
+		case "all":
+			mask |= ErrAll
+			continue
+		}
+		found := false
+		for _, n := range errorClassNames {
+			if n.key == key {
+				mask |= n.class
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("canbus: unknown error class %q", key)
+		}
+	}
+	return mask, nil
+}
+
+// String returns the names of the set class bits.
+func (c ErrorClass) String() string {
+	var names []string
+	for _, n := range errorClassNames {
+		if c&n.class != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// ErrorInfo is the decoded content of a CAN error frame.
+type ErrorInfo struct {
+	Class        ErrorClass
+	LostArbBit   uint8 // bit number in the bitstream, 0 if unspecified
+	Controller   uint8 // CAN_ERR_CRTL_* flags
+	ProtType     uint8 // CAN_ERR_PROT_* flags
+	ProtLocation uint8 // CAN_ERR_PROT_LOC_* value
+	Transceiver  uint8 // CAN_ERR_TRX_* flags
+	TxErrCounter uint8 // TEC, only valid with ErrCounter
+	RxErrCounter uint8 // REC, only valid with ErrCounter
+}
+
+// DecodeError decodes the class bits in the ID and the data bytes of an
+// error frame into an ErrorInfo. Missing data bytes are treated as zero.
+func DecodeError(msg Frame) ErrorInfo {
+	var data [MaxDataLen]byte
+	copy(data[:], msg.Data)
+
+	info := ErrorInfo{Class: ErrorClass(msg.ID & unix.CAN_ERR_MASK)}
+	if info.Class&ErrLostArb != 0 {
+		info.LostArbBit = data[0]
+	}
+	if info.Class&ErrController != 0 {
+		info.Controller = data[1]
+	}
+	if info.Class&ErrProtocol != 0 {
+		info.ProtType = data[2]
+		info.ProtLocation = data[3]
+	}
+	if info.Class&ErrTrx != 0 {
+		info.Transceiver = data[4]
+	}
+	if info.Class&ErrCounter != 0 {
+		info.TxErrCounter = data[6]
+		info.RxErrCounter = data[7]
+	}
+	return info
+}
+
+var controllerNames = []struct {
+	flag uint8
+	name string
+}{
+	{unix.CAN_ERR_CRTL_RX_OVERFLOW, "RX buffer overflow"},
+	{unix.CAN_ERR_CRTL_TX_OVERFLOW, "TX buffer overflow"},
+	{unix.CAN_ERR_CRTL_RX_WARNING, "RX error warning"},
+	{unix.CAN_ERR_CRTL_TX_WARNING, "TX error warning"},
+	{unix.CAN_ERR_CRTL_RX_PASSIVE, "RX error passive"},
+	{unix.CAN_ERR_CRTL_TX_PASSIVE, "TX error passive"},
+	{unix.CAN_ERR_CRTL_ACTIVE, "back to error active"},
+}
+
+var protTypeNames = []struct {
+	flag uint8
+	name string
+}{
+	{unix.CAN_ERR_PROT_BIT, "single bit error"},
+	{unix.CAN_ERR_PROT_FORM, "frame format error"},
+	{unix.CAN_ERR_PROT_STUFF, "bit stuffing error"},
+	{unix.CAN_ERR_PROT_BIT0, "unable to send dominant bit"},
+	{unix.CAN_ERR_PROT_BIT1, "unable to send recessive bit"},
+	{unix.CAN_ERR_PROT_OVERLOAD, "bus overload"},
+	{unix.CAN_ERR_PROT_ACTIVE, "active error announcement"},
+	{unix.CAN_ERR_PROT_TX, "error on transmission"},
+}
+
+var protLocationNames = map[uint8]string{
+	unix.CAN_ERR_PROT_LOC_SOF:     "start of frame",
+	unix.CAN_ERR_PROT_LOC_ID28_21: "ID bits 28 - 21",
+	unix.CAN_ERR_PROT_LOC_ID20_18: "ID bits 20 - 18",
+	unix.CAN_ERR_PROT_LOC_SRTR:    "substitute RTR",
+	unix.CAN_ERR_PROT_LOC_IDE:     "identifier extension",
+	unix.CAN_ERR_PROT_LOC_ID17_13: "ID bits 17 - 13",
+	unix.CAN_ERR_PROT_LOC_ID12_05: "ID bits 12 - 5",
+	unix.CAN_ERR_PROT_LOC_ID04_00: "ID bits 4 - 0",
+	unix.CAN_ERR_PROT_LOC_RTR:     "RTR",
+	unix.CAN_ERR_PROT_LOC_RES1:    "reserved bit 1",
+	unix.CAN_ERR_PROT_LOC_RES0:    "reserved bit 0",
+	unix.CAN_ERR_PROT_LOC_DLC:     "data length code",
+	unix.CAN_ERR_PROT_LOC_DATA:    "data section",
+	unix.CAN_ERR_PROT_LOC_CRC_SEQ: "CRC sequence",
+	unix.CAN_ERR_PROT_LOC_CRC_DEL: "CRC delimiter",
+	unix.CAN_ERR_PROT_LOC_ACK:     "ACK slot",
+	unix.CAN_ERR_PROT_LOC_ACK_DEL: "ACK delimiter",
+	unix.CAN_ERR_PROT_LOC_EOF:     "end of frame",
+	unix.CAN_ERR_PROT_LOC_INTERM:  "intermission",
+}
+
+// CANH status in the low nibble of the transceiver byte
+var canhNames = map[uint8]string{
+	unix.CAN_ERR_TRX_CANH_NO_WIRE:      "CANH no wire",
+	unix.CAN_ERR_TRX_CANH_SHORT_TO_BAT: "CANH short to BAT",
+	unix.CAN_ERR_TRX_CANH_SHORT_TO_VCC: "CANH short to VCC",
+	unix.CAN_ERR_TRX_CANH_SHORT_TO_GND: "CANH short to GND",
+}
+
+// CANL status in the high nibble of the transceiver byte
+var canlNames = map[uint8]string{
+	unix.CAN_ERR_TRX_CANL_NO_WIRE:       "CANL no wire",
+	unix.CAN_ERR_TRX_CANL_SHORT_TO_BAT:  "CANL short to BAT",
+	unix.CAN_ERR_TRX_CANL_SHORT_TO_VCC:  "CANL short to VCC",
+	unix.CAN_ERR_TRX_CANL_SHORT_TO_GND:  "CANL short to GND",
+	unix.CAN_ERR_TRX_CANL_SHORT_TO_CANH: "CANL short to CANH",
+}
+
+// Messages returns one readable message per reported error condition.
+func (info ErrorInfo) Messages() []string {
+	var msgs []string
+	if info.Class&ErrTxTimeout != 0 {
+		msgs = append(msgs, "TX timeout")
+	}
+	if info.Class&ErrLostArb != 0 {
+		if info.LostArbBit == unix.CAN_ERR_LOSTARB_UNSPEC {
+			msgs = append(msgs, "lost arbitration")
+		} else {
+			msgs = append(msgs, fmt.Sprintf("lost arbitration at bit %d", info.LostArbBit))
+		}
+	}
+	if info.Class&ErrController != 0 {
+		found := false
+		for _, n := range controllerNames {
+			if info.Controller&n.flag != 0 {
+				msgs = append(msgs, "controller: "+n.name)
+				found = true
+			}
+		}
+		if !found {
+			msgs = append(msgs, "controller: unspecified problem")
+		}
+	}
+	if info.Class&ErrProtocol != 0 {
+		var types []string
+		for _, n := range protTypeNames {
+			if info.ProtType&n.flag != 0 {
+				types = append(types, n.name)
+			}
+		}
+		if len(types) == 0 {
+			types = append(types, "unspecified")
+		}
+		msg := "protocol violation: " + strings.Join(types, ", ")
+		if loc, ok := protLocationNames[info.ProtLocation]; ok {
+			msg += " at " + loc
+		}
+		msgs = append(msgs, msg)
+	}
+	if info.Class&ErrTrx != 0 {
+		canh, canl := info.Transceiver&0x0F, info.Transceiver&0xF0
+		if canh == unix.CAN_ERR_TRX_UNSPEC && canl == unix.CAN_ERR_TRX_UNSPEC {
+			msgs = append(msgs, "transceiver: unspecified")
+		}
+		if name, ok := canhNames[canh]; ok {
+			msgs = append(msgs, "transceiver: "+name)
+		} else if canh != 0 {
+			msgs = append(msgs, fmt.Sprintf("transceiver: CANH status 0x%X", canh))
+		}
+		if name, ok := canlNames[canl]; ok {
+			msgs = append(msgs, "transceiver: "+name)
+		} else if canl != 0 {
+			msgs = append(msgs, fmt.Sprintf("transceiver: CANL status 0x%X", canl>>4))
+		}
+	}
+	if info.Class&ErrAck != 0 {
+		msgs = append(msgs, "no ACK on transmission")
+	}
+	if info.Class&ErrBusOff != 0 {
+		msgs = append(msgs, "bus-off")
+	}
+	if info.Class&ErrBusError != 0 {
+		msgs = append(msgs, "bus error")
+	}
+	if info.Class&ErrRestarted != 0 {
+		msgs = append(msgs, "controller restarted")
+	}
+	return msgs
+}
+
+// String returns a readable description of the error frame.
+func (info ErrorInfo) String() string {
+	out := strings.Join(info.Messages(), "; ")
+	if info.Class&ErrCounter != 0 {
+		if out != "" {
+			out += "; "
+		}
+		out += fmt.Sprintf("TEC %d REC %d", info.TxErrCounter, info.RxErrCounter)
+	}
+	if out == "" {
+		return "unknown error"
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package canbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeError(t *testing.T) {
+	for _, tc := range []struct {
+		text string // error frame as recorded by candump
+		want ErrorInfo
+		msgs []string
+	}{
+		{"20000004#0004000000000000", ErrorInfo{Class: ErrController, Controller: 0x04},
+			[]string{"controller: RX error warning"}},
+		{"20000204#0030000000008800", ErrorInfo{Class: ErrController | ErrCounter, Controller: 0x30, TxErrCounter: 0x88},
+			[]string{"controller: RX error passive", "controller: TX error passive"}},
+		{"20000088#0000801900000000", ErrorInfo{Class: ErrProtocol | ErrBusError, ProtType: 0x80, ProtLocation: 0x19},
+			[]string{"protocol violation: error on transmission at ACK slot", "bus error"}},
+		{"200000A8#0000000000000000", ErrorInfo{Class: ErrProtocol | ErrAck | ErrBusError},
+			[]string{"protocol violation: unspecified", "no ACK on transmission", "bus error"}},
+		{"20000010#0000000004000000", ErrorInfo{Class: ErrTrx, Transceiver: 0x04},
+			[]string{"transceiver: CANH no wire"}},
+		{"20000010#0000000003000000", ErrorInfo{Class: ErrTrx, Transceiver: 0x03},
+			[]string{"transceiver: CANH status 0x3"}},
+		{"20000010#0000000044000000", ErrorInfo{Class: ErrTrx, Transceiver: 0x44},
+			[]string{"transceiver: CANH no wire", "transceiver: CANL no wire"}},
+		{"20000010#0000000057000000", ErrorInfo{Class: ErrTrx, Transceiver: 0x57},
+			[]string{"transceiver: CANH short to GND", "transceiver: CANL short to BAT"}},
+		{"20000010#0000000080000000", ErrorInfo{Class: ErrTrx, Transceiver: 0x80},
+			[]string{"transceiver: CANL short to CANH"}},
+		{"20000010#0000000000000000", ErrorInfo{Class: ErrTrx},
+			[]string{"transceiver: unspecified"}},
+		{"20000002#0D00000000000000", ErrorInfo{Class: ErrLostArb, LostArbBit: 13},
+			[]string{"lost arbitration at bit 13"}},
+		{"20000040#", ErrorInfo{Class: ErrBusOff}, []string{"bus-off"}},
+		{"20000100#0040000000000000", ErrorInfo{Class: ErrRestarted}, []string{"controller restarted"}},
+		{"20000200#0000000000000C05", ErrorInfo{Class: ErrCounter, TxErrCounter: 12, RxErrCounter: 5}, nil},
+	} {
+		msg, err := ParseFrame(tc.text)
+		if err != nil {
+			t.Errorf("parse %q: %v", tc.text, err)
+			continue
+		}
+		got := DecodeError(msg)
+		if got != tc.want {
+			t.Errorf("decode %q = %+v, want %+v", tc.text, got, tc.want)
+		}
+		if msgs := got.Messages(); !reflect.DeepEqual(msgs, tc.msgs) {
+			t.Errorf("messages %q = %q, want %q", tc.text, msgs, tc.msgs)
+		}
+	}
+
+	if s := DecodeError(Frame{ID: 0x200, Kind: ERR, Data: []byte{0, 0, 0, 0, 0, 0, 0x0C, 0x05}}).String(); s != "TEC 12 REC 5" {
+		t.Errorf("string %q", s)
+	}
+}
+
+func TestParseErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want ErrorClass
+	}{
+		{"", 0},
+		{"none", 0},
+		{"busoff", ErrBusOff},
+		{"txtimeout", ErrTxTimeout},
+		{"busoff,ctrl,restarted", ErrBusOff | ErrController | ErrRestarted},
+		{" Prot , ACK,buserror ", ErrProtocol | ErrAck | ErrBusError},
+		{"lostarb,trx,cnt,none", ErrLostArb | ErrTrx | ErrCounter},
+		{"all", ErrAll},
+		{"busoff,all", ErrAll},
+	} {
+		got, err := ParseErrorClass(tc.text)
+		if err != nil || got != tc.want {
+			t.Errorf("parse %q = %#x, %v, want %#x", tc.text, got, err, tc.want)
+		}
+	}
+
+	for _, text := range []string{"bogus", "busoff,bogus", "bus-off", "busoff;ctrl"} {
+		if got, err := ParseErrorClass(text); err == nil {
+			t.Errorf("parse %q = %#x, want error", text, got)
+		}
+	}
+}
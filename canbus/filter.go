@@ -0,0 +1,332 @@
+package canbus
+
+import (
+	"fmt"
+	"math/bits"
+
+	"golang.org/x/sys/unix"
+)
+
+// Format selects the frame formats matched by a Filter.
+type Format uint8
+
+const (
+	AnyFormat Format = iota // standard and extended frames
+	SFFOnly                 // standard frames only
+	EFFOnly                 // extended frames only
+)
+
+// RTRMatch selects data or remote frames matched by a Filter.
+type RTRMatch uint8
+
+const (
+	AnyRTR   RTRMatch = iota // data and remote frames
+	DataOnly                 // data frames only
+	RTROnly                  // remote transmission requests only
+)
+
+// Filter is one entry of the kernel CAN_RAW_FILTER list. A frame matches
+// if the bits of its ID selected by Mask equal those of ID, and it has the
+// selected format and RTR flag. An inverted filter matches all other
+// frames.
+type Filter struct {
+	ID     uint32
+	Mask   uint32
+	Format Format
+	RTR    RTRMatch
+	Invert bool
+}
+
+// ExactID returns a filter that matches the frames with the ID.
+func ExactID(id uint32, format Format) Filter {
+	return Filter{ID: id, Mask: idMask(format), Format: format}
+}
+
+// MaskID returns a filter that matches the frames whose ID bits selected
+// by mask equal those of id.
+func MaskID(id, mask uint32, format Format) Filter {
+	return Filter{ID: id & mask, Mask: mask & idMask(format), Format: format}
+}
+
+// RangeID returns the smallest set of ID/mask filters that match exactly
+// the IDs from start to end inclusive.
+func RangeID(start, end uint32, format Format) []Filter {
+	max := idMask(format)
+	end = min(end, max)
+	var filters []Filter
+	for start <= end {
+		// largest aligned block at start that does not pass end
+		size := uint32(1) << bits.TrailingZeros32(start|(max+1))
+		for size > 1 && start+size-1 > end {
+			size >>= 1
+		}
+		filters = append(filters, MaskID(start, max&^(size-1), format))
+		if start+size-1 == end {
+			break
+		}
+		start += size
+	}
+	return filters
+}
+
+// Inverted returns the filter with inverted match.
+func (f Filter) Inverted() Filter {
+	f.Invert = !f.Invert
+	return f
+}
+
+// WithRTR returns the filter that matches only data or remote frames.
+func (f Filter) WithRTR(rtr RTRMatch) Filter {
+	f.RTR = rtr
+	return f
+}
+
+// CanFilter returns the kernel representation of the filter.
+func (f Filter) CanFilter() unix.CanFilter {
+	id := f.ID & f.Mask
+	mask := f.Mask & idMask(f.Format)
+	switch f.Format {
+	case SFFOnly:
+		mask |= unix.CAN_EFF_FLAG
+	case EFFOnly:
+		id |= unix.CAN_EFF_FLAG
+		mask |= unix.CAN_EFF_FLAG
+	}
+	switch f.RTR {
+	case DataOnly:
+		mask |= unix.CAN_RTR_FLAG
+	case RTROnly:
+		id |= unix.CAN_RTR_FLAG
+		mask |= unix.CAN_RTR_FLAG
+	}
+	if f.Invert {
+		id |= unix.CAN_INV_FILTER
+	}
+	return unix.CanFilter{Id: id, Mask: mask}
+}
+
+// Match reports whether the kernel passes the frame with the filter.
+func (f Filter) Match(msg Frame) bool {
+	cf := f.CanFilter()
+	canID := rawCanID(msg.ID, msg.Kind)
+	match := canID&cf.Mask == cf.Id&^unix.CAN_INV_FILTER&cf.Mask
+	return match != f.Invert
+}
+
+// String returns the filter in the candump notation id:mask or id~mask.
+func (f Filter) String() string {
+	cf := f.CanFilter()
+	sep := ":"
+	if f.Invert {
+		sep = "~"
+	}
+	return fmt.Sprintf("%X%s%X", cf.Id&^unix.CAN_INV_FILTER, sep, cf.Mask)
+}
+
+// FilterSet is the list of kernel filters of a socket. Without Join a
+// frame passes if any filter matches, with Join (CAN_RAW_JOIN_FILTERS)
+// if all filters match. An empty set passes no frames.
+type FilterSet struct {
+	Filters []Filter
+	Join    bool
+}
+
+// CanFilters returns the kernel representation of the filters.
+func (fs FilterSet) CanFilters() []unix.CanFilter {
+	filters := make([]unix.CanFilter, len(fs.Filters))
+	for i, f := range fs.Filters {
+		filters[i] = f.CanFilter()
+	}
+	return filters
+}
+
+// Match reports whether the kernel passes the frame with the filter set.
+// Error frames are selected by the error filter and always pass.
+func (fs FilterSet) Match(msg Frame) bool {
+	if msg.Kind == ERR {
+		return true
+	}
+	if len(fs.Filters) == 0 {
+		return false
+	}
+	for _, f := range fs.Filters {
+		m := f.Match(msg)
+		if fs.Join && !m {
+			return false
+		}
+		if !fs.Join && m {
+			return true
+		}
+	}
+	return fs.Join
+}
+
+// IDRange is an inclusive range of CAN IDs.
+type IDRange struct {
+	Start uint32
+	End   uint32
+}
+
+// Accepted returns the ranges of IDs of the kind within span that the
+// filter set passes, so that a filter set can be checked before it is
+// installed. The number of ranges is bounded by the span, so a preview
+// over all extended IDs can be long for masks with low bits set. Error
+// frames are selected by the error filter and return no ranges.
+func (fs FilterSet) Accepted(kind Kind, span IDRange) []IDRange {
+	if kind == ERR || len(fs.Filters) == 0 {
+		return nil
+	}
+	max := uint32(unix.CAN_SFF_MASK)
+	if kind == EFF || kind == RTR_EFF {
+		max = unix.CAN_EFF_MASK
+	}
+	span.End = min(span.End, max)
+	if span.Start > span.End {
+		return nil
+	}
+
+	var acc []IDRange
+	for i, f := range fs.Filters {
+		ranges := f.accepted(rawCanID(0, kind), span)
+		switch {
+		case i == 0:
+			acc = ranges
+		case fs.Join:
+			acc = intersectRanges(acc, ranges)
+		default:
+			acc = unionRanges(acc, ranges)
+		}
+	}
+	return acc
+}
+
+// accepted returns the ranges of IDs within span that the filter passes
+// for the format and RTR bits of flags.
+func (f Filter) accepted(flags uint32, span IDRange) []IDRange {
+	cf := f.CanFilter()
+	mask := cf.Mask & unix.CAN_EFF_MASK
+	value := cf.Id & mask
+	var ranges []IDRange
+	if (flags^cf.Id)&cf.Mask&^unix.CAN_EFF_MASK == 0 {
+		// the IDs with the masked bits set form blocks of the size of
+		// the lowest mask bit
+		block := mask & -mask
+		for id, ok := nextMaskedID(span.Start, mask, value, span.End); ok; {
+			end := span.End
+			if block != 0 && id|(block-1) < end {
+				end = id | (block - 1)
+			}
+			ranges = append(ranges, IDRange{id, end})
+			if end == span.End {
+				break
+			}
+			id, ok = nextMaskedID(end+1, mask, value, span.End)
+		}
+	}
+	if f.Invert {
+		return complementRanges(ranges, span)
+	}
+	return ranges
+}
+
+// nextMaskedID returns the smallest ID from id to max whose bits selected
+// by mask equal value.
+func nextMaskedID(id, mask, value, max uint32) (uint32, bool) {
+	for id <= max {
+		diff := (id ^ value) & mask
+		if diff == 0 {
+			return id, true
+		}
+		// all bits up to the highest differing bit
+		low := uint32(1)<<(bits.Len32(diff)) - 1
+		if value&diff > id&diff {
+			// the ID is below the next match in this prefix
+			return id&^low | value&low, id&^low|value&low <= max
+		}
+		// skip to the next prefix
+		if id|low == ^uint32(0) {
+			break
+		}
+		id = id | low + 1
+	}
+	return 0, false
+}
+
+// unionRanges merges two sorted lists of disjoint ranges.
+func unionRanges(a, b []IDRange) []IDRange {
+	var out []IDRange
+	for len(a) > 0 || len(b) > 0 {
+		var r IDRange
+		if len(b) == 0 || len(a) > 0 && a[0].Start <= b[0].Start {
+			r, a = a[0], a[1:]
+		} else {
+			r, b = b[0], b[1:]
+		}
+		if n := len(out); n > 0 && r.Start <= out[n-1].End+1 {
+			out[n-1].End = max(out[n-1].End, r.End)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// intersectRanges returns the ranges contained in both sorted lists.
+func intersectRanges(a, b []IDRange) []IDRange {
+	var out []IDRange
+	for len(a) > 0 && len(b) > 0 {
+		start, end := max(a[0].Start, b[0].Start), min(a[0].End, b[0].End)
+		if start <= end {
+			out = append(out, IDRange{start, end})
+		}
+		if a[0].End < b[0].End {
+			a = a[1:]
+		} else {
+			b = b[1:]
+		}
+	}
+	return out
+}
+
+// complementRanges returns the ranges of span not in the sorted list.
+func complementRanges(ranges []IDRange, span IDRange) []IDRange {
+	var out []IDRange
+	start := span.Start
+	for _, r := range ranges {
+		if r.Start > start {
+			out = append(out, IDRange{start, r.Start - 1})
+		}
+		if r.End == span.End {
+			return out
+		}
+		start = r.End + 1
+	}
+	return append(out, IDRange{start, span.End})
+}
+
+// SetFilterSet installs the filter set on the socket with the
+// CAN_RAW_FILTER and CAN_RAW_JOIN_FILTERS options.
+func (sck *Socket) SetFilterSet(fs FilterSet) error {
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_CAN_RAW, unix.CAN_RAW_JOIN_FILTERS, boolInt(fs.Join))
+	if err != nil {
+		return fmt.Errorf("could not set CAN filter join: %w", err)
+	}
+	return sck.SetFilters(fs.CanFilters())
+}
+
+// ResetFilters removes all filters from the socket, so that all frames
+// pass again.
+func (sck *Socket) ResetFilters() error {
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_CAN_RAW, unix.CAN_RAW_JOIN_FILTERS, 0)
+	if err != nil {
+		return fmt.Errorf("could not set CAN filter join: %w", err)
+	}
+	return sck.SetFilters([]unix.CanFilter{{Id: 0, Mask: 0}})
+}
+
+func idMask(format Format) uint32 {
+	if format == SFFOnly {
+		return unix.CAN_SFF_MASK
+	}
+	return unix.CAN_EFF_MASK
+}
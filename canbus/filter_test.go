@@ -0,0 +1,96 @@
+package canbus
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRangeID(t *testing.T) {
+	for _, tc := range []struct{ start, end uint32 }{
+		{0x000, 0x7FF},
+		{0x100, 0x1FF},
+		{0x123, 0x456},
+		{0x7FF, 0x7FF},
+		{0x001, 0x002},
+	} {
+		fs := FilterSet{Filters: RangeID(tc.start, tc.end, SFFOnly)}
+		for id := uint32(0); id <= unix.CAN_SFF_MASK; id++ {
+			want := id >= tc.start && id <= tc.end
+			if got := fs.Match(Frame{ID: id, Kind: SFF}); got != want {
+				t.Fatalf("range %X-%X: Match(%X) = %v, want %v", tc.start, tc.end, id, got, want)
+			}
+		}
+		if got := fs.Match(Frame{ID: tc.start, Kind: EFF}); got {
+			t.Errorf("range %X-%X: EFF frame matched SFF filter", tc.start, tc.end)
+		}
+	}
+	if n := len(RangeID(0x100, 0x1FF, SFFOnly)); n != 1 {
+		t.Errorf("aligned range compiled into %d filters, want 1", n)
+	}
+}
+
+func TestFilterCanFilter(t *testing.T) {
+	for _, tc := range []struct {
+		f    Filter
+		want unix.CanFilter
+	}{
+		{ExactID(0x123, SFFOnly), unix.CanFilter{Id: 0x123, Mask: 0x7FF | unix.CAN_EFF_FLAG}},
+		{ExactID(0x1234567, EFFOnly), unix.CanFilter{Id: 0x1234567 | unix.CAN_EFF_FLAG, Mask: 0x1FFFFFFF | unix.CAN_EFF_FLAG}},
+		{ExactID(0x123, SFFOnly).Inverted(), unix.CanFilter{Id: 0x123 | unix.CAN_INV_FILTER, Mask: 0x7FF | unix.CAN_EFF_FLAG}},
+		{ExactID(0x123, SFFOnly).WithRTR(DataOnly), unix.CanFilter{Id: 0x123, Mask: 0x7FF | unix.CAN_EFF_FLAG | unix.CAN_RTR_FLAG}},
+	} {
+		if got := tc.f.CanFilter(); got != tc.want {
+			t.Errorf("%+v: CanFilter = %X, want %X", tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestFilterSetAccepted(t *testing.T) {
+	all := IDRange{0, unix.CAN_EFF_MASK}
+	for _, tc := range []struct {
+		name string
+		fs   FilterSet
+		kind Kind
+		span IDRange
+		want []IDRange
+	}{
+		{"exact and mask", FilterSet{Filters: []Filter{ExactID(0x123, AnyFormat), MaskID(0x200, 0x700, SFFOnly)}},
+			SFF, all, []IDRange{{0x123, 0x123}, {0x200, 0x2FF}}},
+		{"other format", FilterSet{Filters: []Filter{MaskID(0x200, 0x700, SFFOnly)}},
+			EFF, IDRange{0, 0xFFF}, nil},
+		{"inverted", FilterSet{Filters: []Filter{ExactID(0x123, SFFOnly).Inverted()}},
+			SFF, all, []IDRange{{0, 0x122}, {0x124, 0x7FF}}},
+		{"inverted other format", FilterSet{Filters: []Filter{ExactID(0x123, SFFOnly).Inverted()}},
+			EFF, IDRange{0x100, 0x1FFF}, []IDRange{{0x100, 0x1FFF}}},
+		{"joined", FilterSet{Filters: []Filter{MaskID(0x100, 0x100, SFFOnly), MaskID(0x010, 0x030, SFFOnly)}, Join: true},
+			SFF, IDRange{0, 0x2FF}, []IDRange{{0x110, 0x11F}, {0x150, 0x15F}, {0x190, 0x19F}, {0x1D0, 0x1DF}}},
+		{"joined inverted", FilterSet{Filters: append(RangeID(0x300, 0x3FF, SFFOnly), ExactID(0x345, SFFOnly).Inverted()), Join: true},
+			SFF, all, []IDRange{{0x300, 0x344}, {0x346, 0x3FF}}},
+		{"rtr only", FilterSet{Filters: []Filter{MaskID(0, 0, SFFOnly).WithRTR(RTROnly)}},
+			SFF, all, nil},
+		{"extended span", FilterSet{Filters: []Filter{MaskID(0x18FEF100, 0x1FFFFF00, EFFOnly)}},
+			EFF, IDRange{0x18FEF000, 0x18FEF1FF}, []IDRange{{0x18FEF100, 0x18FEF1FF}}},
+		{"empty", FilterSet{}, SFF, all, nil},
+	} {
+		got := tc.fs.Accepted(tc.kind, tc.span)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Accepted = %X, want %X", tc.name, got, tc.want)
+			continue
+		}
+		if tc.kind != SFF {
+			continue
+		}
+		for id := uint32(0); id <= unix.CAN_SFF_MASK; id++ {
+			in := false
+			for _, r := range got {
+				in = in || id >= r.Start && id <= r.End
+			}
+			want := id >= tc.span.Start && id <= tc.span.End && tc.fs.Match(Frame{ID: id, Kind: SFF})
+			if in != want {
+				t.Fatalf("%s: Accepted contains %X = %v, Match = %v", tc.name, id, in, want)
+			}
+		}
+	}
+}
@@ -6,13 +6,24 @@ package canbus
 
 //go:generate stringer -output=frame_string.go -type Kind
 
-import "unsafe"
+import (
+	"time"
+	"unsafe"
+)
 
 // Frame is exchanged over a CAN bus.
 type Frame struct {
-	ID   uint32
-	Data []byte
-	Kind Kind
+	ID        uint32
+	Data      []byte
+	Kind      Kind
+	Flags     Flags     // CAN FD or CAN XL flags, zero for classic CAN frames
+	SDT       uint8     // CAN XL SDU type
+	VCID      uint8     // CAN XL virtual CAN network ID
+	AF        uint32    // CAN XL acceptance field
+	Timestamp time.Time // kernel receive time, zero for frames to send
+	Ifindex   int       // interface index, received on or to send on
+	Iface     string    // interface name of received frames
+	Local     bool      // received frame sent by another socket of this host, such as the broadcast manager
 }
 
 type Kind uint8
@@ -25,6 +36,73 @@ const (
 	ERR                 // Error message frame
 )
 
+// Flags holds the CAN FD specific flags of a frame.
+type Flags uint8
+
+const (
+	BRS Flags = 0x01 // Bit rate switch (second bitrate for payload data)
+	ESI Flags = 0x02 // Error state indicator of the transmitting node
+	FDF Flags = 0x04 // Mark CAN FD for dual use of struct canfd_frame
+)
+
+// Flags of CAN XL frames. The lower bits share their values with the
+// CAN FD flags and are only valid together with XLF.
+const (
+	SEC Flags = 0x01 // Simple extended content (security/segmentation)
+	RRS Flags = 0x02 // Remote request substitution
+	XLF Flags = 0x80 // Mark CAN XL for dual use of struct canfd_frame
+)
+
+const (
+	// MaxDataLen is the maximum payload length of a classic CAN frame.
+	MaxDataLen = 8
+	// MaxFDDataLen is the maximum payload length of a CAN FD frame.
+	MaxFDDataLen = 64
+	// MaxXLDataLen is the maximum payload length of a CAN XL frame.
+	MaxXLDataLen = 2048
+)
+
+// IsFD reports whether the frame is a CAN FD frame.
+func (f Frame) IsFD() bool {
+	return !f.IsXL() && (f.Flags&FDF != 0 || len(f.Data) > MaxDataLen)
+}
+
+// IsXL reports whether the frame is a CAN XL frame. The ID of a CAN XL
+// frame is the 11 bit priority.
+func (f Frame) IsXL() bool {
+	return f.Flags&XLF != 0
+}
+
+// DLC returns the data length code of the frame.
+func (f Frame) DLC() uint8 {
+	return LenToDLC(len(f.Data))
+}
+
+// dlcToLen maps a CAN FD data length code to the payload length.
+var dlcToLen = [16]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+// DLCToLen returns the payload length for the data length code dlc.
+// Codes greater than 15 are truncated to the lower 4 bits.
+func DLCToLen(dlc uint8) int {
+	return int(dlcToLen[dlc&0x0F])
+}
+
+// LenToDLC returns the smallest data length code that can hold n bytes
+// of payload. Lengths greater than 64 map to 15.
+func LenToDLC(n int) uint8 {
+	for dlc, l := range dlcToLen {
+		if n <= int(l) {
+			return uint8(dlc)
+		}
+	}
+	return 15
+}
+
+// FDLen rounds n up to the next valid CAN FD payload length.
+func FDLen(n int) int {
+	return DLCToLen(LenToDLC(n))
+}
+
 const frameSize = unsafe.Sizeof(
 	// this is a can_frame.
 	struct {
@@ -34,3 +112,29 @@ const frameSize = unsafe.Sizeof(
 		Data [8]byte
 	}{},
 )
+
+const fdFrameSize = unsafe.Sizeof(
+	// this is a canfd_frame.
+	struct {
+		ID    uint32
+		Len   byte
+		Flags byte
+		_     [2]byte
+		Data  [64]byte
+	}{},
+)
+
+// xlHeaderSize is the size of the canxl_frame header before the data.
+const xlHeaderSize = 12
+
+// this is a canxl_frame:
+//
+//	struct {
+//		Prio  uint32 // priority and VCID
+//		Flags byte
+//		SDT   byte
+//		Len   uint16
+//		AF    uint32
+//		Data  [2048]byte
+//	}
+const xlFrameSize = xlHeaderSize + MaxXLDataLen
@@ -0,0 +1,37 @@
+package canbus
+
+import (
+	"net"
+	"strconv"
+	"sync"
+)
+
+// AnyInterface is the name of a socket bound to all CAN interfaces.
+const AnyInterface = "any"
+
+// ifaceNames caches the interface names of the interface indexes, so that
+// the name of a received frame is looked up once per interface.
+type ifaceNames struct {
+	mu    sync.Mutex
+	names map[int]string
+}
+
+func (c *ifaceNames) name(index int) string {
+	if index <= 0 {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[index]; ok {
+		return name
+	}
+	name := strconv.Itoa(index)
+	if iface, err := net.InterfaceByIndex(index); err == nil {
+		name = iface.Name
+	}
+	if c.names == nil {
+		c.names = make(map[int]string)
+	}
+	c.names[index] = name
+	return name
+}
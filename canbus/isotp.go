@@ -0,0 +1,458 @@
+package canbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// MaxISOTPLen is the maximum payload length of an ISO-TP PDU with a
+// 12 bit length field.
+const MaxISOTPLen = 4095
+
+// socket options of the kernel CAN_ISOTP protocol.
+const (
+	solCanISOTP    = unix.SOL_CAN_BASE + unix.CAN_ISOTP
+	isotpOpts      = 1 // CAN_ISOTP_OPTS
+	isotpRecvFC    = 2 // CAN_ISOTP_RECV_FC
+	isotpTxPadding = 0x004
+	isotpRxPadding = 0x008
+)
+
+// ISO-TP protocol control information.
+const (
+	isotpSF = 0x0 // single frame
+	isotpFF = 0x1 // first frame
+	isotpCF = 0x2 // consecutive frame
+	isotpFC = 0x3 // flow control frame
+
+	isotpCTS      = 0x0 // flow status continue to send
+	isotpWait     = 0x1 // flow status wait
+	isotpOverflow = 0x2 // flow status overflow
+)
+
+var (
+	errISOTPTooBig   = errors.New("canbus: ISO-TP payload too big")
+	errISOTPTimeout  = errors.New("canbus: ISO-TP flow control timeout")
+	errISOTPOverflow = errors.New("canbus: ISO-TP receiver buffer overflow")
+	errISOTPClosed   = errors.New("canbus: ISO-TP connection closed")
+)
+
+// ISOTPOptions configures an ISO-TP (ISO 15765-2) connection.
+type ISOTPOptions struct {
+	TxID      uint32        // ID of sent frames
+	RxID      uint32        // ID of received frames
+	Extended  bool          // 29 bit IDs
+	Padding   bool          // pad frames to 8 bytes
+	PadByte   byte          // content of the padding bytes
+	BlockSize uint8         // frames until the next flow control, 0 for all
+	STmin     time.Duration // minimum separation time requested from the sender
+	Timeout   time.Duration // flow control and consecutive frame timeout, default 1s
+}
+
+func (opts ISOTPOptions) kind() Kind {
+	if opts.Extended {
+		return EFF
+	}
+	return SFF
+}
+
+func (opts ISOTPOptions) timeout() time.Duration {
+	if opts.Timeout <= 0 {
+		return time.Second
+	}
+	return opts.Timeout
+}
+
+// ISOTP is an ISO-TP connection that exchanges PDUs of up to MaxISOTPLen
+// bytes. The kernel CAN_ISOTP protocol is used if available, otherwise
+// the protocol is implemented in user space on a raw CAN socket.
+type ISOTP struct {
+	opts   ISOTPOptions
+	dev    *device // kernel socket
+	conn   Bus
+	fc     chan Frame
+	pdus   chan []byte
+	done   chan struct{} // closed when the read loop ends
+	closed chan struct{} // closed by Close
+	err    error
+	sendMu sync.Mutex
+	once   sync.Once
+}
+
+// DialISOTP opens an ISO-TP connection on the named CAN interface.
+func DialISOTP(ifname string, opts ISOTPOptions) (*ISOTP, error) {
+	tp, err := dialKernelISOTP(ifname, opts)
+	if err == nil {
+		return tp, nil
+	}
+
+	// user space fallback
+	sck, err := New()
+	if err != nil {
+		return nil, err
+	}
+	err = sck.Bind(ifname)
+	if err != nil {
+		sck.Close()
+		return nil, err
+	}
+	filter := unix.CanFilter{Id: rawCanID(opts.RxID, opts.kind()), Mask: unix.CAN_EFF_FLAG | unix.CAN_RTR_FLAG | unix.CAN_SFF_MASK}
+	if opts.Extended {
+		filter.Mask = unix.CAN_EFF_FLAG | unix.CAN_RTR_FLAG | unix.CAN_EFF_MASK
+	}
+	err = sck.SetFilters([]unix.CanFilter{filter})
+	if err != nil {
+		sck.Close()
+		return nil, err
+	}
+	return NewISOTP(sck, opts), nil
+}
+
+func dialKernelISOTP(ifname string, opts ISOTPOptions) (*ISOTP, error) {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_DGRAM, unix.CAN_ISOTP)
+	if err != nil {
+		return nil, err
+	}
+
+	// struct can_isotp_options
+	var o struct {
+		Flags       uint32
+		FrameTxtime uint32
+		ExtAddress  uint8
+		TxpadCont   uint8
+		RxpadCont   uint8
+		RxExtAddr   uint8
+	}
+	if opts.Padding {
+		o.Flags |= isotpTxPadding | isotpRxPadding
+		o.TxpadCont = opts.PadByte
+		o.RxpadCont = opts.PadByte
+	}
+	// struct can_isotp_fc_options
+	fc := struct {
+		BS     uint8
+		STmin  uint8
+		WFTmax uint8
+	}{opts.BlockSize, encodeSTmin(opts.STmin), 0}
+
+	err = setsockopt(fd, solCanISOTP, isotpOpts, unsafe.Pointer(&o), unsafe.Sizeof(o))
+	if err == nil {
+		err = setsockopt(fd, solCanISOTP, isotpRecvFC, unsafe.Pointer(&fc), unsafe.Sizeof(fc))
+	}
+	if err == nil {
+		err = unix.Bind(fd, &unix.SockaddrCAN{
+			Ifindex: iface.Index,
+			RxID:    rawCanID(opts.RxID, opts.kind()),
+			TxID:    rawCanID(opts.TxID, opts.kind()),
+		})
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	dev, err := newDevice(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &ISOTP{opts: opts, dev: &dev}, nil
+}
+
+// NewISOTP starts the user space ISO-TP implementation on the bus.
+// Closing the connection closes the bus.
+func NewISOTP(conn Bus, opts ISOTPOptions) *ISOTP {
+	tp := &ISOTP{
+		opts:   opts,
+		conn:   conn,
+		fc:     make(chan Frame, 1),
+		pdus:   make(chan []byte, 16),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go tp.readLoop()
+	return tp
+}
+
+// Kernel reports whether the kernel CAN_ISOTP protocol is used.
+func (tp *ISOTP) Kernel() bool {
+	return tp.dev != nil
+}
+
+// Close closes the connection.
+func (tp *ISOTP) Close() error {
+	if tp.dev != nil {
+		return tp.dev.Close()
+	}
+	var err error
+	tp.once.Do(func() {
+		close(tp.closed)
+		err = tp.conn.Close()
+	})
+	return err
+}
+
+// Send sends the payload as one PDU, segmented into first and
+// consecutive frames if it does not fit into a single frame.
+func (tp *ISOTP) Send(payload []byte) error {
+	if len(payload) > MaxISOTPLen {
+		return errISOTPTooBig
+	}
+	if tp.dev != nil {
+		_, err := tp.dev.Write(payload)
+		return err
+	}
+
+	tp.sendMu.Lock()
+	defer tp.sendMu.Unlock()
+
+	// single frame
+	if len(payload) <= 7 {
+		data := append([]byte{byte(isotpSF<<4 | len(payload))}, payload...)
+		return tp.sendFrame(data)
+	}
+
+	// flow control frames left over from an aborted transfer
+	for len(tp.fc) > 0 {
+		<-tp.fc
+	}
+
+	// first frame
+	data := append([]byte{byte(isotpFF<<4 | len(payload)>>8), byte(len(payload))}, payload[:6]...)
+	if err := tp.sendFrame(data); err != nil {
+		return err
+	}
+	payload = payload[6:]
+
+	sn := byte(1)
+	for len(payload) > 0 {
+		bs, stmin, err := tp.waitFC()
+		if err != nil {
+			return err
+		}
+		for i := 0; len(payload) > 0 && (bs == 0 || i < int(bs)); i++ {
+			if i > 0 || sn > 1 {
+				time.Sleep(stmin)
+			}
+			n := min(7, len(payload))
+			data := append([]byte{isotpCF<<4 | sn&0x0F}, payload[:n]...)
+			if err := tp.sendFrame(data); err != nil {
+				return err
+			}
+			payload = payload[n:]
+			sn++
+		}
+	}
+	return nil
+}
+
+// Recv receives the next complete PDU.
+func (tp *ISOTP) Recv() ([]byte, error) {
+	if tp.dev != nil {
+		buf := make([]byte, MaxISOTPLen+1)
+		for {
+			n, err := tp.dev.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			// the kernel may accept longer PDUs, which are dropped like
+			// in userspace instead of returned truncated
+			if n <= MaxISOTPLen {
+				return buf[:n], nil
+			}
+		}
+	}
+
+	select {
+	case pdu := <-tp.pdus:
+		return pdu, nil
+	case <-tp.done:
+		select {
+		case pdu := <-tp.pdus:
+			return pdu, nil
+		default:
+		}
+		return nil, tp.err
+	}
+}
+
+// waitFC waits for a flow control frame and returns the block size and
+// the separation time requested by the receiver.
+func (tp *ISOTP) waitFC() (uint8, time.Duration, error) {
+	timer := time.NewTimer(tp.opts.timeout())
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-tp.fc:
+			switch msg.Data[0] & 0x0F {
+			case isotpCTS:
+				var bs, stmin byte
+				if len(msg.Data) >= 3 {
+					bs, stmin = msg.Data[1], msg.Data[2]
+				}
+				return bs, decodeSTmin(stmin), nil
+			case isotpWait:
+				timer.Reset(tp.opts.timeout())
+			default:
+				return 0, 0, errISOTPOverflow
+			}
+		case <-timer.C:
+			return 0, 0, errISOTPTimeout
+		case <-tp.done:
+			return 0, 0, errISOTPClosed
+		}
+	}
+}
+
+func (tp *ISOTP) sendFrame(data []byte) error {
+	if tp.opts.Padding {
+		for len(data) < MaxDataLen {
+			data = append(data, tp.opts.PadByte)
+		}
+	}
+	_, err := tp.conn.Send(Frame{ID: tp.opts.TxID, Kind: tp.opts.kind(), Data: data})
+	return err
+}
+
+// readLoop dispatches the received frames: flow control frames to the
+// sender, single, first and consecutive frames to the reassembly.
+func (tp *ISOTP) readLoop() {
+	var (
+		pdu  []byte
+		size int
+		sn   byte
+		bs   int
+		last time.Time
+	)
+	for {
+		msg, err := tp.conn.Recv()
+		if err != nil {
+			tp.err = err
+			close(tp.done)
+			return
+		}
+		if msg.ID != tp.opts.RxID || msg.Kind != tp.opts.kind() || len(msg.Data) == 0 {
+			continue
+		}
+		data := msg.Data
+		switch data[0] >> 4 {
+		case isotpSF:
+			n := int(data[0] & 0x0F)
+			if n == 0 || n > len(data)-1 {
+				continue
+			}
+			pdu = nil
+			tp.deliver(append([]byte(nil), data[1:1+n]...))
+		case isotpFF:
+			pdu = nil
+			if len(data) < MaxDataLen {
+				continue
+			}
+			// a length of 0 escapes to a 32 bit length for PDUs over 4095 bytes
+			size = int(data[0]&0x0F)<<8 | int(data[1])
+			start := 2
+			if size == 0 {
+				size = int(binary.BigEndian.Uint32(data[2:6]))
+				start = 6
+				if size <= MaxISOTPLen {
+					continue
+				}
+			}
+			// the sender aborts on overflow instead of waiting for a timeout
+			if size > MaxISOTPLen {
+				tp.sendFrame([]byte{isotpFC<<4 | isotpOverflow, 0, 0})
+				continue
+			}
+			// a PDU that fits into a single frame is not segmented
+			if size <= 7 {
+				continue
+			}
+			n := min(len(data)-start, size)
+			pdu = append(make([]byte, 0, size), data[start:start+n]...)
+			sn, bs, last = 1, 0, time.Now()
+			tp.sendFrame([]byte{isotpFC<<4 | isotpCTS, tp.opts.BlockSize, encodeSTmin(tp.opts.STmin)})
+		case isotpCF:
+			if pdu == nil || data[0]&0x0F != sn&0x0F || time.Since(last) > tp.opts.timeout() {
+				pdu = nil
+				continue
+			}
+			n := min(len(data)-1, size-len(pdu))
+			if n < 0 {
+				pdu = nil
+				continue
+			}
+			pdu = append(pdu, data[1:1+n]...)
+			sn++
+			bs++
+			last = time.Now()
+			if len(pdu) == size {
+				tp.deliver(pdu)
+				pdu = nil
+				continue
+			}
+			if tp.opts.BlockSize > 0 && bs == int(tp.opts.BlockSize) {
+				bs = 0
+				tp.sendFrame([]byte{isotpFC<<4 | isotpCTS, tp.opts.BlockSize, encodeSTmin(tp.opts.STmin)})
+			}
+		case isotpFC:
+			select {
+			case tp.fc <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// deliver passes a complete PDU to Recv.
+func (tp *ISOTP) deliver(pdu []byte) {
+	select {
+	case tp.pdus <- pdu:
+	case <-tp.closed:
+	}
+}
+
+// encodeSTmin returns the STmin byte for the separation time d.
+func encodeSTmin(d time.Duration) byte {
+	switch {
+	case d <= 0:
+		return 0
+	case d < time.Millisecond:
+		us := max(d/(100*time.Microsecond), 1)
+		return 0xF0 + byte(us)
+	case d > 127*time.Millisecond:
+		return 127
+	default:
+		return byte(d / time.Millisecond)
+	}
+}
+
+// decodeSTmin returns the separation time of the STmin byte. Reserved
+// values are interpreted as 127 ms.
+func decodeSTmin(b byte) time.Duration {
+	switch {
+	case b <= 0x7F:
+		return time.Duration(b) * time.Millisecond
+	case b >= 0xF1 && b <= 0xF9:
+		return time.Duration(b-0xF0) * 100 * time.Microsecond
+	default:
+		return 127 * time.Millisecond
+	}
+}
+
+func setsockopt(fd, level, opt int, p unsafe.Pointer, size uintptr) error {
+	_, _, e := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), uintptr(level), uintptr(opt), uintptr(p), size, 0)
+	if e != 0 {
+		return fmt.Errorf("could not set socket option %d: %w", opt, e)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package canbus
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestISOTPUserspace(t *testing.T) {
+	a, b := newSocketPair(t)
+	tester := NewISOTP(a, ISOTPOptions{TxID: 0x7E0, RxID: 0x7E8, Padding: true, PadByte: 0xCC})
+	ecu := NewISOTP(b, ISOTPOptions{TxID: 0x7E8, RxID: 0x7E0, BlockSize: 4, STmin: 200 * time.Microsecond})
+
+	for _, size := range []int{1, 7, 8, 62, 300} {
+		payload := make([]byte, size)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		errc := make(chan error, 1)
+		go func() { errc <- tester.Send(payload) }()
+
+		got, err := ecu.Recv()
+		if err != nil {
+			t.Fatalf("size %d: recv: %v", size, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("size %d: send: %v", size, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("size %d: got %X, want %X", size, got, payload)
+		}
+	}
+
+	// response in the other direction
+	go ecu.Send([]byte{0x62, 0xF1, 0x90, 'W', 'V', 'W', 'Z', 'Z', 'Z'})
+	got, err := tester.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 9 || got[0] != 0x62 {
+		t.Errorf("got %X", got)
+	}
+}
+
+func TestISOTPReassembly(t *testing.T) {
+	a, b := newSocketPair(t)
+	ecu := NewISOTP(b, ISOTPOptions{TxID: 0x7E8, RxID: 0x7E0})
+	send := func(data ...byte) {
+		t.Helper()
+		if _, err := a.Send(Frame{ID: 0x7E0, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a first frame of a PDU fitting into a single frame, followed by a
+	// consecutive frame
+	send(0x10, 0x05, 1, 2, 3, 4, 5, 6)
+	send(0x21, 7, 8)
+	// a short first frame and a consecutive frame without first frame
+	send(0x10, 0x08, 1, 2)
+	send(0x21, 1, 2, 3, 4, 5, 6, 7)
+	// an escaped length fitting into 12 bits
+	send(0x10, 0x00, 0x00, 0x00, 0x00, 0x10, 1, 2)
+	send(0x21, 3, 4, 5, 6, 7, 8, 9)
+	// a wrong sequence number aborts the reassembly
+	send(0x10, 0x0A, 1, 2, 3, 4, 5, 6)
+	send(0x22, 7, 8, 9, 10)
+	send(0x21, 7, 8, 9, 10)
+
+	// a PDU of 8 bytes with its consecutive frame longer than needed
+	send(0x10, 0x08, 1, 2, 3, 4, 5, 6)
+	send(0x21, 7, 8, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC)
+	if got, err := ecu.Recv(); err != nil || !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("got %X, %v", got, err)
+	}
+
+	// a PDU over MaxISOTPLen with an escaped length is refused with an
+	// overflow, its consecutive frames are ignored
+	send(0x10, 0x00, 0x00, 0x00, 0x10, 0x04, 1, 2)
+	send(0x21, 3, 4, 5, 6, 7, 8, 9)
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		msg, err := a.Recv()
+		if err != nil {
+			t.Fatalf("no overflow flow control: %v", err)
+		}
+		if msg.ID == 0x7E8 && msg.Data[0] == isotpFC<<4|isotpOverflow {
+			break
+		}
+	}
+
+	send(0x03, 0x11, 0x22, 0x33)
+	if got, err := ecu.Recv(); err != nil || !bytes.Equal(got, []byte{0x11, 0x22, 0x33}) {
+		t.Errorf("got %X, %v", got, err)
+	}
+}
+
+func TestSTmin(t *testing.T) {
+	for _, tc := range []struct {
+		d time.Duration
+		b byte
+	}{
+		{0, 0x00},
+		{10 * time.Millisecond, 0x0A},
+		{127 * time.Millisecond, 0x7F},
+		{100 * time.Microsecond, 0xF1},
+		{900 * time.Microsecond, 0xF9},
+	} {
+		if b := encodeSTmin(tc.d); b != tc.b {
+			t.Errorf("encodeSTmin(%v) = %02X, want %02X", tc.d, b, tc.b)
+		}
+		if d := decodeSTmin(tc.b); d != tc.d {
+			t.Errorf("decodeSTmin(%02X) = %v, want %v", tc.b, d, tc.d)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package canbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SAE J1939 addresses and PGNs.
+const (
+	J1939NoAddr   = 0xFF    // broadcast or no address
+	J1939IdleAddr = 0xFE    // no address claimed
+	J1939NoName   = 0       // no NAME
+	J1939NoPGN    = 0x40000 // no PGN
+	J1939MaxPGN   = 0x3FFFF
+
+	J1939PGNRequest        = 0x0EA00 // request PGN
+	J1939PGNAddressClaimed = 0x0EE00 // address claimed PGN
+)
+
+// socket options and control messages of the kernel CAN_J1939 protocol.
+const (
+	solCanJ1939      = unix.SOL_CAN_BASE + unix.CAN_J1939
+	soJ1939Promisc   = 2
+	soJ1939SendPrio  = 3
+	scmJ1939DestAddr = 1
+	scmJ1939DestName = 2
+	scmJ1939Prio     = 3
+	j1939RecvBufSize = 1 << 17 // longer ETP messages are truncated
+)
+
+var errJ1939NotBound = errors.New("canbus: J1939 socket not bound")
+
+// J1939Msg is a J1939 message received from a J1939 socket.
+type J1939Msg struct {
+	PGN       uint32
+	Priority  uint8
+	Src       uint8  // source address
+	SrcName   uint64 // source NAME, if known
+	Dst       uint8  // destination address, J1939NoAddr for broadcast
+	DstName   uint64 // destination NAME, if known
+	Data      []byte
+	Timestamp time.Time
+}
+
+// J1939 is a SAE J1939 socket of the kernel CAN_J1939 protocol. The
+// kernel handles the transport protocols for messages longer than 8 bytes
+// and the address claiming of bound NAMEs.
+type J1939 struct {
+	iface *net.Interface
+	dev   device
+	name  uint64
+	addr  uint8
+
+	rmu sync.Mutex
+	buf []byte // receive buffer, reused by Recv
+}
+
+// NewJ1939 returns a new J1939 socket.
+func NewJ1939() (*J1939, error) {
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_DGRAM, unix.CAN_J1939)
+	if err != nil {
+		return nil, err
+	}
+	_ = enableTimestamps(fd)
+	dev, err := newDevice(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &J1939{dev: dev, addr: J1939NoAddr}, nil
+}
+
+// Bind binds the socket on the named CAN interface with the local NAME
+// and address. With a NAME the kernel uses the address claimed for it;
+// with J1939NoName the static address addr is used. J1939NoAddr with
+// J1939NoName receives only.
+func (j *J1939) Bind(ifname string, name uint64, addr uint8) error {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return err
+	}
+	err = unix.Bind(j.dev.fd, &unix.SockaddrCANJ1939{
+		Ifindex: iface.Index,
+		Name:    name,
+		PGN:     J1939NoPGN,
+		Addr:    addr,
+	})
+	if err != nil {
+		return err
+	}
+	j.iface = iface
+	j.name = name
+	j.addr = addr
+
+	return nil
+}
+
+// Name returns the device name the socket is bound to.
+func (j *J1939) Name() string {
+	if j.iface == nil {
+		return "N/A"
+	}
+	return j.iface.Name
+}
+
+// Close closes the J1939 socket.
+func (j *J1939) Close() error {
+	return j.dev.Close()
+}
+
+// SetPriority sets the priority 0 (highest) to 7 of sent messages.
+func (j *J1939) SetPriority(prio uint8) error {
+	err := unix.SetsockoptInt(j.dev.fd, solCanJ1939, soJ1939SendPrio, int(prio&0x07))
+	if err != nil {
+		return fmt.Errorf("could not set J1939 priority: %w", err)
+	}
+	return nil
+}
+
+// SetPromisc enables the reception of all messages, not only those to
+// the local address and broadcasts.
+func (j *J1939) SetPromisc(enable bool) error {
+	err := unix.SetsockoptInt(j.dev.fd, solCanJ1939, soJ1939Promisc, boolInt(enable))
+	if err != nil {
+		return fmt.Errorf("could not set J1939 promiscuous mode: %w", err)
+	}
+	return nil
+}
+
+// SetBroadcast allows sending to the broadcast address J1939NoAddr.
+func (j *J1939) SetBroadcast(enable bool) error {
+	err := unix.SetsockoptInt(j.dev.fd, unix.SOL_SOCKET, unix.SO_BROADCAST, boolInt(enable))
+	if err != nil {
+		return fmt.Errorf("could not set J1939 broadcast: %w", err)
+	}
+	return nil
+}
+
+// Send sends data with the PGN to the destination address dst. Data
+// longer than 8 bytes is sent with the transport protocol.
+func (j *J1939) Send(pgn uint32, dst uint8, data []byte) error {
+	return j.sendTo(&unix.SockaddrCANJ1939{
+		Ifindex: j.ifindex(),
+		Name:    J1939NoName,
+		PGN:     pgn & J1939MaxPGN,
+		Addr:    dst,
+	}, data)
+}
+
+// SendName sends data with the PGN to the node with the NAME dst.
+func (j *J1939) SendName(pgn uint32, dst uint64, data []byte) error {
+	return j.sendTo(&unix.SockaddrCANJ1939{
+		Ifindex: j.ifindex(),
+		Name:    dst,
+		PGN:     pgn & J1939MaxPGN,
+		Addr:    J1939NoAddr,
+	}, data)
+}
+
+// ClaimAddress broadcasts the address claimed message for the bound
+// NAME and address. The kernel tracks the claim and resolves conflicts.
+func (j *J1939) ClaimAddress() error {
+	if j.iface == nil || j.name == J1939NoName {
+		return errJ1939NotBound
+	}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, j.name)
+	err := j.SetBroadcast(true)
+	if err != nil {
+		return err
+	}
+	return j.Send(J1939PGNAddressClaimed, J1939NoAddr, data)
+}
+
+// Recv receives the next J1939 message with the source address, the
+// destination and the priority.
+func (j *J1939) Recv() (msg J1939Msg, err error) {
+	j.rmu.Lock()
+	defer j.rmu.Unlock()
+	if j.buf == nil {
+		j.buf = make([]byte, j1939RecvBufSize)
+	}
+	oob := make([]byte, oobSize+3*unix.CmsgSpace(8))
+	n, oobn, _, from, err := j.dev.Recvmsg(j.buf, oob)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Data = append([]byte(nil), j.buf[:n]...)
+	msg.Dst = J1939NoAddr
+	if sa, ok := from.(*unix.SockaddrCANJ1939); ok {
+		msg.PGN = sa.PGN
+		msg.Src = sa.Addr
+		msg.SrcName = sa.Name
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err == nil {
+		for _, m := range msgs {
+			if m.Header.Level != solCanJ1939 || len(m.Data) == 0 {
+				continue
+			}
+			switch m.Header.Type {
+			case scmJ1939DestAddr:
+				msg.Dst = m.Data[0]
+			case scmJ1939DestName:
+				if len(m.Data) >= 8 {
+					msg.DstName = binary.NativeEndian.Uint64(m.Data)
+				}
+			case scmJ1939Prio:
+				msg.Priority = m.Data[0]
+			}
+		}
+	}
+	msg.Timestamp = parseTimestamp(oob[:oobn])
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg, nil
+}
+
+func (j *J1939) sendTo(sa *unix.SockaddrCANJ1939, data []byte) error {
+	return j.dev.Sendto(data, sa)
+}
+
+func (j *J1939) ifindex() int {
+	if j.iface == nil {
+		return 0
+	}
+	return j.iface.Index
+}
+
+// J1939ID is the content of a 29 bit CAN ID of a J1939 frame.
+type J1939ID struct {
+	Priority uint8
+	PGN      uint32
+	Dst      uint8 // destination address for PDU1 format, J1939NoAddr for PDU2
+	Src      uint8
+}
+
+// ParseJ1939ID splits the 29 bit ID of an EFF frame into priority, PGN,
+// destination and source address. For the peer-to-peer PDU1 format
+// (PF < 240) the PDU specific byte is the destination address and is not
+// part of the PGN.
+func ParseJ1939ID(id uint32) J1939ID {
+	jid := J1939ID{
+		Priority: uint8(id>>26) & 0x07,
+		Src:      uint8(id),
+		Dst:      J1939NoAddr,
+	}
+	pgn := (id >> 8) & J1939MaxPGN
+	if pf := uint8(pgn >> 8); pf < 240 {
+		jid.Dst = uint8(pgn)
+		pgn &^= 0xFF
+	}
+	jid.PGN = pgn
+	return jid
+}
+
+// ID returns the 29 bit CAN ID.
+func (jid J1939ID) ID() uint32 {
+	pgn := jid.PGN & J1939MaxPGN
+	if uint8(pgn>>8) < 240 {
+		pgn = pgn&^0xFF | uint32(jid.Dst)
+	}
+	return uint32(jid.Priority&0x07)<<26 | pgn<<8 | uint32(jid.Src)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,25 @@
+package canbus
+
+import "testing"
+
+func TestParseJ1939ID(t *testing.T) {
+	for _, tc := range []struct {
+		id   uint32
+		want J1939ID
+	}{
+		// EEC1, PDU2 broadcast from the engine
+		{0x0CF00400, J1939ID{Priority: 3, PGN: 0xF004, Dst: J1939NoAddr, Src: 0x00}},
+		// request PGN from 0xF9 to 0x00, PDU1
+		{0x18EA00F9, J1939ID{Priority: 6, PGN: J1939PGNRequest, Dst: 0x00, Src: 0xF9}},
+		// address claimed to global
+		{0x18EEFF80, J1939ID{Priority: 6, PGN: J1939PGNAddressClaimed, Dst: 0xFF, Src: 0x80}},
+	} {
+		got := ParseJ1939ID(tc.id)
+		if got != tc.want {
+			t.Errorf("ParseJ1939ID(%08X) = %+v, want %+v", tc.id, got, tc.want)
+		}
+		if id := got.ID(); id != tc.id {
+			t.Errorf("ID() = %08X, want %08X", id, tc.id)
+		}
+	}
+}
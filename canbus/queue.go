@@ -0,0 +1,120 @@
+package canbus
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recvQueue holds the frames of a bus whose frames are received by a
+// reader goroutine, such as a serial line or a TCP connection. It
+// implements the receive part of Bus with the filters in userspace.
+type recvQueue struct {
+	frames  chan Frame
+	closed  chan struct{}
+	done    chan struct{} // closed when the reader stopped
+	readErr error         // error that stopped the reader
+	filters atomic.Pointer[FilterSet]
+	drops   atomic.Uint32
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func newRecvQueue() *recvQueue {
+	return &recvQueue{
+		frames: make(chan Frame, virtualQueueLen),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// push queues a received frame the filters pass.
+func (q *recvQueue) push(msg Frame) {
+	if fs := q.filters.Load(); fs != nil && !fs.Match(msg) {
+		return
+	}
+	select {
+	case q.frames <- msg:
+	default:
+		q.drops.Add(1)
+	}
+}
+
+// stop is called by the reader when it stopped with err.
+func (q *recvQueue) stop(err error) {
+	q.readErr = err
+	close(q.done)
+}
+
+// Recv receives the next frame.
+func (q *recvQueue) Recv() (Frame, error) {
+	return q.RecvContext(context.Background())
+}
+
+// RecvContext receives the next frame until ctx is done.
+func (q *recvQueue) RecvContext(ctx context.Context) (Frame, error) {
+	q.mu.Lock()
+	deadline := q.deadline
+	q.mu.Unlock()
+
+	// frames received before the reader stopped
+	select {
+	case msg := <-q.frames:
+		return msg, nil
+	default:
+	}
+	select {
+	case <-q.closed:
+		return Frame{}, os.ErrClosed
+	default:
+	}
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case msg := <-q.frames:
+		return msg, nil
+	case <-q.closed:
+		return Frame{}, os.ErrClosed
+	case <-q.done:
+		return Frame{}, q.readErr
+	case <-ctx.Done():
+		return Frame{}, ctx.Err()
+	case <-timeout:
+		return Frame{}, os.ErrDeadlineExceeded
+	}
+}
+
+// SetReadDeadline sets the deadline for future Recv calls. A zero value
+// for t means Recv will not time out.
+func (q *recvQueue) SetReadDeadline(t time.Time) error {
+	q.mu.Lock()
+	q.deadline = t
+	q.mu.Unlock()
+	return nil
+}
+
+// SetFilterSet passes only the frames matched by the filter set.
+func (q *recvQueue) SetFilterSet(fs FilterSet) error {
+	fs.Filters = append([]Filter(nil), fs.Filters...)
+	q.filters.Store(&fs)
+	return nil
+}
+
+// ResetFilters passes all frames again.
+func (q *recvQueue) ResetFilters() error {
+	q.filters.Store(nil)
+	return nil
+}
+
+// Dropped returns the number of frames dropped because the receive
+// queue was full.
+func (q *recvQueue) Dropped() uint32 {
+	return q.drops.Load()
+}
@@ -0,0 +1,516 @@
+package canbus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// slcanBitrates are the CAN bitrates of the commands S0 to S8.
+var slcanBitrates = []uint32{10000, 20000, 50000, 100000, 125000, 250000, 500000, 800000, 1000000}
+
+// slcanBauds maps the serial line speeds to the termios speeds.
+var slcanBauds = map[int]uint32{
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+}
+
+// slcanMaxLine is the length of the longest line, a CAN FD frame with
+// extended ID and timestamp.
+const slcanMaxLine = 1 + 8 + 1 + 2*MaxFDDataLen + 4
+
+// slcanTsWrap is the wrap around of the adapter timestamps in ms.
+const slcanTsWrap = 60000
+
+var (
+	errSLCANRejected = errors.New("canbus: slcan command rejected")
+	errSLCANFrame    = errors.New("canbus: invalid slcan frame")
+	errSLCANKind     = errors.New("canbus: CAN XL and error frames not supported by slcan")
+)
+
+// SLCANOptions configure a serial line CAN adapter.
+type SLCANOptions struct {
+	Baud       int           // serial line speed, default 115200, ignored by USB CDC adapters
+	Bitrate    uint32        // CAN bitrate, 0 keeps the bitrate of the adapter
+	ListenOnly bool          // receive without acknowledging frames
+	Timestamps bool          // receive time of the adapter instead of the host
+	Timeout    time.Duration // command reply timeout, default 1s
+}
+
+func (opts SLCANOptions) timeout() time.Duration {
+	if opts.Timeout <= 0 {
+		return time.Second
+	}
+	return opts.Timeout
+}
+
+// SLCANStatus holds the status flags of a serial line CAN adapter.
+type SLCANStatus uint8
+
+const (
+	SLCANRxFull          SLCANStatus = 0x01 // receive FIFO full
+	SLCANTxFull          SLCANStatus = 0x02 // transmit FIFO full
+	SLCANErrorWarning    SLCANStatus = 0x04 // error warning
+	SLCANDataOverrun     SLCANStatus = 0x08 // frames lost
+	SLCANErrorPassive    SLCANStatus = 0x20 // error passive
+	SLCANArbitrationLost SLCANStatus = 0x40 // arbitration lost
+	SLCANBusError        SLCANStatus = 0x80 // bus error
+)
+
+// SLCAN is a serial line CAN adapter speaking the LAWICEL ASCII protocol,
+// used directly on the serial device without the slcan line discipline
+// of the kernel. Filters are applied to the received frames in userspace.
+type SLCAN struct {
+	*recvQueue
+	name    string
+	port    *os.File
+	opts    SLCANOptions
+	replies chan string
+	once    sync.Once
+	cmdMu   sync.Mutex // one command at a time
+
+	// unwrapping of the adapter timestamps, used by the reader only
+	tsBase time.Time
+	tsLast uint16
+}
+
+// OpenSLCAN opens the serial line CAN adapter at path, sets the bitrate
+// and opens the CAN channel.
+func OpenSLCAN(path string, opts SLCANOptions) (*SLCAN, error) {
+	baud := opts.Baud
+	if baud == 0 {
+		baud = 115200
+	}
+	speed, ok := slcanBauds[baud]
+	if !ok {
+		return nil, fmt.Errorf("canbus: unsupported serial speed %d", baud)
+	}
+	code := -1
+	for i, rate := range slcanBitrates {
+		if rate == opts.Bitrate {
+			code = i
+		}
+	}
+	if opts.Bitrate != 0 && code < 0 {
+		return nil, fmt.Errorf("canbus: unsupported slcan bitrate %d", opts.Bitrate)
+	}
+
+	port, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = setRawTTY(port, speed)
+	if err != nil {
+		port.Close()
+		return nil, fmt.Errorf("canbus: %s: %w", path, err)
+	}
+
+	sl := &SLCAN{
+		recvQueue: newRecvQueue(),
+		name:      path,
+		port:      port,
+		opts:      opts,
+		replies:   make(chan string, 16),
+	}
+	go sl.read()
+
+	// empty the command buffer of the adapter, the channel may be open;
+	// the replies to the empty commands are discarded until they stop
+	port.Write([]byte("\r\r\r"))
+	quiet := time.NewTimer(100 * time.Millisecond)
+	for flushed := false; !flushed; {
+		select {
+		case <-sl.replies:
+			quiet.Reset(20 * time.Millisecond)
+		case <-quiet.C:
+			flushed = true
+		}
+	}
+	sl.command("C")
+	if code >= 0 {
+		_, err = sl.command("S" + strconv.Itoa(code))
+	}
+	if err == nil {
+		ts := "Z0"
+		if opts.Timestamps {
+			ts = "Z1"
+		}
+		_, err = sl.command(ts)
+		if err != nil && !opts.Timestamps {
+			// adapters without timestamps may not know the command
+			err = nil
+		}
+	}
+	if err == nil {
+		err = sl.Open()
+	}
+	if err != nil {
+		sl.port.Close()
+		return nil, err
+	}
+	return sl, nil
+}
+
+// setRawTTY sets the serial line to raw 8N1 mode with the termios speed.
+func setRawTTY(port *os.File, speed uint32) error {
+	conn, err := port.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var terr error
+	err = conn.Control(func(fd uintptr) {
+		var tio *unix.Termios
+		tio, terr = unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if terr != nil {
+			return
+		}
+		tio.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+		tio.Oflag &^= unix.OPOST
+		tio.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		tio.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+		tio.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+		tio.Ispeed, tio.Ospeed = speed, speed
+		tio.Cc[unix.VMIN], tio.Cc[unix.VTIME] = 1, 0
+		terr = unix.IoctlSetTermios(int(fd), unix.TCSETS, tio)
+	})
+	if err != nil {
+		return err
+	}
+	return terr
+}
+
+// Name returns the path of the serial device.
+func (sl *SLCAN) Name() string {
+	return sl.name
+}
+
+// Open opens the CAN channel of the adapter, listen only if set in the
+// options.
+func (sl *SLCAN) Open() error {
+	cmd := "O"
+	if sl.opts.ListenOnly {
+		cmd = "L"
+	}
+	_, err := sl.command(cmd)
+	return err
+}
+
+// CloseChannel closes the CAN channel of the adapter. The serial line
+// stays open, e.g. to change the bitrate.
+func (sl *SLCAN) CloseChannel() error {
+	_, err := sl.command("C")
+	return err
+}
+
+// Version returns the hardware and software version of the adapter.
+func (sl *SLCAN) Version() (string, error) {
+	reply, err := sl.command("V")
+	if err != nil {
+		return "", err
+	}
+	if len(reply) < 1 || reply[0] != 'V' {
+		return "", fmt.Errorf("canbus: invalid slcan version %q", reply)
+	}
+	return reply[1:], nil
+}
+
+// Status reads the status flags of the adapter.
+func (sl *SLCAN) Status() (SLCANStatus, error) {
+	reply, err := sl.command("F")
+	if err != nil {
+		return 0, err
+	}
+	if len(reply) != 3 || reply[0] != 'F' {
+		return 0, fmt.Errorf("canbus: invalid slcan status %q", reply)
+	}
+	flags, err := strconv.ParseUint(reply[1:], 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("canbus: invalid slcan status %q", reply)
+	}
+	return SLCANStatus(flags), nil
+}
+
+// Send sends the frame and waits for the adapter to accept it.
+func (sl *SLCAN) Send(msg Frame) (int, error) {
+	line, err := appendSLCANFrame(nil, msg)
+	if err != nil {
+		return 0, err
+	}
+	_, err = sl.command(string(line))
+	if err != nil {
+		return 0, err
+	}
+	return len(line) + 1, nil
+}
+
+// command sends a command and returns the reply without the CR.
+func (sl *SLCAN) command(cmd string) (string, error) {
+	sl.cmdMu.Lock()
+	defer sl.cmdMu.Unlock()
+	select {
+	case <-sl.closed:
+		return "", os.ErrClosed
+	case <-sl.done:
+		return "", sl.readErr
+	default:
+	}
+	// replies of timed out commands
+	for len(sl.replies) > 0 {
+		<-sl.replies
+	}
+	_, err := sl.port.Write([]byte(cmd + "\r"))
+	if err != nil {
+		return "", err
+	}
+	timer := time.NewTimer(sl.opts.timeout())
+	defer timer.Stop()
+	select {
+	case reply := <-sl.replies:
+		if reply == "\a" {
+			return "", fmt.Errorf("%w: %q", errSLCANRejected, cmd)
+		}
+		return reply, nil
+	case <-sl.done:
+		return "", sl.readErr
+	case <-timer.C:
+		return "", fmt.Errorf("canbus: no slcan reply to %q: %w", cmd, os.ErrDeadlineExceeded)
+	}
+}
+
+// read splits the received data into frames and command replies until
+// the serial line is closed or fails.
+func (sl *SLCAN) read() {
+	buf := make([]byte, 512)
+	line := make([]byte, 0, slcanMaxLine)
+	for {
+		n, err := sl.port.Read(buf)
+		for _, c := range buf[:n] {
+			switch c {
+			case '\r':
+				sl.handleLine(line)
+				line = line[:0]
+			case '\a':
+				sl.reply("\a")
+				line = line[:0]
+			default:
+				if len(line) < slcanMaxLine {
+					line = append(line, c)
+				}
+			}
+		}
+		if err != nil {
+			sl.stop(err)
+			return
+		}
+	}
+}
+
+func (sl *SLCAN) handleLine(line []byte) {
+	if len(line) == 0 || !isSLCANFrame(line[0]) {
+		sl.reply(string(line))
+		return
+	}
+	msg, ts, hasTS, err := parseSLCANFrame(line)
+	if err != nil {
+		return
+	}
+	msg.Timestamp = time.Now()
+	if hasTS && sl.opts.Timestamps {
+		msg.Timestamp = sl.timestamp(msg.Timestamp, ts)
+	}
+	msg.Iface = sl.name
+	sl.push(msg)
+}
+
+func (sl *SLCAN) reply(reply string) {
+	select {
+	case sl.replies <- reply:
+	default:
+	}
+}
+
+// timestamp returns the time of the adapter timestamp in ms, which wraps
+// around after a minute, relative to the host time of the first frame.
+func (sl *SLCAN) timestamp(now time.Time, ts uint16) time.Time {
+	ms := time.Millisecond
+	if sl.tsBase.IsZero() {
+		sl.tsBase = now.Add(-time.Duration(ts) * ms)
+	} else if ts < sl.tsLast {
+		sl.tsBase = sl.tsBase.Add(slcanTsWrap * ms)
+	}
+	sl.tsLast = ts
+	return sl.tsBase.Add(time.Duration(ts) * ms)
+}
+
+// Close closes the CAN channel and the serial line and unblocks pending
+// receives.
+func (sl *SLCAN) Close() error {
+	err := os.ErrClosed
+	sl.once.Do(func() {
+		sl.CloseChannel()
+		close(sl.closed)
+		err = sl.port.Close()
+	})
+	return err
+}
+
+// isSLCANFrame reports whether c starts a received frame.
+func isSLCANFrame(c byte) bool {
+	switch c {
+	case 't', 'T', 'r', 'R', 'd', 'D', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// parseSLCANFrame parses a frame line without the CR: tiiildd..,
+// Tiiiiiiiildd.., riiil, Riiiiiiiil and the CAN FD frames d, D, b and B
+// with the DLC as hex digit, followed by an optional timestamp of four
+// hex digits.
+func parseSLCANFrame(line []byte) (msg Frame, ts uint16, hasTS bool, err error) {
+	idLen := 3
+	switch line[0] {
+	case 'T', 'R', 'D', 'B':
+		idLen = 8
+	}
+	switch line[0] {
+	case 't', 'd', 'b':
+		msg.Kind = SFF
+	case 'T', 'D', 'B':
+		msg.Kind = EFF
+	case 'r':
+		msg.Kind = RTR_SFF
+	case 'R':
+		msg.Kind = RTR_EFF
+	}
+	switch line[0] {
+	case 'd', 'D':
+		msg.Flags = FDF
+	case 'b', 'B':
+		msg.Flags = FDF | BRS
+	}
+	if len(line) < 1+idLen+1 {
+		return msg, 0, false, errSLCANFrame
+	}
+	id, ok := parseHex(line[1 : 1+idLen])
+	if !ok || (idLen == 3 && id > unix.CAN_SFF_MASK) || id > unix.CAN_EFF_MASK {
+		return msg, 0, false, errSLCANFrame
+	}
+	msg.ID = id
+	dlc := unhex(line[1+idLen])
+	if dlc < 0 || (msg.Flags == 0 && dlc > MaxDataLen) {
+		return msg, 0, false, errSLCANFrame
+	}
+	n := dlc
+	if msg.Flags != 0 {
+		n = DLCToLen(uint8(dlc))
+	}
+	msg.Data = make([]byte, n)
+	rest := line[2+idLen:]
+	if msg.Kind == SFF || msg.Kind == EFF {
+		if len(rest) < 2*n {
+			return msg, 0, false, errSLCANFrame
+		}
+		for i := range msg.Data {
+			hi, lo := unhex(rest[2*i]), unhex(rest[2*i+1])
+			if hi < 0 || lo < 0 {
+				return msg, 0, false, errSLCANFrame
+			}
+			msg.Data[i] = byte(hi<<4 | lo)
+		}
+		rest = rest[2*n:]
+	}
+	switch len(rest) {
+	case 0:
+		return msg, 0, false, nil
+	case 4:
+		v, ok := parseHex(rest)
+		if !ok || v >= slcanTsWrap {
+			return msg, 0, false, errSLCANFrame
+		}
+		return msg, uint16(v), true, nil
+	}
+	return msg, 0, false, errSLCANFrame
+}
+
+// parseHex parses up to 8 hex digits.
+func parseHex(b []byte) (uint32, bool) {
+	var v uint32
+	for _, c := range b {
+		d := unhex(c)
+		if d < 0 {
+			return 0, false
+		}
+		v = v<<4 | uint32(d)
+	}
+	return v, true
+}
+
+// appendSLCANFrame appends the frame as slcan command without the CR.
+// CAN FD payloads are padded to the next valid length.
+func appendSLCANFrame(b []byte, msg Frame) ([]byte, error) {
+	if msg.IsXL() || msg.Kind == ERR {
+		return nil, errSLCANKind
+	}
+	fd := msg.IsFD()
+	if fd && len(msg.Data) > MaxFDDataLen || !fd && len(msg.Data) > MaxDataLen {
+		return nil, errDataTooBig
+	}
+	if fd && msg.Kind != SFF && msg.Kind != EFF {
+		return nil, errInvalidFDKind
+	}
+	var letter byte
+	switch msg.Kind {
+	case SFF:
+		letter = 't'
+		if fd {
+			letter = 'd'
+			if msg.Flags&BRS != 0 {
+				letter = 'b'
+			}
+		}
+	case EFF:
+		letter = 'T'
+		if fd {
+			letter = 'D'
+			if msg.Flags&BRS != 0 {
+				letter = 'B'
+			}
+		}
+	case RTR_SFF:
+		letter = 'r'
+	case RTR_EFF:
+		letter = 'R'
+	}
+	b = append(b, letter)
+	if msg.Kind == SFF || msg.Kind == RTR_SFF {
+		b = appendHex(b, msg.ID&unix.CAN_SFF_MASK, 3)
+	} else {
+		b = appendHex(b, msg.ID&unix.CAN_EFF_MASK, 8)
+	}
+	data := msg.Data
+	if fd {
+		data = make([]byte, FDLen(len(msg.Data)))
+		copy(data, msg.Data)
+	}
+	b = append(b, hexDigits[LenToDLC(len(data))])
+	if msg.Kind == SFF || msg.Kind == EFF {
+		b = appendHexData(b, data)
+	}
+	return b, nil
+}
@@ -0,0 +1,246 @@
+package canbus
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// slcanEmulator is a LAWICEL adapter on the master side of a pty.
+type slcanEmulator struct {
+	master *os.File
+	path   string // slave device
+
+	mu      sync.Mutex
+	open    bool
+	listen  bool
+	bitrate string
+	status  string
+	cmds    []string
+	sent    []string
+}
+
+func newSLCANEmulator(t *testing.T) *slcanEmulator {
+	t.Helper()
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("no pty: %v", err)
+	}
+	err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	if err != nil {
+		unix.Close(fd)
+		t.Skipf("no pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		t.Skipf("no pty: %v", err)
+	}
+	emu := &slcanEmulator{
+		master: os.NewFile(uintptr(fd), "/dev/ptmx"),
+		path:   "/dev/pts/" + strconv.Itoa(n),
+		status: "00",
+	}
+	t.Cleanup(func() { emu.master.Close() })
+	go emu.run()
+	return emu
+}
+
+func (emu *slcanEmulator) run() {
+	buf := make([]byte, 256)
+	var line []byte
+	for {
+		n, err := emu.master.Read(buf)
+		for _, c := range buf[:n] {
+			if c != '\r' {
+				line = append(line, c)
+				continue
+			}
+			emu.master.Write([]byte(emu.handle(string(line))))
+			line = line[:0]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the reply to a command
+func (emu *slcanEmulator) handle(cmd string) string {
+	emu.mu.Lock()
+	defer emu.mu.Unlock()
+	emu.cmds = append(emu.cmds, cmd)
+	if cmd == "" {
+		return "\a"
+	}
+	switch cmd[0] {
+	case 'S':
+		if emu.open || len(cmd) != 2 || cmd[1] < '0' || cmd[1] > '8' {
+			return "\a"
+		}
+		emu.bitrate = cmd[1:]
+	case 'Z':
+		if emu.open {
+			return "\a"
+		}
+	case 'O', 'L':
+		if emu.open {
+			return "\a"
+		}
+		emu.open, emu.listen = true, cmd[0] == 'L'
+	case 'C':
+		if !emu.open {
+			return "\a"
+		}
+		emu.open = false
+	case 'F':
+		return "F" + emu.status + "\r"
+	case 'V':
+		return "V1013\r"
+	case 't', 'r', 'd', 'b':
+		if !emu.open || emu.listen {
+			return "\a"
+		}
+		emu.sent = append(emu.sent, cmd)
+		return "z\r"
+	case 'T', 'R', 'D', 'B':
+		if !emu.open || emu.listen {
+			return "\a"
+		}
+		emu.sent = append(emu.sent, cmd)
+		return "Z\r"
+	default:
+		return "\a"
+	}
+	return "\r"
+}
+
+// receive sends frame lines to the adapter
+func (emu *slcanEmulator) receive(lines ...string) {
+	emu.master.Write([]byte(strings.Join(lines, "\r") + "\r"))
+}
+
+func TestSLCAN(t *testing.T) {
+	emu := newSLCANEmulator(t)
+	sl, err := OpenSLCAN(emu.path, SLCANOptions{Bitrate: 500000, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sl.Close()
+	emu.mu.Lock()
+	if !emu.open || emu.listen || emu.bitrate != "6" {
+		t.Errorf("open %v, listen %v, bitrate S%s, commands %q", emu.open, emu.listen, emu.bitrate, emu.cmds)
+	}
+	emu.mu.Unlock()
+
+	if v, err := sl.Version(); err != nil || v != "1013" {
+		t.Errorf("version %q, %v", v, err)
+	}
+	emu.mu.Lock()
+	emu.status = "A4"
+	emu.mu.Unlock()
+	if s, err := sl.Status(); err != nil || s != SLCANBusError|SLCANErrorPassive|SLCANErrorWarning {
+		t.Errorf("status %02X, %v", s, err)
+	}
+
+	frames := []Frame{
+		{ID: 0x123, Data: []byte{0x11, 0x22, 0x33}},
+		{ID: 0x1ABCDEF0, Kind: EFF, Data: []byte{}},
+		{ID: 0x7FF, Kind: RTR_SFF, Data: make([]byte, 2)},
+		{ID: 0x1, Kind: RTR_EFF, Data: []byte{}},
+		{ID: 0x42, Flags: FDF | BRS, Data: bytes.Repeat([]byte{0xA5}, 12)},
+		{ID: 0x10000, Kind: EFF, Flags: FDF, Data: bytes.Repeat([]byte{0x5A}, 64)},
+	}
+	want := []string{"t1233112233", "T1ABCDEF00", "r7FF2", "R000000010", "b042" + "9" + strings.Repeat("A5", 12), "D00010000F" + strings.Repeat("5A", 64)}
+	for i, f := range frames {
+		if _, err := sl.Send(f); err != nil {
+			t.Fatalf("send %+v: %v", f, err)
+		}
+		emu.mu.Lock()
+		if got := emu.sent[len(emu.sent)-1]; got != want[i] {
+			t.Errorf("sent %q, want %q", got, want[i])
+		}
+		emu.mu.Unlock()
+	}
+	if _, err := sl.Send(Frame{ID: 0x1, Flags: XLF, Data: []byte{1}}); err == nil {
+		t.Error("CAN XL frame sent")
+	}
+
+	// received frames, followed by an invalid line
+	emu.receive(append(want, "t12X1")...)
+	for _, f := range frames {
+		got, err := sl.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != f.ID || got.Kind != f.Kind || got.Flags != f.Flags || !bytes.Equal(got.Data, f.Data) || got.Timestamp.IsZero() {
+			t.Errorf("got %+v, want %+v", got, f)
+		}
+	}
+
+	// software filters
+	sl.SetFilterSet(FilterSet{Filters: []Filter{ExactID(0x200, SFFOnly)}})
+	emu.receive("t1000", "t2001AA")
+	if got, err := sl.Recv(); err != nil || got.ID != 0x200 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	sl.ResetFilters()
+
+	sl.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := sl.Recv(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	emu.mu.Lock()
+	if emu.open {
+		t.Error("channel open after close")
+	}
+	emu.mu.Unlock()
+	if _, err := sl.Recv(); err == nil {
+		t.Error("recv after close")
+	}
+}
+
+func TestSLCANOptions(t *testing.T) {
+	emu := newSLCANEmulator(t)
+	if _, err := OpenSLCAN(emu.path, SLCANOptions{Bitrate: 42}); err == nil {
+		t.Error("bitrate 42 accepted")
+	}
+	sl, err := OpenSLCAN(emu.path, SLCANOptions{ListenOnly: true, Timestamps: true, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sl.Close()
+	emu.mu.Lock()
+	if !emu.listen || emu.bitrate != "" || !strings.Contains(strings.Join(emu.cmds, " "), "Z1") {
+		t.Errorf("listen %v, bitrate S%s, commands %q", emu.listen, emu.bitrate, emu.cmds)
+	}
+	emu.mu.Unlock()
+	if _, err := sl.Send(Frame{ID: 0x1}); err == nil {
+		t.Error("sent in listen only mode")
+	}
+
+	// timestamps in ms, wrapping around after a minute, 60000 is invalid
+	emu.receive("t1000EA5F", "t1000EA60", "t10000010")
+	first, err := sl.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sl.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := second.Timestamp.Sub(first.Timestamp); d != 17*time.Millisecond {
+		t.Errorf("timestamp difference %v", d)
+	}
+}
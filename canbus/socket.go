@@ -5,17 +5,29 @@
 package canbus
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
 var (
-	errDataTooBig = errors.New("canbus: data too big")
+	errDataTooBig    = errors.New("canbus: data too big")
+	errFDNotEnabled  = errors.New("canbus: CAN FD frames not enabled")
+	errInvalidFDKind = errors.New("canbus: invalid kind for CAN FD frame")
+	errXLNotEnabled  = errors.New("canbus: CAN XL frames not enabled")
+	errInvalidXL     = errors.New("canbus: invalid CAN XL frame")
+)
+
+const (
+	canRawXLFrames  = 7  // CAN_RAW_XL_FRAMES, missing in x/sys/unix
+	canXLVCIDOffset = 16 // VCID position in the canxl_frame prio field
 )
 
 // New returns a new CAN bus socket.
@@ -25,7 +37,23 @@ func New() (*Socket, error) {
 		return nil, err
 	}
 
-	return &Socket{dev: device{fd}}, nil
+	// fall back to the time of reception in user space
+	_ = enableTimestamps(fd)
+	// drop counter, not supported by old kernels
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1)
+
+	return newSocket(fd)
+}
+
+// newSocket wraps the socket fd into a Socket.
+func newSocket(fd int) (*Socket, error) {
+	dev, err := newDevice(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &Socket{dev: dev}, nil
 }
 
 // Socket is a high-level representation of a CANBus socket.
@@ -33,11 +61,18 @@ type Socket struct {
 	iface *net.Interface
 	addr  *unix.SockaddrCAN
 	dev   device
+	fd    bool // CAN FD frames enabled
+	xl    bool // CAN XL frames enabled
+	drops atomic.Uint32
+	names ifaceNames
 }
 
 // Name returns the device name the socket is bound to.
 func (sck *Socket) Name() string {
 	if sck.iface == nil {
+		if sck.addr != nil {
+			return AnyInterface
+		}
 		return "N/A"
 	}
 	return sck.iface.Name
@@ -54,9 +89,78 @@ func (sck *Socket) SetFilters(filters []unix.CanFilter) error {
 	return nil
 }
 
+// SetErrorFilter sets the CAN_RAW_ERR_FILTER option. Error frames are
+// only delivered for the error classes in mask; a zero mask disables
+// the reception of error frames.
+func (sck *Socket) SetErrorFilter(mask ErrorClass) error {
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_CAN_RAW, unix.CAN_RAW_ERR_FILTER, int(mask&ErrAll))
+	if err != nil {
+		return fmt.Errorf("could not set CAN error filter: %w", err)
+	}
+
+	return nil
+}
+
+// SetFDFrames enables or disables the reception and transmission of
+// CAN FD frames. Classic CAN frames are still handled when enabled.
+func (sck *Socket) SetFDFrames(enable bool) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FD_FRAMES, v)
+	if err != nil {
+		return fmt.Errorf("could not set CAN FD frames: %w", err)
+	}
+	sck.fd = enable
+
+	return nil
+}
+
+// FDFrames reports whether CAN FD frames are enabled on the socket.
+func (sck *Socket) FDFrames() bool {
+	return sck.fd
+}
+
+// SetXLFrames enables or disables the reception and transmission of
+// CAN XL frames, supported since Linux 6.2. Enabling CAN XL frames also
+// enables CAN FD frames.
+func (sck *Socket) SetXLFrames(enable bool) error {
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_CAN_RAW, canRawXLFrames, boolInt(enable))
+	if err != nil {
+		return fmt.Errorf("could not set CAN XL frames: %w", err)
+	}
+	sck.xl = enable
+	if enable {
+		sck.fd = true
+	}
+
+	return nil
+}
+
+// XLFrames reports whether CAN XL frames are enabled on the socket.
+func (sck *Socket) XLFrames() bool {
+	return sck.xl
+}
+
 // Close closes the CAN bus socket.
+// Pending Recv and Send calls are unblocked and return an error.
 func (sck *Socket) Close() error {
-	return unix.Close(sck.dev.fd)
+	return sck.dev.Close()
+}
+
+// SetReadDeadline sets the deadline for future Recv calls and any
+// currently-blocked Recv call. A zero value for t means Recv will not
+// time out.
+func (sck *Socket) SetReadDeadline(t time.Time) error {
+	return sck.dev.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Send calls and any
+// currently-blocked Send call. A zero value for t means Send will not
+// time out.
+func (sck *Socket) SetWriteDeadline(t time.Time) error {
+	return sck.dev.SetWriteDeadline(t)
 }
 
 // Bind binds the socket on the CAN bus with the given address.
@@ -72,9 +176,127 @@ func (sck *Socket) Bind(addr string) error {
 	return unix.Bind(sck.dev.fd, sck.addr)
 }
 
+// BindAll binds the socket to all CAN interfaces. The Ifindex and Iface
+// of each received frame tell the interface it was received on; frames
+// to send need the Ifindex of the interface to send on.
+func (sck *Socket) BindAll() error {
+	sck.iface = nil
+	sck.addr = &unix.SockaddrCAN{Ifindex: 0}
+
+	return unix.Bind(sck.dev.fd, sck.addr)
+}
+
 // Send sends the provided frame on the CAN bus.
+// CAN FD frames require SetFDFrames and CAN XL frames SetXLFrames to be
+// enabled on the socket.
 func (sck *Socket) Send(msg Frame) (int, error) {
-	if len(msg.Data) > 8 {
+	if msg.IsFD() && !sck.fd {
+		return 0, errFDNotEnabled
+	}
+	if msg.IsXL() && !sck.xl {
+		return 0, errXLNotEnabled
+	}
+	frame := make([]byte, frameBufSize(msg.IsXL()))
+	n, err := encodeFrame(frame, msg)
+	if err != nil {
+		return 0, err
+	}
+	if msg.Ifindex > 0 {
+		err = sck.dev.Sendto(frame[:n], &unix.SockaddrCAN{Ifindex: msg.Ifindex})
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	return sck.dev.Write(frame[:n])
+}
+
+// Recv receives data from the CAN socket.
+// The Timestamp of the frame is the kernel receive time if available.
+func (sck *Socket) Recv() (msg Frame, err error) {
+	frame := make([]byte, frameBufSize(sck.xl))
+	oob := make([]byte, oobSize)
+	n, oobn, flags, from, err := sck.dev.Recvmsg(frame, oob)
+	if err != nil {
+		return msg, err
+	}
+
+	msg, err = decodeFrame(frame[:n])
+	if err != nil {
+		return msg, err
+	}
+	msg.Local = flags&unix.MSG_DONTROUTE != 0
+	if sa, ok := from.(*unix.SockaddrCAN); ok {
+		msg.Ifindex = sa.Ifindex
+		msg.Iface = sck.names.name(sa.Ifindex)
+	}
+	ts, drops, ok := parseControl(oob[:oobn])
+	if ok {
+		sck.drops.Store(drops)
+	}
+	msg.Timestamp = ts
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg, nil
+}
+
+// Dropped returns the number of frames the kernel dropped because the
+// socket receive queue was full, as of the last received frame.
+func (sck *Socket) Dropped() uint32 {
+	return sck.drops.Load()
+}
+
+// SetRecvBuffer sets the size of the socket receive buffer in bytes.
+// SO_RCVBUFFORCE is used to exceed the system limit if permitted.
+func (sck *Socket) SetRecvBuffer(size int) error {
+	err := unix.SetsockoptInt(sck.dev.fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, size)
+	if err == nil {
+		return nil
+	}
+	err = unix.SetsockoptInt(sck.dev.fd, unix.SOL_SOCKET, unix.SO_RCVBUF, size)
+	if err != nil {
+		return fmt.Errorf("could not set receive buffer: %w", err)
+	}
+	return nil
+}
+
+// RecvContext receives data from the CAN socket like Recv. A pending
+// receive is stopped and ctx.Err() returned when ctx is done.
+func (sck *Socket) RecvContext(ctx context.Context) (msg Frame, err error) {
+	err = sck.dev.withContext(ctx, func() error {
+		msg, err = sck.Recv()
+		return err
+	})
+	return msg, err
+}
+
+// frameBufSize returns the buffer size for a can_frame or canfd_frame,
+// or for a canxl_frame if xl is set.
+func frameBufSize(xl bool) int {
+	if xl {
+		return xlFrameSize
+	}
+	return int(fdFrameSize)
+}
+
+// encodeFrame writes msg into buf as a can_frame, canfd_frame or
+// canxl_frame and returns the number of bytes used.
+func encodeFrame(buf []byte, msg Frame) (int, error) {
+	if msg.IsXL() {
+		return encodeXLFrame(buf, msg)
+	}
+	size := int(frameSize)
+	if msg.IsFD() {
+		if len(msg.Data) > MaxFDDataLen {
+			return 0, errDataTooBig
+		}
+		if msg.Kind != SFF && msg.Kind != EFF {
+			return 0, errInvalidFDKind
+		}
+		size = int(fdFrameSize)
+	} else if len(msg.Data) > MaxDataLen {
 		return 0, errDataTooBig
 	}
 	switch msg.Kind {
@@ -95,24 +317,74 @@ func (sck *Socket) Send(msg Frame) (int, error) {
 		msg.ID |= unix.CAN_ERR_FLAG
 	}
 
-	var frame [frameSize]byte
+	if len(buf) < size {
+		return 0, io.ErrShortBuffer
+	}
+	frame := buf[:size]
+	clear(frame)
 	binary.LittleEndian.PutUint32(frame[:4], msg.ID)
-	frame[4] = byte(len(msg.Data))
+	if size == int(fdFrameSize) {
+		frame[4] = byte(FDLen(len(msg.Data)))
+		frame[5] = byte((msg.Flags | FDF) & (BRS | ESI | FDF))
+	} else {
+		frame[4] = byte(len(msg.Data))
+	}
 	copy(frame[8:], msg.Data)
 
-	return sck.dev.Write(frame[:])
+	return size, nil
 }
 
-// Recv receives data from the CAN socket.
-func (sck *Socket) Recv() (msg Frame, err error) {
-	var frame [frameSize]byte
-	n, err := io.ReadFull(sck.dev, frame[:])
-	if err != nil {
-		return msg, err
+// encodeXLFrame writes msg into buf as a canxl_frame of variable length
+// and returns the number of bytes used.
+func encodeXLFrame(buf []byte, msg Frame) (int, error) {
+	if msg.Kind != SFF || len(msg.Data) == 0 {
+		return 0, errInvalidXL
+	}
+	if len(msg.Data) > MaxXLDataLen {
+		return 0, errDataTooBig
+	}
+	size := xlHeaderSize + len(msg.Data)
+	if len(buf) < size {
+		return 0, io.ErrShortBuffer
 	}
 
-	if n != len(frame) {
-		return msg, io.ErrUnexpectedEOF
+	frame := buf[:size]
+	prio := msg.ID&unix.CAN_SFF_MASK | uint32(msg.VCID)<<canXLVCIDOffset
+	binary.LittleEndian.PutUint32(frame[:4], prio)
+	frame[4] = byte(msg.Flags&(SEC|RRS) | XLF)
+	frame[5] = msg.SDT
+	binary.LittleEndian.PutUint16(frame[6:8], uint16(len(msg.Data)))
+	binary.LittleEndian.PutUint32(frame[8:12], msg.AF)
+	copy(frame[xlHeaderSize:], msg.Data)
+
+	return size, nil
+}
+
+// decodeFrame parses a can_frame, canfd_frame or canxl_frame from buf.
+func decodeFrame(frame []byte) (msg Frame, err error) {
+	err = decodeFrameInto(&msg, frame, nil)
+	return msg, err
+}
+
+// decodeFrameInto parses a can_frame, canfd_frame or canxl_frame into
+// msg. The payload is copied into buf if its capacity is large enough,
+// otherwise a new slice is allocated.
+func decodeFrameInto(msg *Frame, frame []byte, buf []byte) error {
+	var maxLen byte
+	msg.Flags = 0
+	msg.SDT, msg.VCID, msg.AF = 0, 0, 0
+	// the len field of can_frame and canfd_frame never has the XLF bit
+	if len(frame) >= xlHeaderSize && Flags(frame[4])&XLF != 0 {
+		return decodeXLFrameInto(msg, frame, buf)
+	}
+	switch len(frame) {
+	case int(frameSize):
+		maxLen = MaxDataLen
+	case int(fdFrameSize):
+		maxLen = MaxFDDataLen
+		msg.Flags = Flags(frame[5])&(BRS|ESI) | FDF
+	default:
+		return io.ErrUnexpectedEOF
 	}
 
 	msg.ID = binary.LittleEndian.Uint32(frame[:4])
@@ -136,19 +408,48 @@ func (sck *Socket) Recv() (msg Frame, err error) {
 		msg.ID &= unix.CAN_SFF_MASK
 	}
 
-	msg.Data = make([]byte, frame[4])
+	length := int(min(frame[4], maxLen))
+	if buf == nil || cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	msg.Data = buf[:length]
 	copy(msg.Data, frame[8:])
-	return msg, nil
+	return nil
 }
 
-type device struct {
-	fd int
+// decodeXLFrameInto parses a canxl_frame into msg like decodeFrameInto.
+func decodeXLFrameInto(msg *Frame, frame []byte, buf []byte) error {
+	length := int(binary.LittleEndian.Uint16(frame[6:8]))
+	if length > MaxXLDataLen || xlHeaderSize+length > len(frame) {
+		return io.ErrUnexpectedEOF
+	}
+	prio := binary.LittleEndian.Uint32(frame[:4])
+	msg.Kind = SFF
+	msg.ID = prio & unix.CAN_SFF_MASK
+	msg.VCID = uint8(prio >> canXLVCIDOffset)
+	msg.Flags = Flags(frame[4]) & (SEC | RRS | XLF)
+	msg.SDT = frame[5]
+	msg.AF = binary.LittleEndian.Uint32(frame[8:12])
+
+	if buf == nil || cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	msg.Data = buf[:length]
+	copy(msg.Data, frame[xlHeaderSize:])
+	return nil
 }
 
-func (d device) Read(data []byte) (int, error) {
-	return unix.Read(d.fd, data)
+// rawCanID returns the can_id with the EFF and RTR flags for the kind.
+func rawCanID(id uint32, kind Kind) uint32 {
+	var frame [frameSize]byte
+	encodeFrame(frame[:], Frame{ID: id, Kind: kind})
+	return binary.LittleEndian.Uint32(frame[:4])
 }
 
-func (d device) Write(data []byte) (int, error) {
-	return unix.Write(d.fd, data)
+// splitCanID returns the ID and kind of the can_id.
+func splitCanID(canID uint32) (uint32, Kind) {
+	var frame [frameSize]byte
+	binary.LittleEndian.PutUint32(frame[:4], canID)
+	msg, _ := decodeFrame(frame[:])
+	return msg.ID, msg.Kind
 }
@@ -0,0 +1,150 @@
+package canbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// newSocketPair returns two connected sockets exchanging datagrams like
+// a CAN_RAW socket, so the tests run without the vcan module.
+func newSocketPair(t testing.TB) (*Socket, *Socket) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sck [2]*Socket
+	for i, fd := range fds {
+		_ = enableTimestamps(fd)
+		sck[i], err = newSocket(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sck[i].fd = true
+		s := sck[i]
+		t.Cleanup(func() { s.Close() })
+	}
+	return sck[0], sck[1]
+}
+
+func TestSendRecv(t *testing.T) {
+	tx, rx := newSocketPair(t)
+
+	frames := []Frame{
+		{ID: 0x123, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}, Kind: SFF},
+		{ID: 0x1F334455, Data: []byte{}, Kind: EFF},
+		{ID: 0x7FF, Data: make([]byte, 2), Kind: RTR_SFF},
+		{ID: 0x1234, Data: bytes.Repeat([]byte{0x55}, 12), Kind: EFF, Flags: BRS},
+	}
+	for _, want := range frames {
+		if _, err := tx.Send(want); err != nil {
+			t.Fatalf("send %v: %v", want, err)
+		}
+		got, err := rx.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if got.ID != want.ID || got.Kind != want.Kind || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		if want.IsFD() && got.Flags != want.Flags|FDF {
+			t.Errorf("flags = %v, want %v", got.Flags, want.Flags|FDF)
+		}
+		if got.Timestamp.IsZero() {
+			t.Errorf("missing timestamp")
+		}
+	}
+}
+
+func TestSendRecvXL(t *testing.T) {
+	tx, rx := newSocketPair(t)
+	if _, err := tx.Send(Frame{ID: 0x42, Data: []byte{1}, Flags: XLF}); err != errXLNotEnabled {
+		t.Fatalf("err = %v, want %v", err, errXLNotEnabled)
+	}
+	tx.xl, rx.xl = true, true
+
+	want := Frame{ID: 0x42, Data: bytes.Repeat([]byte{0x5A}, MaxXLDataLen), Flags: XLF | SEC, SDT: 0x03, VCID: 0x17, AF: 0xCAFEF00D}
+	n, err := tx.Send(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != xlFrameSize {
+		t.Errorf("sent %d bytes, want %d", n, xlFrameSize)
+	}
+	tx.Send(Frame{ID: 0x43, Data: []byte{1, 2}})
+	got, err := rx.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || got.Flags != want.Flags || got.SDT != want.SDT || got.VCID != want.VCID ||
+		got.AF != want.AF || !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	// classic frames still decode on a CAN XL socket
+	got, err = rx.Recv()
+	if err != nil || got.ID != 0x43 || got.IsXL() || len(got.Data) != 2 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestRecvContext(t *testing.T) {
+	tx, rx := newSocketPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := rx.RecvContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the socket is still usable after the cancellation
+	if _, err := tx.Send(Frame{ID: 0x42, Data: []byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := rx.RecvContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 0x42 {
+		t.Errorf("id = %X, want 42", msg.ID)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	_, rx := newSocketPair(t)
+
+	if err := rx.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := rx.Recv()
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+func TestCloseUnblocksRecv(t *testing.T) {
+	_, rx := newSocketPair(t)
+
+	errc := make(chan error)
+	go func() {
+		_, err := rx.Recv()
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	rx.Close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("err = %v, want %v", err, os.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Recv not unblocked by Close")
+	}
+}
@@ -0,0 +1,344 @@
+package canbus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SocketCANDPort is the default TCP port of socketcand.
+const SocketCANDPort = 29536
+
+// socketcandTimeout limits the connection setup and the command replies.
+var socketcandTimeout = 5 * time.Second
+
+var (
+	errSocketCANDFrame = errors.New("canbus: invalid socketcand frame")
+	errSocketCANDKind  = errors.New("canbus: remote request, CAN XL and error frames not supported by socketcand")
+	errSocketCANDEcho  = fmt.Errorf("canbus: no echo reply of socketcand: %w", syscall.ETIMEDOUT)
+)
+
+// SocketCAND is a CAN interface of a remote host running socketcand,
+// connected over TCP in the raw mode of the socketcand protocol. Filters
+// are applied to the received frames in userspace.
+type SocketCAND struct {
+	*recvQueue
+	name    string
+	conn    net.Conn
+	replies chan []string
+	once    sync.Once
+	cmdMu   sync.Mutex // one command at a time
+	wmu     sync.Mutex // one message at a time
+	noEcho  atomic.Bool
+}
+
+// DialSocketCAND connects to socketcand at addr, host:port, and opens
+// the interface iface of the remote host in raw mode.
+func DialSocketCAND(addr, iface string) (*SocketCAND, error) {
+	conn, err := net.DialTimeout("tcp", addr, socketcandTimeout)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SocketCAND{
+		recvQueue: newRecvQueue(),
+		name:      addr + "/" + iface,
+		conn:      conn,
+		replies:   make(chan []string, 16),
+	}
+	go sc.read()
+
+	err = sc.expect("hi")
+	if err == nil {
+		_, err = sc.command("open " + iface)
+	}
+	if err == nil {
+		_, err = sc.command("rawmode")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("canbus: socketcand %s: %w", sc.name, err)
+	}
+	return sc, nil
+}
+
+// Name returns the address and the remote interface, host:port/iface.
+func (sc *SocketCAND) Name() string {
+	return sc.name
+}
+
+// Echo sends an echo request and waits for the reply of the server.
+// Without reply the connection is considered lost and closed, the
+// receives fail with an error wrapping syscall.ETIMEDOUT.
+func (sc *SocketCAND) Echo() error {
+	_, err := sc.command("echo")
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		sc.noEcho.Store(true)
+		sc.conn.Close()
+		return errSocketCANDEcho
+	}
+	return err
+}
+
+// Send sends the frame on the remote interface. socketcand does not
+// confirm sent frames.
+func (sc *SocketCAND) Send(msg Frame) (int, error) {
+	text, err := formatSocketCANDSend(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sc.write(text)
+}
+
+// write sends a message, the text between the angle brackets.
+func (sc *SocketCAND) write(text string) (int, error) {
+	select {
+	case <-sc.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	return sc.conn.Write([]byte("< " + text + " >"))
+}
+
+// command sends a command and returns the fields of the reply, an error
+// for an error reply of the server.
+func (sc *SocketCAND) command(text string) ([]string, error) {
+	sc.cmdMu.Lock()
+	defer sc.cmdMu.Unlock()
+	// replies of timed out commands
+	for len(sc.replies) > 0 {
+		<-sc.replies
+	}
+	_, err := sc.write(text)
+	if err != nil {
+		return nil, err
+	}
+	return sc.reply(text)
+}
+
+// expect waits for the message the server sends unrequested.
+func (sc *SocketCAND) expect(text string) error {
+	sc.cmdMu.Lock()
+	defer sc.cmdMu.Unlock()
+	reply, err := sc.reply(text)
+	if err == nil && reply[0] != text {
+		err = fmt.Errorf("unexpected reply %q to %q", strings.Join(reply, " "), text)
+	}
+	return err
+}
+
+func (sc *SocketCAND) reply(text string) ([]string, error) {
+	timer := time.NewTimer(socketcandTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-sc.replies:
+		if reply[0] == "error" {
+			return nil, fmt.Errorf("%q: %s", text, strings.Join(reply[1:], " "))
+		}
+		return reply, nil
+	case <-sc.done:
+		return nil, sc.readErr
+	case <-timer.C:
+		return nil, fmt.Errorf("no reply to %q: %w", text, os.ErrDeadlineExceeded)
+	}
+}
+
+// read splits the received data into frames and command replies until
+// the connection is closed or fails.
+func (sc *SocketCAND) read() {
+	r := bufio.NewReader(sc.conn)
+	for {
+		msg, err := r.ReadString('>')
+		if err != nil {
+			if sc.noEcho.Load() {
+				err = errSocketCANDEcho
+			}
+			sc.stop(err)
+			return
+		}
+		start := strings.LastIndexByte(msg, '<')
+		if start < 0 {
+			continue
+		}
+		fields := strings.Fields(msg[start+1 : len(msg)-1])
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "frame", "fdframe":
+			frame, err := parseSocketCANDFrame(fields)
+			if err != nil {
+				continue
+			}
+			frame.Iface = sc.name
+			sc.push(frame)
+		case "error":
+			// an error frame in rawmode, otherwise the reply to a command
+			frame, err := parseSocketCANDError(fields)
+			if err == nil {
+				frame.Iface = sc.name
+				sc.push(frame)
+				continue
+			}
+			select {
+			case sc.replies <- fields:
+			default:
+			}
+		case "hi", "ok", "echo":
+			select {
+			case sc.replies <- fields:
+			default:
+			}
+		}
+	}
+}
+
+// Close closes the connection and unblocks pending receives.
+func (sc *SocketCAND) Close() error {
+	err := os.ErrClosed
+	sc.once.Do(func() {
+		close(sc.closed)
+		err = sc.conn.Close()
+	})
+	return err
+}
+
+// parseSocketCANDFrame parses the fields of the messages
+// "frame id secs.usecs data" and "fdframe id secs.usecs flags data". IDs
+// with 8 hex digits are extended IDs. The data is in hex, the bytes
+// separated by spaces or not.
+func parseSocketCANDFrame(fields []string) (msg Frame, err error) {
+	fd := fields[0] == "fdframe"
+	n := 3
+	if fd {
+		n = 4
+	}
+	if len(fields) < n {
+		return msg, errSocketCANDFrame
+	}
+	id, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return msg, errSocketCANDFrame
+	}
+	msg.ID = uint32(id)
+	msg.Kind = SFF
+	if len(fields[1]) == 8 {
+		msg.Kind = EFF
+	}
+	if msg.Kind == SFF && msg.ID > unix.CAN_SFF_MASK || msg.ID > unix.CAN_EFF_MASK {
+		return msg, errSocketCANDFrame
+	}
+	msg.Timestamp = parseSocketCANDTime(fields[2])
+	if fd {
+		flags, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return msg, errSocketCANDFrame
+		}
+		msg.Flags = Flags(flags)&(BRS|ESI) | FDF
+	}
+	data := strings.Join(fields[n:], "")
+	if len(data)%2 != 0 {
+		return msg, errSocketCANDFrame
+	}
+	msg.Data = make([]byte, len(data)/2)
+	for i := range msg.Data {
+		hi, lo := unhex(data[2*i]), unhex(data[2*i+1])
+		if hi < 0 || lo < 0 {
+			return msg, errSocketCANDFrame
+		}
+		msg.Data[i] = byte(hi<<4 | lo)
+	}
+	if !fd && len(msg.Data) > MaxDataLen || len(msg.Data) > MaxFDDataLen {
+		return msg, errSocketCANDFrame
+	}
+	return msg, nil
+}
+
+// parseSocketCANDError parses the fields of the error frame message
+// "error class secs.usecs". The class is the can_id without CAN_ERR_FLAG,
+// the data bytes are not sent.
+func parseSocketCANDError(fields []string) (msg Frame, err error) {
+	if len(fields) != 3 {
+		return msg, errSocketCANDFrame
+	}
+	class, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil || class > unix.CAN_ERR_MASK {
+		return msg, errSocketCANDFrame
+	}
+	secs, usecs, ok := strings.Cut(fields[2], ".")
+	if _, err := strconv.ParseUint(secs, 10, 64); err != nil || !ok {
+		return msg, errSocketCANDFrame
+	}
+	if _, err := strconv.ParseUint(usecs, 10, 64); err != nil {
+		return msg, errSocketCANDFrame
+	}
+	msg.ID = uint32(class)
+	msg.Kind = ERR
+	msg.Data = []byte{}
+	msg.Timestamp = parseSocketCANDTime(fields[2])
+	return msg, nil
+}
+
+// parseSocketCANDTime parses the receive time secs.usecs of the server,
+// the local time if invalid.
+func parseSocketCANDTime(s string) time.Time {
+	secs, usecs, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	usec, err := strconv.ParseInt(usecs, 10, 64)
+	if err != nil && usecs != "" {
+		return time.Now()
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond))
+}
+
+// formatSocketCANDSend returns the message "send id dlc data" of a
+// classic frame and "fdsend id flags data" of a CAN FD frame, with
+// extended IDs of 8 hex digits.
+func formatSocketCANDSend(msg Frame) (string, error) {
+	if msg.Kind != SFF && msg.Kind != EFF || msg.IsXL() {
+		return "", errSocketCANDKind
+	}
+	fd := msg.IsFD()
+	if fd && len(msg.Data) > MaxFDDataLen || !fd && len(msg.Data) > MaxDataLen {
+		return "", errDataTooBig
+	}
+	var b []byte
+	if fd {
+		b = append(b, "fdsend "...)
+	} else {
+		b = append(b, "send "...)
+	}
+	if msg.Kind == SFF {
+		b = appendHex(b, msg.ID&unix.CAN_SFF_MASK, 3)
+	} else {
+		b = appendHex(b, msg.ID&unix.CAN_EFF_MASK, 8)
+	}
+	data := msg.Data
+	if fd {
+		data = make([]byte, FDLen(len(msg.Data)))
+		copy(data, msg.Data)
+		b = append(b, ' ')
+		b = appendHex(b, uint32(msg.Flags&(BRS|ESI)), 1)
+	} else {
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, int64(len(data)), 10)
+	}
+	for _, v := range data {
+		b = append(b, ' ', hexDigits[v>>4], hexDigits[v&0x0F])
+	}
+	return string(b), nil
+}
@@ -0,0 +1,214 @@
+package canbus
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// socketcandServer is a fake socketcand serving one connection.
+type socketcandServer struct {
+	ln   net.Listener
+	conn chan net.Conn
+	msgs chan string // messages of the client
+	mute atomic.Bool // no echo replies
+}
+
+func newSocketCANDServer(t *testing.T, iface string) *socketcandServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no TCP: %v", err)
+	}
+	srv := &socketcandServer{ln: ln, conn: make(chan net.Conn, 1), msgs: make(chan string, 100)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.conn <- conn
+		io.WriteString(conn, "< hi >")
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString('>')
+			if err != nil {
+				return
+			}
+			msg = strings.TrimSpace(msg)
+			switch {
+			case msg == "< open "+iface+" >", msg == "< rawmode >":
+				io.WriteString(conn, "< ok >")
+			case strings.HasPrefix(msg, "< open "):
+				io.WriteString(conn, "< error could not open bus >")
+			case msg == "< echo >" && !srv.mute.Load():
+				io.WriteString(conn, "< echo >")
+			default:
+				srv.msgs <- msg
+			}
+		}
+	}()
+	return srv
+}
+
+func TestSocketCAND(t *testing.T) {
+	srv := newSocketCANDServer(t, "can0")
+	sc, err := DialSocketCAND(srv.ln.Addr().String(), "can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	conn := <-srv.conn
+	if err := sc.Echo(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []Frame{
+		{ID: 0x123, Data: []byte{0x11, 0x22, 0x33}},
+		{ID: 0x1ABCDEF0, Kind: EFF, Data: []byte{}},
+		{ID: 0x42, Flags: FDF | BRS, Data: bytes.Repeat([]byte{0xA5}, 10)},
+	}
+	want := []string{
+		"< send 123 3 11 22 33 >",
+		"< send 1ABCDEF0 0 >",
+		"< fdsend 042 1" + strings.Repeat(" A5", 10) + strings.Repeat(" 00", 2) + " >",
+	}
+	for i, f := range frames {
+		if _, err := sc.Send(f); err != nil {
+			t.Fatal(err)
+		}
+		if msg := <-srv.msgs; msg != want[i] {
+			t.Errorf("sent %q, want %q", msg, want[i])
+		}
+	}
+	if _, err := sc.Send(Frame{ID: 0x1, Kind: RTR_SFF}); err == nil {
+		t.Error("remote request sent")
+	}
+
+	// frames with the data bytes separated or not, an invalid frame and
+	// an unknown message
+	io.WriteString(conn, "< frame 123 1700000000.123456 112233 >< frame 12G 1.0 >"+
+		"< frame 1ABCDEF0 1700000001.000001 >< status 1 >\n< fdframe 042 1700000002.5 1 "+
+		strings.Repeat("A5 ", 10)+"00 00 >")
+	for i, f := range frames {
+		got, err := sc.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != f.ID || got.Kind != f.Kind || got.Flags != f.Flags || got.Iface != sc.Name() {
+			t.Errorf("got %+v, want %+v", got, f)
+		}
+		if i < 2 && !bytes.Equal(got.Data, f.Data) || i == 2 && len(got.Data) != 12 {
+			t.Errorf("data % X, want % X", got.Data, f.Data)
+		}
+	}
+	ts := time.Unix(1700000000, 123456000)
+
+	// filters in userspace
+	sc.SetFilterSet(FilterSet{Filters: []Filter{ExactID(0x200, SFFOnly)}})
+	io.WriteString(conn, "< frame 100 1700000000.123456 >< frame 200 1700000000.123456 AA >")
+	if got, err := sc.Recv(); err != nil || got.ID != 0x200 || !got.Timestamp.Equal(ts) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	// the server closes the connection
+	conn.Close()
+	if _, err := sc.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("err = %v, want %v", err, io.EOF)
+	}
+	if err := sc.Echo(); err == nil {
+		t.Error("echo after EOF")
+	}
+}
+
+func TestSocketCANDErrorFrame(t *testing.T) {
+	srv := newSocketCANDServer(t, "can0")
+	sc, err := DialSocketCAND(srv.ln.Addr().String(), "can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	conn := <-srv.conn
+
+	// an error frame before the reply is not taken as reply
+	srv.mute.Store(true)
+	errc := make(chan error, 1)
+	go func() { errc <- sc.Echo() }()
+	if msg := <-srv.msgs; msg != "< echo >" {
+		t.Fatalf("sent %q", msg)
+	}
+	io.WriteString(conn, "< error 040 1700000000.000100 >< echo >")
+	if err := <-errc; err != nil {
+		t.Errorf("echo: %v", err)
+	}
+	got, err := sc.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 0x040 || got.Kind != ERR || got.Iface != sc.Name() || !got.Timestamp.Equal(time.Unix(1700000000, 100000)) {
+		t.Errorf("got %+v", got)
+	}
+	if info := DecodeError(got); info.Class != ErrBusOff {
+		t.Errorf("class %v, want %v", info.Class, ErrBusOff)
+	}
+
+	// a command error with text is a reply
+	go func() { errc <- sc.Echo() }()
+	<-srv.msgs
+	io.WriteString(conn, "< error unknown command >")
+	if err := <-errc; err == nil {
+		t.Error("echo: no error")
+	}
+}
+
+func TestSocketCANDOpen(t *testing.T) {
+	srv := newSocketCANDServer(t, "can0")
+	if _, err := DialSocketCAND(srv.ln.Addr().String(), "can1"); err == nil || !strings.Contains(err.Error(), "could not open bus") {
+		t.Errorf("err = %v", err)
+	}
+
+	srv = newSocketCANDServer(t, "can0")
+	sc, err := DialSocketCAND(srv.ln.Addr().String(), "can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := sc.Recv(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	sc.Close()
+	if _, err := sc.Recv(); !errors.Is(err, os.ErrClosed) && !errors.Is(err, net.ErrClosed) {
+		t.Errorf("err = %v after close", err)
+	}
+	if _, err := sc.Send(Frame{ID: 1}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("send err = %v after close", err)
+	}
+}
+
+func TestSocketCANDEchoTimeout(t *testing.T) {
+	defer func(d time.Duration) { socketcandTimeout = d }(socketcandTimeout)
+	srv := newSocketCANDServer(t, "can0")
+	sc, err := DialSocketCAND(srv.ln.Addr().String(), "can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	// the server stops answering, the connection is closed
+	socketcandTimeout = 50 * time.Millisecond
+	srv.mute.Store(true)
+	if err := sc.Echo(); !errors.Is(err, syscall.ETIMEDOUT) {
+		t.Errorf("echo err = %v, want %v", err, syscall.ETIMEDOUT)
+	}
+	if _, err := sc.Recv(); !errors.Is(err, syscall.ETIMEDOUT) {
+		t.Errorf("recv err = %v, want %v", err, syscall.ETIMEDOUT)
+	}
+}
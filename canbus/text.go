@@ -0,0 +1,350 @@
+package canbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// The text format of a frame is the notation of the can-utils tools
+// cansend and candump:
+//
+//	123#DEADBEEF        standard frame, 3 hex digits ID
+//	1F334455#11.22      extended frame, 8 hex digits ID, optional dots
+//	123#R  123#R4       remote request, optional length
+//	20000004#0004...    error frame, ID with the CAN_ERR_FLAG
+//	123##1DEADBEEF      CAN FD frame, flags nibble (BRS=1, ESI=2) and data
+//	45123#81:00:12345678#11223344
+//	                    CAN XL frame, VCID and priority, flags, SDU type,
+//	                    acceptance field and data
+
+const hexDigits = "0123456789ABCDEF"
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Frame) MarshalText() ([]byte, error) {
+	return f.AppendText(nil)
+}
+
+// AppendText appends the text format of the frame to b.
+func (f Frame) AppendText(b []byte) ([]byte, error) {
+	if f.IsXL() {
+		return f.appendXLText(b)
+	}
+	fd := f.IsFD()
+	maxLen := MaxDataLen
+	if fd {
+		maxLen = MaxFDDataLen
+		if f.Kind != SFF && f.Kind != EFF {
+			return b, errInvalidFDKind
+		}
+	}
+	if len(f.Data) > maxLen {
+		return b, errDataTooBig
+	}
+
+	switch f.Kind {
+	case SFF, RTR_SFF:
+		b = appendHex(b, f.ID&unix.CAN_SFF_MASK, 3)
+	case EFF, RTR_EFF:
+		b = appendHex(b, f.ID&unix.CAN_EFF_MASK, 8)
+	case ERR:
+		b = appendHex(b, f.ID&unix.CAN_ERR_MASK|unix.CAN_ERR_FLAG, 8)
+	default:
+		return b, fmt.Errorf("canbus: invalid frame kind %d", f.Kind)
+	}
+	b = append(b, '#')
+
+	switch {
+	case f.Kind == RTR_SFF || f.Kind == RTR_EFF:
+		b = append(b, 'R')
+		if len(f.Data) > 0 {
+			b = append(b, hexDigits[len(f.Data)])
+		}
+		return b, nil
+	case fd:
+		b = append(b, '#', hexDigits[f.Flags&(BRS|ESI)])
+	}
+	return appendHexData(b, f.Data), nil
+}
+
+// appendXLText appends the text format of a CAN XL frame to b.
+func (f Frame) appendXLText(b []byte) ([]byte, error) {
+	if f.Kind != SFF || len(f.Data) == 0 {
+		return b, errInvalidXL
+	}
+	if len(f.Data) > MaxXLDataLen {
+		return b, errDataTooBig
+	}
+	b = appendHex(b, uint32(f.VCID), 2)
+	b = appendHex(b, f.ID&unix.CAN_SFF_MASK, 3)
+	b = append(b, '#')
+	b = appendHex(b, uint32(f.Flags&(SEC|RRS)|XLF), 2)
+	b = append(b, ':')
+	b = appendHex(b, uint32(f.SDT), 2)
+	b = append(b, ':')
+	b = appendHex(b, f.AF, 8)
+	b = append(b, '#')
+	return appendHexData(b, f.Data), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Timestamp, Ifindex
+// and Iface of the frame are reset.
+func (f *Frame) UnmarshalText(text []byte) error {
+	msg, err := ParseFrame(string(text))
+	if err != nil {
+		return err
+	}
+	*f = msg
+	return nil
+}
+
+// ParseFrame parses a frame in the text format of cansend.
+func ParseFrame(s string) (Frame, error) {
+	var msg Frame
+	id, data, ok := strings.Cut(s, "#")
+	if !ok {
+		return msg, fmt.Errorf("canbus: missing '#' in frame %q", s)
+	}
+	v, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return msg, fmt.Errorf("canbus: invalid CAN ID in frame %q", s)
+	}
+	msg.ID = uint32(v)
+	switch len(id) {
+	case 5:
+		return parseXLFrame(s, msg.ID, data)
+	case 3:
+		if msg.ID > unix.CAN_SFF_MASK {
+			return msg, fmt.Errorf("canbus: invalid CAN ID in frame %q", s)
+		}
+		msg.Kind = SFF
+	case 8:
+		switch {
+		case msg.ID&unix.CAN_ERR_FLAG != 0 && msg.ID&unix.CAN_EFF_FLAG == 0:
+			msg.Kind = ERR
+			msg.ID &= unix.CAN_ERR_MASK
+		case msg.ID&^unix.CAN_EFF_MASK != 0:
+			return msg, fmt.Errorf("canbus: invalid CAN ID in frame %q", s)
+		default:
+			msg.Kind = EFF
+		}
+	default:
+		return msg, fmt.Errorf("canbus: CAN ID in frame %q needs 3, 5 or 8 hex digits", s)
+	}
+
+	maxLen := MaxDataLen
+	switch {
+	case strings.HasPrefix(data, "R") && msg.Kind != ERR:
+		msg.Kind += RTR_SFF - SFF
+		switch len(data) {
+		case 1:
+			msg.Data = []byte{}
+		case 2:
+			if data[1] < '0' || data[1] > '8' {
+				return msg, fmt.Errorf("canbus: invalid RTR length in frame %q", s)
+			}
+			msg.Data = make([]byte, data[1]-'0')
+		default:
+			return msg, fmt.Errorf("canbus: invalid RTR frame %q", s)
+		}
+		return msg, nil
+	case strings.HasPrefix(data, "#") && msg.Kind != ERR:
+		if len(data) < 2 {
+			return msg, fmt.Errorf("canbus: missing CAN FD flags in frame %q", s)
+		}
+		flags := unhex(data[1])
+		if flags < 0 || Flags(flags)&^(BRS|ESI|FDF) != 0 {
+			return msg, fmt.Errorf("canbus: invalid CAN FD flags in frame %q", s)
+		}
+		msg.Flags = Flags(flags) | FDF
+		maxLen = MaxFDDataLen
+		data = data[2:]
+	}
+
+	msg.Data, err = parseHexData(s, data)
+	if err != nil {
+		return msg, err
+	}
+	if len(msg.Data) > maxLen {
+		return msg, errDataTooBig
+	}
+	if msg.IsFD() && len(msg.Data) != FDLen(len(msg.Data)) {
+		return msg, fmt.Errorf("canbus: invalid CAN FD data length %d in frame %q", len(msg.Data), s)
+	}
+	return msg, nil
+}
+
+// parseXLFrame parses the header fields and data of a CAN XL frame;
+// id holds the VCID and the priority.
+func parseXLFrame(s string, id uint32, text string) (Frame, error) {
+	msg := Frame{
+		ID:   id & unix.CAN_SFF_MASK,
+		VCID: uint8(id >> 12),
+		Kind: SFF,
+	}
+	if id&0x800 != 0 {
+		return msg, fmt.Errorf("canbus: invalid CAN XL priority in frame %q", s)
+	}
+	head, data, ok := strings.Cut(text, "#")
+	fields := strings.Split(head, ":")
+	if !ok || len(fields) != 3 || len(fields[0]) != 2 || len(fields[1]) != 2 || len(fields[2]) != 8 {
+		return msg, fmt.Errorf("canbus: invalid CAN XL header in frame %q", s)
+	}
+	var vals [3]uint64
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return msg, fmt.Errorf("canbus: invalid CAN XL header in frame %q", s)
+		}
+		vals[i] = v
+	}
+	msg.Flags = Flags(vals[0])&(SEC|RRS) | XLF
+	msg.SDT = uint8(vals[1])
+	msg.AF = uint32(vals[2])
+	if Flags(vals[0])&XLF == 0 {
+		return msg, fmt.Errorf("canbus: missing XLF flag in frame %q", s)
+	}
+
+	var err error
+	msg.Data, err = parseHexData(s, data)
+	if err != nil {
+		return msg, err
+	}
+	if len(msg.Data) == 0 {
+		return msg, errInvalidXL
+	}
+	if len(msg.Data) > MaxXLDataLen {
+		return msg, errDataTooBig
+	}
+	return msg, nil
+}
+
+// parseHexData parses hex data bytes with optional dots in between;
+// s is the whole frame for error messages.
+func parseHexData(s, data string) ([]byte, error) {
+	buf := make([]byte, 0, len(data)/2)
+	for i := 0; i < len(data); {
+		if data[i] == '.' {
+			i++
+			continue
+		}
+		if i+1 >= len(data) {
+			return nil, fmt.Errorf("canbus: odd number of data digits in frame %q", s)
+		}
+		hi, lo := unhex(data[i]), unhex(data[i+1])
+		if hi < 0 || lo < 0 {
+			return nil, fmt.Errorf("canbus: invalid data in frame %q", s)
+		}
+		buf = append(buf, byte(hi<<4|lo))
+		i += 2
+	}
+	return buf, nil
+}
+
+// FormatLog returns the frame as a line of a candump log file, without
+// the trailing newline:
+//
+//	(1700000000.123456) can0 123#11
+func FormatLog(f Frame) (string, error) {
+	var sec, usec int64
+	if !f.Timestamp.IsZero() {
+		sec = f.Timestamp.Unix()
+		usec = int64(f.Timestamp.Nanosecond() / 1000)
+	}
+	iface := f.Iface
+	if iface == "" {
+		iface = AnyInterface
+	}
+	b := make([]byte, 0, 64)
+	b = fmt.Appendf(b, "(%010d.%06d) %s ", sec, usec, iface)
+	b, err := f.AppendText(b)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ParseLog parses a line of a candump log file. A trailing direction
+// field (R or T) written by newer candump versions is ignored. A zero
+// time stamp results in a zero Timestamp.
+func ParseLog(line string) (Frame, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 4 && (fields[3] == "R" || fields[3] == "T") {
+		fields = fields[:3]
+	}
+	if len(fields) != 3 {
+		return Frame{}, fmt.Errorf("canbus: invalid log line %q", line)
+	}
+	ts, err := parseLogTime(fields[0])
+	if err != nil {
+		return Frame{}, fmt.Errorf("canbus: invalid time stamp in log line %q", line)
+	}
+	msg, err := ParseFrame(fields[2])
+	if err != nil {
+		return msg, err
+	}
+	msg.Timestamp = ts
+	msg.Iface = fields[1]
+	return msg, nil
+}
+
+// parseLogTime parses a time stamp "(seconds.fraction)".
+func parseLogTime(s string) (time.Time, error) {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return time.Time{}, strconv.ErrSyntax
+	}
+	secs, frac, _ := strings.Cut(s[1:len(s)-1], ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		nsec, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil || nsec < 0 {
+			return time.Time{}, strconv.ErrSyntax
+		}
+		for i := len(frac); i < 9; i++ {
+			nsec *= 10
+		}
+	}
+	if sec == 0 && nsec == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// appendHex appends v as upper case hex number with n digits.
+func appendHex(b []byte, v uint32, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, hexDigits[(v>>(4*i))&0x0F])
+	}
+	return b
+}
+
+// appendHexData appends the data bytes as upper case hex digits.
+func appendHexData(b []byte, data []byte) []byte {
+	for _, v := range data {
+		b = append(b, hexDigits[v>>4], hexDigits[v&0x0F])
+	}
+	return b
+}
+
+// unhex returns the value of the hex digit c or -1.
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
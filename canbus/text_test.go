@@ -0,0 +1,83 @@
+package canbus
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFrameText(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want Frame
+	}{
+		{"123#DEADBEEF", Frame{ID: 0x123, Kind: SFF, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}}},
+		{"7FF#", Frame{ID: 0x7FF, Kind: SFF, Data: []byte{}}},
+		{"1F334455#1122334455667788", Frame{ID: 0x1F334455, Kind: EFF, Data: []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}}},
+		{"00000123#11", Frame{ID: 0x123, Kind: EFF, Data: []byte{0x11}}},
+		{"1F334455#R", Frame{ID: 0x1F334455, Kind: RTR_EFF, Data: []byte{}}},
+		{"123#R4", Frame{ID: 0x123, Kind: RTR_SFF, Data: make([]byte, 4)}},
+		{"20000004#0004000000000000", Frame{ID: 0x04, Kind: ERR, Data: []byte{0, 0x04, 0, 0, 0, 0, 0, 0}}},
+		{"123##1DEADBEEF", Frame{ID: 0x123, Kind: SFF, Flags: BRS | FDF, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}}},
+		{"1F334455##3" + string(bytes.Repeat([]byte("AA"), 12)), Frame{ID: 0x1F334455, Kind: EFF, Flags: BRS | ESI | FDF, Data: bytes.Repeat([]byte{0xAA}, 12)}},
+		{"45123#81:07:12345678#11223344", Frame{ID: 0x123, Kind: SFF, Flags: SEC | XLF, SDT: 0x07, VCID: 0x45, AF: 0x12345678, Data: []byte{0x11, 0x22, 0x33, 0x44}}},
+	} {
+		var got Frame
+		if err := got.UnmarshalText([]byte(tc.text)); err != nil {
+			t.Errorf("unmarshal %q: %v", tc.text, err)
+			continue
+		}
+		if got.ID != tc.want.ID || got.Kind != tc.want.Kind || got.Flags != tc.want.Flags || !bytes.Equal(got.Data, tc.want.Data) ||
+			got.SDT != tc.want.SDT || got.VCID != tc.want.VCID || got.AF != tc.want.AF {
+			t.Errorf("unmarshal %q = %+v, want %+v", tc.text, got, tc.want)
+		}
+		text, err := tc.want.MarshalText()
+		if err != nil || string(text) != tc.text {
+			t.Errorf("marshal %+v = %q, %v, want %q", tc.want, text, err, tc.text)
+		}
+	}
+
+	// accepted input notation not produced by MarshalText
+	if msg, err := ParseFrame("123#de.ad.be.ef"); err != nil || !bytes.Equal(msg.Data, []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("dotted data: %+v, %v", msg, err)
+	}
+
+	for _, text := range []string{
+		"", "123", "12#11", "800#11", "123#1", "123#XY", "123#112233445566778899",
+		"123#R9", "20000004#R", "123##", "123##8", "123##1112233445566778899", "40000123#11",
+		"45823#80:00:00000000#11", "45123#00:00:00000000#11", "45123#80:00:00000000#", "45123#80:00#11",
+	} {
+		if msg, err := ParseFrame(text); err == nil {
+			t.Errorf("parse %q = %+v, want error", text, msg)
+		}
+	}
+}
+
+func TestLogLine(t *testing.T) {
+	msg := Frame{
+		ID:        0x123,
+		Kind:      SFF,
+		Data:      []byte{0x11},
+		Timestamp: time.Unix(1700000000, 123456000),
+		Iface:     "can0",
+	}
+	line, err := FormatLog(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(1700000000.123456) can0 123#11"; line != want {
+		t.Errorf("format = %q, want %q", line, want)
+	}
+	for _, line := range []string{line, line + " R", "(1700000000.123456000) can0 123#11"} {
+		got, err := ParseLog(line)
+		if err != nil {
+			t.Fatalf("parse %q: %v", line, err)
+		}
+		if got.ID != msg.ID || got.Iface != msg.Iface || !got.Timestamp.Equal(msg.Timestamp) || !bytes.Equal(got.Data, msg.Data) {
+			t.Errorf("parse %q = %+v, want %+v", line, got, msg)
+		}
+	}
+	if _, err := ParseLog("1700000000.123456 can0 123#11"); err == nil {
+		t.Errorf("missing parentheses accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package canbus
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// oobSize is large enough for the SCM_TIMESTAMPNS, SCM_TIMESTAMPING and
+// SO_RXQ_OVFL control messages delivered with a received frame.
+var oobSize = unix.CmsgSpace(int(unsafe.Sizeof(unix.Timespec{}))) +
+	unix.CmsgSpace(3*int(unsafe.Sizeof(unix.Timespec{}))) +
+	unix.CmsgSpace(4)
+
+// enableTimestamps requests kernel receive timestamps on the socket.
+// SO_TIMESTAMPNS provides the software timestamp, SO_TIMESTAMPING adds
+// the hardware timestamp on controllers that support it.
+func enableTimestamps(fd int) error {
+	err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1)
+	if err != nil {
+		return err
+	}
+	flags := unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+	// not all kernels and drivers support hardware timestamps
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, flags)
+
+	return nil
+}
+
+// parseTimestamp returns the receive time from the control messages in
+// oob. A hardware timestamp is preferred over a software timestamp.
+// The zero time is returned if oob holds no timestamp.
+func parseTimestamp(oob []byte) time.Time {
+	ts, _, _ := parseControl(oob)
+	return ts
+}
+
+// parseControl returns the receive time and the SO_RXQ_OVFL drop counter
+// from the control messages in oob. ok reports whether the drop counter
+// was present. The control messages are walked without allocations.
+func parseControl(oob []byte) (ts time.Time, drops uint32, ok bool) {
+	var sw, hw time.Time
+	tsSize := int(unsafe.Sizeof(unix.Timespec{}))
+	for len(oob) >= unix.SizeofCmsghdr {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if int(h.Len) < unix.SizeofCmsghdr || int(h.Len) > len(oob) {
+			break
+		}
+		data := oob[unix.CmsgLen(0):h.Len]
+		if h.Level == unix.SOL_SOCKET {
+			switch h.Type {
+			case unix.SCM_TIMESTAMPNS:
+				if len(data) >= tsSize {
+					sw = timespecTime(data)
+				}
+			case unix.SCM_TIMESTAMPING:
+				// struct scm_timestamping: software, deprecated, raw hardware
+				if len(data) >= 3*tsSize {
+					if t := timespecTime(data[2*tsSize:]); !t.IsZero() {
+						hw = t
+					}
+					if t := timespecTime(data); !t.IsZero() && sw.IsZero() {
+						sw = t
+					}
+				}
+			case unix.SO_RXQ_OVFL:
+				if len(data) >= 4 {
+					drops = *(*uint32)(unsafe.Pointer(&data[0]))
+					ok = true
+				}
+			}
+		}
+		next := unix.CmsgSpace(int(h.Len) - unix.CmsgLen(0))
+		if next > len(oob) {
+			break
+		}
+		oob = oob[next:]
+	}
+	if !hw.IsZero() {
+		return hw, drops, ok
+	}
+	return sw, drops, ok
+}
+
+func timespecTime(b []byte) time.Time {
+	ts := *(*unix.Timespec)(unsafe.Pointer(&b[0]))
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts.Unix())
+}
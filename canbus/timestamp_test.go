@@ -0,0 +1,56 @@
+package canbus
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// cmsg returns a control message padded like the kernel does
+func cmsg(level, typ int32, data []byte) []byte {
+	b := make([]byte, unix.CmsgSpace(len(data)))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level, h.Type = level, typ
+	h.SetLen(unix.CmsgLen(len(data)))
+	copy(b[unix.CmsgLen(0):], data)
+	return b
+}
+
+func timespecBytes(t time.Time) []byte {
+	ts := unix.NsecToTimespec(t.UnixNano())
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))...)
+}
+
+func TestParseControl(t *testing.T) {
+	sw := time.Unix(1700000000, 123456789)
+	hw := time.Unix(1700000000, 123000000)
+	ovfl := func(n uint32) []byte {
+		return cmsg(unix.SOL_SOCKET, unix.SO_RXQ_OVFL, binary.NativeEndian.AppendUint32(nil, n))
+	}
+	timestamping := cmsg(unix.SOL_SOCKET, unix.SCM_TIMESTAMPING,
+		append(append(timespecBytes(time.Time{}), timespecBytes(time.Time{})...), timespecBytes(hw)...))
+	timestampns := cmsg(unix.SOL_SOCKET, unix.SCM_TIMESTAMPNS, timespecBytes(sw))
+
+	for _, tc := range []struct {
+		name  string
+		oob   []byte
+		ts    time.Time
+		drops uint32
+		ok    bool
+	}{
+		{"empty", nil, time.Time{}, 0, false},
+		{"software", append(append([]byte(nil), timestampns...), ovfl(7)...), sw, 7, true},
+		{"hardware", append(append(append([]byte(nil), ovfl(0xFFFFFFFF)...), timestampns...), timestamping...), hw, 0xFFFFFFFF, true},
+		{"no counter", timestampns, sw, 0, false},
+		{"other level", cmsg(unix.SOL_CAN_RAW, unix.SO_RXQ_OVFL, []byte{1, 0, 0, 0}), time.Time{}, 0, false},
+		{"truncated", append(append([]byte(nil), timestampns...), ovfl(3)[:unix.SizeofCmsghdr+2]...), sw, 0, false},
+	} {
+		ts, drops, ok := parseControl(tc.oob)
+		if !ts.Equal(tc.ts) || drops != tc.drops || ok != tc.ok {
+			t.Errorf("%s: got %v, %d, %v, want %v, %d, %v", tc.name, ts, drops, ok, tc.ts, tc.drops, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package canbus
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// virtualQueueLen is the number of frames an endpoint queues before
+// further frames are dropped, like a full socket receive queue.
+const virtualQueueLen = 1024
+
+// VirtualBus is an in-process CAN bus. Frames sent by one endpoint are
+// received by all other endpoints of the bus, like the loopback of
+// SocketCAN; the sender receives its own frames only with SetRecvOwn.
+type VirtualBus struct {
+	name      string
+	mu        sync.RWMutex
+	endpoints map[*VirtualEndpoint]struct{}
+}
+
+// NewVirtualBus returns a new in-process bus with the given name.
+func NewVirtualBus(name string) *VirtualBus {
+	return &VirtualBus{
+		name:      name,
+		endpoints: make(map[*VirtualEndpoint]struct{}),
+	}
+}
+
+// Name returns the name of the bus.
+func (vb *VirtualBus) Name() string {
+	return vb.name
+}
+
+// Open returns a new endpoint connected to the bus.
+func (vb *VirtualBus) Open() *VirtualEndpoint {
+	ep := &VirtualEndpoint{
+		bus:    vb,
+		queue:  make(chan Frame, virtualQueueLen),
+		closed: make(chan struct{}),
+	}
+	vb.mu.Lock()
+	vb.endpoints[ep] = struct{}{}
+	vb.mu.Unlock()
+	return ep
+}
+
+// deliver passes a copy of the frame to every endpoint whose filters
+// accept it.
+func (vb *VirtualBus) deliver(from *VirtualEndpoint, msg Frame) {
+	vb.mu.RLock()
+	defer vb.mu.RUnlock()
+	for ep := range vb.endpoints {
+		if ep == from && !ep.recvOwn.Load() {
+			continue
+		}
+		if fs := ep.filters.Load(); fs != nil && !fs.Match(msg) {
+			continue
+		}
+		m := msg
+		m.Data = append([]byte(nil), msg.Data...)
+		select {
+		case ep.queue <- m:
+		default:
+			ep.drops.Add(1)
+		}
+	}
+}
+
+// VirtualEndpoint is an endpoint of a VirtualBus.
+type VirtualEndpoint struct {
+	bus     *VirtualBus
+	queue   chan Frame
+	closed  chan struct{}
+	once    sync.Once
+	filters atomic.Pointer[FilterSet]
+	recvOwn atomic.Bool
+	drops   atomic.Uint32
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// Name returns the name of the bus.
+func (ep *VirtualEndpoint) Name() string {
+	return ep.bus.name
+}
+
+// SetRecvOwn enables the reception of the frames sent by the endpoint.
+func (ep *VirtualEndpoint) SetRecvOwn(enable bool) {
+	ep.recvOwn.Store(enable)
+}
+
+// Send sends the frame to the other endpoints of the bus.
+func (ep *VirtualEndpoint) Send(msg Frame) (int, error) {
+	select {
+	case <-ep.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+	size := int(frameSize)
+	switch {
+	case msg.IsXL():
+		if msg.Kind != SFF || len(msg.Data) == 0 {
+			return 0, errInvalidXL
+		}
+		if len(msg.Data) > MaxXLDataLen {
+			return 0, errDataTooBig
+		}
+		size = xlHeaderSize + len(msg.Data)
+	case msg.IsFD():
+		if len(msg.Data) > MaxFDDataLen {
+			return 0, errDataTooBig
+		}
+		msg.Flags |= FDF
+		size = int(fdFrameSize)
+	case len(msg.Data) > MaxDataLen:
+		return 0, errDataTooBig
+	}
+	msg.Timestamp = time.Now()
+	ep.bus.deliver(ep, msg)
+	return size, nil
+}
+
+// Recv receives the next frame from the bus.
+func (ep *VirtualEndpoint) Recv() (Frame, error) {
+	return ep.RecvContext(context.Background())
+}
+
+// RecvContext receives the next frame until ctx is done.
+func (ep *VirtualEndpoint) RecvContext(ctx context.Context) (Frame, error) {
+	ep.mu.Lock()
+	deadline := ep.deadline
+	ep.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case msg := <-ep.queue:
+		return msg, nil
+	case <-ep.closed:
+		return Frame{}, os.ErrClosed
+	case <-ctx.Done():
+		return Frame{}, ctx.Err()
+	case <-timeout:
+		return Frame{}, os.ErrDeadlineExceeded
+	}
+}
+
+// SetReadDeadline sets the deadline for future Recv calls. A zero value
+// for t means Recv will not time out.
+func (ep *VirtualEndpoint) SetReadDeadline(t time.Time) error {
+	ep.mu.Lock()
+	ep.deadline = t
+	ep.mu.Unlock()
+	return nil
+}
+
+// SetFilterSet passes only the frames matched by the filter set.
+func (ep *VirtualEndpoint) SetFilterSet(fs FilterSet) error {
+	fs.Filters = append([]Filter(nil), fs.Filters...)
+	ep.filters.Store(&fs)
+	return nil
+}
+
+// ResetFilters passes all frames again.
+func (ep *VirtualEndpoint) ResetFilters() error {
+	ep.filters.Store(nil)
+	return nil
+}
+
+// Dropped returns the number of frames dropped because the receive
+// queue of the endpoint was full.
+func (ep *VirtualEndpoint) Dropped() uint32 {
+	return ep.drops.Load()
+}
+
+// Close removes the endpoint from the bus and unblocks pending receives.
+func (ep *VirtualEndpoint) Close() error {
+	err := os.ErrClosed
+	ep.once.Do(func() {
+		ep.bus.mu.Lock()
+		delete(ep.bus.endpoints, ep)
+		ep.bus.mu.Unlock()
+		close(ep.closed)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package canbus
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestVirtualBus(t *testing.T) {
+	vb := NewVirtualBus("vbus0")
+	a, b := vb.Open(), vb.Open()
+	defer a.Close()
+	defer b.Close()
+
+	want := Frame{ID: 0x123, Data: []byte{1, 2, 3}}
+	if _, err := a.Send(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || !bytes.Equal(got.Data, want.Data) || got.Timestamp.IsZero() {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// the sender does not receive its own frame by default
+	a.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := a.Recv(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	a.SetReadDeadline(time.Time{})
+	a.SetRecvOwn(true)
+	a.Send(want)
+	if got, err := a.Recv(); err != nil || got.ID != want.ID {
+		t.Errorf("recv own: got %+v, %v", got, err)
+	}
+	b.Recv()
+
+	// filters apply per endpoint
+	b.SetFilterSet(FilterSet{Filters: []Filter{ExactID(0x200, SFFOnly)}})
+	a.Send(Frame{ID: 0x100})
+	a.Send(Frame{ID: 0x200})
+	if got, err := b.Recv(); err != nil || got.ID != 0x200 {
+		t.Errorf("filtered: got %+v, %v", got, err)
+	}
+}
+
+func TestVirtualClose(t *testing.T) {
+	ep := NewVirtualBus("vbus0").Open()
+	done := make(chan error)
+	go func() {
+		_, err := ep.Recv()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := ep.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, os.ErrClosed) {
+		t.Errorf("err = %v, want %v", err, os.ErrClosed)
+	}
+	if err := ep.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second close = %v, want %v", err, os.ErrClosed)
+	}
+}
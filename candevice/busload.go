@@ -0,0 +1,202 @@
+package candevice
+
+import (
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// bits after the CRC sequence: CRC delimiter, ACK slot, ACK delimiter,
+// end of frame and intermission
+const trailerBits = 1 + 1 + 1 + 7 + 3
+
+// FrameBits returns the length in bits of a frame on the bus, split into
+// the bits sent with the nominal bitrate and the bits sent with the data
+// bitrate after a bit rate switch. Stuff bits are computed from the frame
+// content, or estimated for the worst case. Error frames are reports of
+// the controller and have no length. The length of CAN XL frames is an
+// estimate.
+func FrameBits(f canbus.Frame, worstCase bool) (nominal, data int) {
+	if f.Kind == canbus.ERR {
+		return 0, 0
+	}
+	if f.IsXL() {
+		return xlFrameBits(len(f.Data))
+	}
+
+	var buf [640]byte
+	bits := buf[:0]
+	fd := f.IsFD()
+	eff := f.Kind == canbus.EFF || f.Kind == canbus.RTR_EFF
+	rtr := f.Kind == canbus.RTR_SFF || f.Kind == canbus.RTR_EFF
+
+	// arbitration and control field
+	bits = append(bits, 0) // SOF
+	if eff {
+		bits = appendBits(bits, f.ID>>18, 11)
+		bits = append(bits, 1, 1) // SRR, IDE
+		bits = appendBits(bits, f.ID, 18)
+	} else {
+		bits = appendBits(bits, f.ID, 11)
+	}
+	if fd {
+		// RRS, IDE of SFF, FDF, res, BRS
+		if !eff {
+			bits = append(bits, 0)
+		}
+		bits = append(bits, 0, 1, 0, bitOf(f.Flags&canbus.BRS != 0))
+	} else {
+		// RTR, IDE of SFF or r1, r0
+		bits = append(bits, bitOf(rtr), 0, 0)
+	}
+	// the data phase starts after the BRS bit
+	split := len(bits)
+	if !fd || f.Flags&canbus.BRS == 0 {
+		split = -1
+	}
+	if fd {
+		bits = append(bits, bitOf(f.Flags&canbus.ESI != 0))
+	}
+	dlc := len(f.Data)
+	if fd {
+		dlc = int(f.DLC())
+	}
+	bits = appendBits(bits, uint32(dlc), 4)
+	if !rtr {
+		for _, b := range f.Data {
+			bits = appendBits(bits, uint32(b), 8)
+		}
+	}
+
+	// the CRC field of classic frames is stuffed dynamically, the stuff
+	// count and CRC of CAN FD frames have fixed stuff bits
+	crcBits := 0
+	if fd {
+		crcBits = 4 + 17 + 6
+		if len(f.Data) > 16 {
+			crcBits = 4 + 21 + 7
+		}
+	} else {
+		bits = appendBits(bits, uint32(crc15(bits)), 15)
+	}
+
+	var stuffArb, stuffData int
+	if worstCase {
+		stuffArb, stuffData = worstStuffBits(len(bits), split)
+	} else {
+		stuffArb, stuffData = stuffBits(bits, split)
+	}
+	if split < 0 {
+		return len(bits) + stuffArb + crcBits + trailerBits, 0
+	}
+	return split + stuffArb + trailerBits, len(bits) - split + stuffData + crcBits
+}
+
+// xlFrameBits estimates the length of a CAN XL frame with n data bytes:
+// the arbitration field with worst case stuffing and the switch to the
+// data phase, the data phase fields with a fixed stuff bit after every
+// 10 bits and the switch back to the nominal bitrate.
+func xlFrameBits(n int) (nominal, data int) {
+	// SOF, priority, RRS, IDE, FDF, XLF, resXL, ADH
+	arb := 1 + 11 + 1 + 1 + 1 + 1 + 1 + 1
+	arb += (arb - 1) / 4
+	// SDT, SEC, DLC, SBC, PCRC, VCID, AF, data, FCRC, FCP
+	data = 8 + 1 + 11 + 3 + 13 + 8 + 32 + 8*n + 32 + 4
+	data += data / 10
+	// ADH2, ADH3, ADL and DAH, AH1, AL1, AH2 of the phase switches
+	return arb + 3 + 4 + trailerBits, data
+}
+
+// appendBits appends the n lower bits of v, most significant bit first
+func appendBits(bits []byte, v uint32, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		bits = append(bits, byte(v>>i)&1)
+	}
+	return bits
+}
+
+func bitOf(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// crc15 returns the CRC of a classic CAN frame
+func crc15(bits []byte) uint16 {
+	var crc uint16
+	for _, b := range bits {
+		next := b ^ byte(crc>>14)&1
+		crc = crc << 1 & 0x7FFF
+		if next != 0 {
+			crc ^= 0x4599
+		}
+	}
+	return crc
+}
+
+// stuffBits counts the stuff bits inserted after 5 equal bits, before
+// and after the bit at index split, split < 0 counts all bits before
+func stuffBits(bits []byte, split int) (before, after int) {
+	run, last := 0, byte(2)
+	for i, b := range bits {
+		if b == last {
+			run++
+		} else {
+			run, last = 1, b
+		}
+		if run == 5 {
+			// the stuff bit starts the next run
+			if split < 0 || i < split {
+				before++
+			} else {
+				after++
+			}
+			run, last = 1, 1-b
+		}
+	}
+	return before, after
+}
+
+// worstStuffBits returns the maximum number of stuff bits of n bits,
+// before and after the bit at index split, split < 0 counts all before
+func worstStuffBits(n, split int) (before, after int) {
+	all := (n - 1) / 4
+	if split < 0 {
+		return all, 0
+	}
+	before = (split - 1) / 4
+	return before, all - before
+}
+
+// setBitrates sets the bitrates for the bus load from the parameters of
+// the interface, or the bitrates set by the user for interfaces without
+// bit timing, e.g. vcan
+func (candevice *CanDevice) setBitrates() {
+	nominal := candevice.CanParams.Bitrate
+	data := candevice.CanParams.DataTiming.Bitrate
+	if nominal == 0 {
+		nominal, data = candevice.Bitrate, candevice.DataBitrate
+	}
+	if data == 0 {
+		data = nominal
+	}
+	candevice.bitrate.Store(nominal)
+	candevice.dataBitrate.Store(data)
+}
+
+// HasBitrate reports whether a bitrate is known to calculate the bus load
+func (candevice *CanDevice) HasBitrate() bool {
+	return candevice.bitrate.Load() > 0
+}
+
+// frameTime returns the time a frame occupies the bus, 0 without bitrate
+func (candevice *CanDevice) frameTime(f *canbus.Frame) time.Duration {
+	nominal, data := candevice.bitrate.Load(), candevice.dataBitrate.Load()
+	if nominal == 0 {
+		return 0
+	}
+	nbits, dbits := FrameBits(*f, candevice.StuffWorstCase)
+	return time.Duration(uint64(nbits)*uint64(time.Second)/nominal +
+		uint64(dbits)*uint64(time.Second)/data)
+}
@@ -0,0 +1,86 @@
+package candevice
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestFrameBits(t *testing.T) {
+	data8 := make([]byte, 8)
+	data64 := make([]byte, 64)
+	for _, tc := range []struct {
+		name          string
+		frame         canbus.Frame
+		worstCase     bool
+		nominal, data int
+	}{
+		// 34 zero bits up to the CRC, a stuff bit after every 5
+		{"sff zero", canbus.Frame{ID: 0}, false, 34 + 6 + 13, 0},
+		{"sff zero worst", canbus.Frame{ID: 0}, true, 34 + 8 + 13, 0},
+		{"sff 8 worst", canbus.Frame{ID: 0x123, Data: data8}, true, 135, 0},
+		{"eff 8 worst", canbus.Frame{ID: 0x1234567, Kind: canbus.EFF, Data: data8}, true, 160, 0},
+		{"rtr worst", canbus.Frame{ID: 0x123, Kind: canbus.RTR_SFF, Data: data8}, true, 34 + 8 + 13, 0},
+		{"fd 64", canbus.Frame{ID: 0x123, Data: data64, Flags: canbus.FDF}, true, 534 + 133 + 32 + 13, 0},
+		{"fd 64 brs", canbus.Frame{ID: 0x123, Data: data64, Flags: canbus.FDF | canbus.BRS}, true, 17 + 4 + 13, 517 + 129 + 32},
+		{"error", canbus.Frame{ID: 0x4, Kind: canbus.ERR, Data: data8}, false, 0, 0},
+	} {
+		nominal, data := FrameBits(tc.frame, tc.worstCase)
+		if nominal != tc.nominal || data != tc.data {
+			t.Errorf("%s: bits = %d/%d, want %d/%d", tc.name, nominal, data, tc.nominal, tc.data)
+		}
+	}
+
+	// computed stuff bits never exceed the worst case
+	for _, frame := range []canbus.Frame{
+		{ID: 0x7FF, Data: []byte{0xFF, 0x00, 0xFF, 0x00}},
+		{ID: 0x1F0F0F0F, Kind: canbus.EFF, Data: []byte{0x0F, 0xF0, 0x55}},
+		{ID: 0x000, Data: data64, Flags: canbus.FDF | canbus.BRS},
+	} {
+		n, d := FrameBits(frame, false)
+		wn, wd := FrameBits(frame, true)
+		if n+d > wn+wd || n+d == 0 {
+			t.Errorf("%v: computed %d bits, worst case %d", frame, n+d, wn+wd)
+		}
+	}
+}
+
+func TestBusLoad(t *testing.T) {
+	dev := NewBusDevice(canbus.NewVirtualBus("vbus0").Open())
+	defer dev.Close()
+	if err := dev.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if dev.HasBitrate() {
+		t.Fatal("bitrate without bit timing")
+	}
+	dev.Bitrate = 500000
+	dev.StuffWorstCase = true
+	if err := dev.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	stat := dev.CanStatstic
+
+	// 135 bits at 500 kbit/s
+	frame := canbus.Frame{ID: 0x123, Data: make([]byte, 8)}
+	if d := dev.frameTime(&frame); d != 270*time.Microsecond {
+		t.Fatalf("frame time = %v", d)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := dev.SendFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	stat.Update(now)
+	stat.Update(now.Add(time.Second))
+	snap := stat.Snapshot()
+	if math.Abs(snap.TxLoadMaxSec-27) > 1e-9 || snap.TxLoadLastSec != 0 || math.Abs(snap.TxLoadAveSec-13.5) > 1e-9 {
+		t.Errorf("load last %v max %v ave %v", snap.TxLoadLastSec, snap.TxLoadMaxSec, snap.TxLoadAveSec)
+	}
+	if history := stat.History(); len(history) != 2 || math.Abs(history[0].TxLoad-27) > 1e-9 {
+		t.Errorf("history = %v", history)
+	}
+}
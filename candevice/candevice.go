@@ -1,38 +1,65 @@
 package candevice
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
-	"os/exec"
-	"regexp"
 	"slices"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/miwagner/socanui/canbus"
 )
 
 type CanDevice struct {
-	CanParams     *canParameter
-	CanInterfaces *canInterfaces
-	CanStatstic   *canStatistic
-	CanInf        string
-	Sck           *canbus.Socket
-	CanFilter     *canFilter
+	CanParams      *canParameter
+	CanInterfaces  *canInterfaces
+	CanStatstic    *Statistic
+	CanInf         string
+	Bus            canbus.Bus
+	Sck            *canbus.Socket             // SocketCAN only, nil for other buses
+	busMu          sync.RWMutex               // guards Bus, txIndex and CanInterfaces read off the goroutine of Reconnect
+	reopen         func() (canbus.Bus, error) // opens the bus again, other buses only
+	filter         atomic.Pointer[filterPlan] // nil passes all frames
+	Interfaces     []string                   // interfaces to receive from, empty for all
+	multi          bool
+	txIndex        int
+	ErrorMask      canbus.ErrorClass
+	errorMask      atomic.Uint32 // ErrorMask for the receiving goroutine
+	RecvBufSize    int
+	Bitrate        uint64 // bitrate for the bus load without bit timing, e.g. vcan
+	DataBitrate    uint64
+	StuffWorstCase bool // bus load with worst case instead of computed stuff bits
+	XLFrames       bool // receive and send CAN XL frames, SocketCAN only
+	bitrate        atomic.Uint64
+	dataBitrate    atomic.Uint64
+	Bcm            *canbus.BCM
+	cyclic         *canbus.Frame
+	cyclicPeriod   time.Duration
+	disconnected   atomic.Bool
+	stateMu        sync.Mutex
+	stateHistory   []StateChange
 }
 
 type canParameter struct {
-	Mode        []string
-	Bitrate     uint64
-	SamplePoint float64
+	Kind        string   // link kind: can, vcan, vxcan
+	Mode        []string // names of the ctrlmode flags
+	CtrlMode    uint32   // CAN_CTRLMODE_* flags
 	State       string
 	RestartTime uint64
-	Tq          uint64
-	PropSeg     uint8
-	PhaseSeg1   uint8
-	PhaseSeg2   uint8
-	Sjw         uint8
+	Clock       uint32 // controller clock in Hz
+	TxErrors    uint16 // bus error counters
+	RxErrors    uint16
+	Stats       DeviceStats
+	LinkStats   LinkStats
+	BitTiming
+	DataTiming BitTiming // CAN FD data phase
 }
 
 type canInterfaces struct {
@@ -40,23 +67,78 @@ type canInterfaces struct {
 	vcan []string
 }
 
-type canStatistic struct {
-	RxFrameSum     uint64
-	TxFrameSum     uint64
-	RxFrameLastSec uint64
-	TxFrameLastSec uint64
-	RxFrameMaxSec  uint64
-	TxFrameMaxSec  uint64
-	RxFrameAveSec  uint64
-	TxFrameAveSec  uint64
-	RxFrameLast    uint64
-	TxFrameLast    uint64
-	Runs           uint64
+// ErrDisconnected is returned when the interface went down or was removed
+var ErrDisconnected = errors.New("CAN interface disconnected")
+
+// ErrNoBCM is returned for cyclic frames without broadcast manager
+var ErrNoBCM = errors.New("Broadcast manager not available")
+
+// Accept reports whether a received frame passes the part of the filter
+// checked in userspace, rejected frames are counted in the statistic.
+// Frames dropped by the kernel filters are not received.
+func (candevice *CanDevice) Accept(msg *canbus.Frame) bool {
+	plan := candevice.filter.Load()
+	if plan != nil && plan.software && !plan.set.Match(msg) {
+		if !msg.Local {
+			candevice.CanStatstic.countFiltered()
+		}
+		return false
+	}
+	return true
+}
+
+// SetFilter sets a copy of the filter set, nil passes all frames. The
+// rules that can be expressed as CAN_RAW_FILTER are installed on the
+// socket, the others are checked in userspace. If the kernel filters
+// can not be installed, all rules are checked in userspace and the error
+// is returned.
+func (candevice *CanDevice) SetFilter(fs *FilterSet) error {
+	if fs != nil {
+		fs = fs.Clone()
+	}
+	plan := compileFilter(fs)
+	err := installFilter(candevice.Bus, plan)
+	if err != nil {
+		plan = userspaceFilter(fs)
+		installFilter(candevice.Bus, plan)
+	}
+	candevice.filter.Store(plan)
+	return err
+}
+
+// installFilter installs the kernel filters of the plan on the bus
+func installFilter(bus canbus.Bus, plan *filterPlan) error {
+	if bus == nil {
+		return nil
+	}
+	if plan.kernel == nil {
+		return bus.ResetFilters()
+	}
+	return bus.SetFilterSet(*plan.kernel)
+}
+
+// Filter returns the filter set, nil if not set. The set must not be
+// changed.
+func (candevice *CanDevice) Filter() *FilterSet {
+	plan := candevice.filter.Load()
+	if plan == nil {
+		return nil
+	}
+	return plan.set
 }
-type canFilter struct {
-	IdStart    uint32
-	IdEnd      uint32
-	RangeActiv bool
+
+// FilterActive reports whether the filter has enabled rules
+func (candevice *CanDevice) FilterActive() bool {
+	return candevice.Filter() != nil
+}
+
+// FilterPlaces returns where the rules of the filter set are checked
+func (candevice *CanDevice) FilterPlaces() []FilterPlace {
+	plan := candevice.filter.Load()
+	if plan == nil {
+		return nil
+	}
+	return slices.Clone(plan.places)
 }
 
 func NewDevice(caninf string) (*CanDevice, error) {
@@ -73,29 +155,31 @@ func NewDevice(caninf string) (*CanDevice, error) {
 	log.Println("Interfaces CAN: ", canDev.CanInterfaces.can)
 	log.Println("Interfaces VCAN: ", canDev.CanInterfaces.vcan)
 
-	//  Check if the interface exists
-	if !(slices.Contains(canDev.CanInterfaces.can, canDev.CanInf) || slices.Contains(canDev.CanInterfaces.vcan, canDev.CanInf)) {
-		err = errors.New("Interface not exists")
-		return &CanDevice{}, err
-	}
-
-	// Check if the interface is up
-	inf, err := net.InterfaceByName(canDev.CanInf)
-	if err != nil {
-		err = errors.New("Interface error")
-		return &CanDevice{}, err
+	// several interfaces with one socket: "any" or a list such as "can0,can1"
+	if canDev.CanInf == canbus.AnyInterface || strings.Contains(canDev.CanInf, ",") {
+		canDev.multi = true
+		if canDev.CanInf != canbus.AnyInterface {
+			canDev.Interfaces = strings.Split(canDev.CanInf, ",")
+		}
+	} else {
+		canDev.Interfaces = []string{canDev.CanInf}
 	}
-	if !strings.Contains(inf.Flags.String(), "up") {
-		err = errors.New("Interface is not up")
-		return &CanDevice{}, err
+	for _, inf := range canDev.Interfaces {
+		err = canDev.checkInterface(inf)
+		if err != nil {
+			return &CanDevice{}, err
+		}
 	}
 
 	log.Println("CAN Parameter:")
-	canDev.CanParams = canDev.getCanParameter()
+	canDev.CanParams = canDev.getCanParameter(canDev.TxInf())
 
+	log.Println("Kind: ", canDev.CanParams.Kind)
 	log.Println("Mode: ", canDev.CanParams.Mode)
 	log.Println("Bitrate: ", canDev.CanParams.Bitrate)
 	log.Println("Samplepoint: ", canDev.CanParams.SamplePoint)
+	log.Println("Data Bitrate: ", canDev.CanParams.DataTiming.Bitrate)
+	log.Println("Clock: ", canDev.CanParams.Clock)
 	log.Println("State:", canDev.CanParams.State)
 	log.Println("Restart in ms:", canDev.CanParams.RestartTime)
 	log.Println("TQ:", canDev.CanParams.Tq)
@@ -104,179 +188,460 @@ func NewDevice(caninf string) (*CanDevice, error) {
 	log.Println("PhaseSeg2:", canDev.CanParams.PhaseSeg2)
 	log.Println("Sjw:", canDev.CanParams.Sjw)
 
-	canDev.CanStatstic = &canStatistic{}
-
-	canDev.CanFilter = &canFilter{}
+	canDev.CanStatstic = newStatistic()
 
 	return canDev, nil
 }
 
+// check if the interface exists and is up
+func (canDev *CanDevice) checkInterface(caninf string) error {
+	if !(slices.Contains(canDev.CanInterfaces.can, caninf) || slices.Contains(canDev.CanInterfaces.vcan, caninf)) {
+		return errors.New("Interface not exists")
+	}
+	inf, err := net.InterfaceByName(caninf)
+	if err != nil {
+		return errors.New("Interface error")
+	}
+	if !strings.Contains(inf.Flags.String(), "up") {
+		return errors.New("Interface is not up")
+	}
+	return nil
+}
+
+// MultiInterface reports whether frames of several interfaces are received
+func (candevice *CanDevice) MultiInterface() bool {
+	return candevice.multi
+}
+
+// TxInf returns the interface to send on, the first of several interfaces
+func (candevice *CanDevice) TxInf() string {
+	if len(candevice.Interfaces) > 0 {
+		return candevice.Interfaces[0]
+	}
+	if len(candevice.CanInterfaces.can) > 0 {
+		return candevice.CanInterfaces.can[0]
+	}
+	if len(candevice.CanInterfaces.vcan) > 0 {
+		return candevice.CanInterfaces.vcan[0]
+	}
+	return candevice.CanInf
+}
+
+// NewBusDevice returns a connected device for the bus, such as an
+// endpoint of a virtual bus
+func NewBusDevice(bus canbus.Bus) *CanDevice {
+	return &CanDevice{
+		CanParams:     &canParameter{},
+		CanInterfaces: &canInterfaces{},
+		CanStatstic:   newStatistic(),
+		CanInf:        bus.Name(),
+		Bus:           bus,
+	}
+}
+
 func (candevice *CanDevice) Connect() error {
-	var err error
-	candevice.Sck, err = canbus.New()
+	candevice.setBitrates()
+	candevice.errorMask.Store(uint32(candevice.ErrorMask))
+	if candevice.Bus != nil {
+		// connected by NewBusDevice
+		return nil
+	}
+	sck, bcm, err := candevice.openSocket()
+	if err != nil {
+		return err
+	}
+	candevice.Sck, candevice.Bus, candevice.Bcm = sck, sck, bcm
+	candevice.txIndex = candevice.txIfindex()
+	return nil
+}
+
+// txIfindex returns the index of the interface to send to when bound to
+// several interfaces, 0 otherwise.
+func (candevice *CanDevice) txIfindex() int {
+	if !candevice.multi {
+		return 0
+	}
+	inf, err := net.InterfaceByName(candevice.TxInf())
+	if err != nil {
+		return 0
+	}
+	return inf.Index
+}
+
+// openSocket returns a new bound and configured socket and the broadcast
+// manager, nil if not available. The bus of the device is not changed.
+func (candevice *CanDevice) openSocket() (*canbus.Socket, *canbus.BCM, error) {
+	sck, err := canbus.New()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating socket: %w", err)
+	}
+
+	if candevice.multi {
+		err = sck.BindAll()
+	} else {
+		err = sck.Bind(candevice.CanInf)
+	}
+	if err != nil {
+		sck.Close()
+		return nil, nil, fmt.Errorf("error binding to [%s]: %w", candevice.CanInf, err)
+	}
+
+	// socket receive buffer
+	if candevice.RecvBufSize > 0 {
+		err = sck.SetRecvBuffer(candevice.RecvBufSize)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// kernel filters of a filter set, e.g. after a reconnect
+	if plan := candevice.filter.Load(); plan != nil {
+		err = installFilter(sck, plan)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// error frames
+	err = sck.SetErrorFilter(candevice.ErrorMask)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// CAN FD frames, classic frames are still received
+	err = sck.SetFDFrames(true)
+	if err != nil {
+		log.Println(err)
+	}
+	// CAN XL frames, not supported before Linux 6.2
+	if candevice.XLFrames {
+		err = sck.SetXLFrames(true)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// broadcast manager for cyclic frames, optional
+	bcm, err := canbus.NewBCM()
+	if err == nil {
+		err = bcm.Connect(candevice.TxInf())
+		if err != nil {
+			bcm.Close()
+			bcm = nil
+		}
+	}
+	if err != nil {
+		log.Printf("broadcast manager not available: %v\n", err)
+	}
+	return sck, bcm, nil
+}
+
+// Close closes the bus and the broadcast manager
+func (candevice *CanDevice) Close() error {
+	candevice.busMu.Lock()
+	defer candevice.busMu.Unlock()
+	if candevice.Bcm != nil {
+		candevice.Bcm.Close()
+	}
+	if candevice.Bus == nil {
+		return nil
+	}
+	return candevice.Bus.Close()
+}
+
+// StartCyclic sends the frame every period with the kernel broadcast
+// manager. The sent frames are looped back to the socket and counted in
+// the TX statistic when received.
+func (candevice *CanDevice) StartCyclic(frame canbus.Frame, period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("invalid period %v for cyclic frame", period)
+	}
+	if candevice.Bcm == nil {
+		return ErrNoBCM
+	}
+	if candevice.cyclic != nil && (candevice.cyclic.ID != frame.ID || candevice.cyclic.Kind != frame.Kind) {
+		err := candevice.StopCyclic()
+		if err != nil {
+			return err
+		}
+	}
+	err := candevice.Bcm.SetupTx([]canbus.Frame{frame}, 0, 0, period)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
+	candevice.cyclic = &frame
+	candevice.cyclicPeriod = period
+	return nil
+}
 
-	err = candevice.Sck.Bind(candevice.CanInf)
+// UpdateCyclic changes the content of the running cyclic frame without
+// restarting its timer. A frame with another ID or format replaces the
+// running one.
+func (candevice *CanDevice) UpdateCyclic(frame canbus.Frame) error {
+	if candevice.cyclic == nil {
+		return nil
+	}
+	if candevice.cyclic.ID != frame.ID || candevice.cyclic.Kind != frame.Kind {
+		return candevice.StartCyclic(frame, candevice.cyclicPeriod)
+	}
+	err := candevice.Bcm.UpdateTx([]canbus.Frame{frame})
 	if err != nil {
-		log.Fatalf("error binding to [%s]: %v\n", candevice.CanInf, err)
 		return err
 	}
+	candevice.cyclic = &frame
 	return nil
 }
 
+// StopCyclic stops the cyclic frame of the broadcast manager
+func (candevice *CanDevice) StopCyclic() error {
+	if candevice.Bcm == nil || candevice.cyclic == nil {
+		return nil
+	}
+	err := candevice.Bcm.DeleteTx(candevice.cyclic.ID, candevice.cyclic.Kind)
+	candevice.cyclic = nil
+	return err
+}
+
+// OpenISOTP opens an ISO-TP connection on the interface
+func (candevice *CanDevice) OpenISOTP(opts canbus.ISOTPOptions) (*canbus.ISOTP, error) {
+	return canbus.DialISOTP(candevice.TxInf(), opts)
+}
+
+// OpenJ1939 opens a J1939 socket on the interface with the local NAME and address
+func (candevice *CanDevice) OpenJ1939(name uint64, addr uint8, promisc bool) (*canbus.J1939, error) {
+	sck, err := canbus.NewJ1939()
+	if err != nil {
+		return nil, err
+	}
+	err = sck.Bind(candevice.TxInf(), name, addr)
+	if err == nil && promisc {
+		err = sck.SetPromisc(true)
+	}
+	if err == nil && name != canbus.J1939NoName {
+		err = sck.ClaimAddress()
+	}
+	if err != nil {
+		sck.Close()
+		return nil, err
+	}
+	return sck, nil
+}
+
+// CyclicActive reports whether the broadcast manager sends a cyclic frame
+func (candevice *CanDevice) CyclicActive() bool {
+	return candevice.cyclic != nil
+}
+
+// SetErrorFilter subscribes to the error frames of the classes in mask
+func (candevice *CanDevice) SetErrorFilter(mask canbus.ErrorClass) error {
+	candevice.ErrorMask = mask
+	candevice.errorMask.Store(uint32(mask))
+	if candevice.Sck == nil {
+		return nil
+	}
+	return candevice.Sck.SetErrorFilter(mask)
+}
+
+// bus returns the bus, for goroutines other than the one of Reconnect
+func (candevice *CanDevice) bus() canbus.Bus {
+	candevice.busMu.RLock()
+	defer candevice.busMu.RUnlock()
+	return candevice.Bus
+}
+
 func (candevice *CanDevice) RecFrame() (canbus.Frame, error) {
-	msg, err := candevice.Sck.Recv()
+	bus := candevice.bus()
+	msg, err := bus.Recv()
+	for err == nil && !candevice.selected(&msg) {
+		msg, err = bus.Recv()
+	}
+	if err != nil {
+		return msg, candevice.linkError(err)
+	}
+	candevice.countRx(&msg)
+
+	return msg, nil
+}
+
+// RecFrameContext receives a frame until ctx is done or the socket is closed
+func (candevice *CanDevice) RecFrameContext(ctx context.Context) (canbus.Frame, error) {
+	bus := candevice.bus()
+	msg, err := bus.RecvContext(ctx)
+	for err == nil && !candevice.selected(&msg) {
+		msg, err = bus.RecvContext(ctx)
+	}
 	if err != nil {
-		log.Fatalf("recv error: %v\n", err)
-		return msg, err
+		return msg, candevice.linkError(err)
 	}
-	candevice.CanStatstic.RxFrameSum++
+	candevice.countRx(&msg)
 
 	return msg, nil
 }
 
+// frame received on one of the selected interfaces. Error frames of
+// buses without kernel error filter, such as socketcand, are filtered here.
+func (candevice *CanDevice) selected(msg *canbus.Frame) bool {
+	if msg.Kind == canbus.ERR && canbus.ErrorClass(msg.ID)&canbus.ErrorClass(candevice.errorMask.Load()) == 0 {
+		return false
+	}
+	if !candevice.multi || len(candevice.Interfaces) == 0 {
+		return true
+	}
+	return slices.Contains(candevice.Interfaces, msg.Iface)
+}
+
+// update the RX statistic with a received frame. Frames sent by other
+// sockets of this host, such as the cyclic frames of the broadcast
+// manager, are looped back and counted as sent.
+func (candevice *CanDevice) countRx(msg *canbus.Frame) {
+	if msg.Local {
+		candevice.CanStatstic.countTx(candevice.frameTime(msg))
+	} else {
+		candevice.CanStatstic.countRx(msg, candevice.frameTime(msg))
+	}
+	if d, ok := candevice.bus().(interface{ Dropped() uint32 }); ok {
+		candevice.CanStatstic.setDrops(d.Dropped())
+	}
+}
+
 func (candevice *CanDevice) SendFrame(frame canbus.Frame) error {
-	_, err := candevice.Sck.Send(frame)
+	// a send blocked on the old bus fails when Reconnect closes it
+	candevice.busMu.RLock()
+	bus, txIndex := candevice.Bus, candevice.txIndex
+	candevice.busMu.RUnlock()
+	if candevice.multi && frame.Ifindex == 0 {
+		frame.Ifindex = txIndex
+	}
+	_, err := bus.Send(frame)
 	if err != nil {
-		log.Fatalf("error sending data: %v\n", err)
+		return fmt.Errorf("error sending data: %w", candevice.linkError(err))
 	}
-	candevice.CanStatstic.TxFrameSum++
+	candevice.CanStatstic.countTx(candevice.frameTime(&frame))
 
 	return nil
 }
 
-func (canDev *CanDevice) getCanParameter() *canParameter {
-	var err error
-	canparameter := &canParameter{}
-
-	// Only can interface, not vcan
-	if !slices.Contains(canDev.CanInterfaces.can, canDev.CanInf) {
-		return canparameter
+// linkError marks the device disconnected and returns ErrDisconnected if
+// err is caused by the interface going down or being removed, or by the
+// loss of the line to an adapter or the connection to a server
+func (candevice *CanDevice) linkError(err error) error {
+	if errors.Is(err, syscall.ENETDOWN) || errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.EIO) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ETIMEDOUT) {
+		candevice.disconnected.Store(true)
+		return fmt.Errorf("%w: %w", ErrDisconnected, err)
 	}
+	return err
+}
+
+// Disconnected reports whether the interface went down or was removed
+// and the device is not reconnected yet
+func (candevice *CanDevice) Disconnected() bool {
+	return candevice.disconnected.Load()
+}
 
-	output, err := exec.Command("ip", "-details", "link", "show", canDev.CanInf).Output()
+// Reconnect opens the socket again once the interfaces are back and up.
+// The statistics are kept and a cyclic frame is set up again. Reconnect
+// must be called on the goroutine that changes the device, frames are
+// received and sent on other goroutines meanwhile.
+func (candevice *CanDevice) Reconnect() error {
+	if candevice.reopen != nil {
+		return candevice.reopenBus()
+	}
+	if candevice.Sck == nil {
+		return fmt.Errorf("reconnect not supported for %s", candevice.CanInf)
+	}
+	ci, err := getCanInterfaces()
 	if err != nil {
-		return canparameter
-	}
-
-	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")[2:]
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		log.Println(line)
-		// state and restart-ms
-		if i == 0 {
-			re := regexp.MustCompile("can (?P<mode>.*)state (?P<state>.*) restart-ms (?P<restartms>[0-9]*)")
-			matches := re.FindStringSubmatch(line)
-			log.Println(matches[re.SubexpIndex("mode")])
-			log.Println(matches[re.SubexpIndex("state")])
-			log.Println(matches[re.SubexpIndex("restartms")])
-
-			mode := strings.TrimSpace(matches[re.SubexpIndex("mode")])
-			mode = strings.TrimLeft(mode, "<")
-			mode = strings.TrimRight(mode, ">")
-			canparameter.Mode = strings.Split(mode, ",")
-			canparameter.State = matches[re.SubexpIndex("state")]
-			canparameter.RestartTime, err = strconv.ParseUint(matches[re.SubexpIndex("restartms")], 10, 64)
-			if err != nil {
-				return &canParameter{}
-			}
-			if canparameter.State == "STOPPED" {
-				return &canParameter{}
-			}
-		}
-		// bitrate and samplepoint
-		if i == 1 {
-			re := regexp.MustCompile("bitrate (?P<bitrate>[0-9]*) sample-point (?P<samplepoint>([0-9]*[.])?[0-9]+)")
-			matches := re.FindStringSubmatch(line)
-			if len(matches) == 4 {
-				log.Println(matches[re.SubexpIndex("bitrate")])
-				log.Println(matches[re.SubexpIndex("samplepoint")])
-				canparameter.Bitrate, err = strconv.ParseUint(matches[re.SubexpIndex("bitrate")], 10, 32)
-				if err != nil {
-					return &canParameter{}
-				}
-				canparameter.SamplePoint, err = strconv.ParseFloat(matches[re.SubexpIndex("samplepoint")], 64)
-				if err != nil {
-					return &canParameter{}
-				}
-			}
-		}
-		// tq, prop-seg, phase-seg1, phase-seg2, swj
-		if i == 2 {
-			re := regexp.MustCompile("tq (?P<tq>[0-9]*) prop-seg (?P<propseg>([0-9])) phase-seg1 (?P<phaseseg1>([0-9])) phase-seg2 (?P<phaseseg2>([0-9])) sjw (?P<sjw>([0-9]))")
-			matches := re.FindStringSubmatch(line)
-			if len(matches) == 10 {
-				log.Println(matches[re.SubexpIndex("tq")])
-				log.Println(matches[re.SubexpIndex("propseg")])
-				log.Println(matches[re.SubexpIndex("phaseseg1")])
-				log.Println(matches[re.SubexpIndex("phaseseg2")])
-				log.Println(matches[re.SubexpIndex("sjw")])
-
-				canparameter.Tq, err = strconv.ParseUint(matches[re.SubexpIndex("tq")], 10, 32)
-				if err != nil {
-					return &canParameter{}
-				}
-				t, err := strconv.ParseUint(matches[re.SubexpIndex("propseg")], 10, 8)
-				if err != nil {
-					return &canParameter{}
-				}
-				canparameter.PropSeg = uint8(t)
-				t, _ = strconv.ParseUint(matches[re.SubexpIndex("phaseseg1")], 10, 8)
-				if err != nil {
-					return &canParameter{}
-				}
-				canparameter.PhaseSeg1 = uint8(t)
-				t, _ = strconv.ParseUint(matches[re.SubexpIndex("phaseseg2")], 10, 8)
-				if err != nil {
-					return &canParameter{}
-				}
-				canparameter.PhaseSeg2 = uint8(t)
-				t, _ = strconv.ParseUint(matches[re.SubexpIndex("sjw")], 10, 8)
-				if err != nil {
-					return &canParameter{}
-				}
-				canparameter.Sjw = uint8(t)
-				break
-			}
+		return err
+	}
+	candevice.busMu.Lock()
+	candevice.CanInterfaces = ci
+	candevice.busMu.Unlock()
+	for _, inf := range candevice.Interfaces {
+		err = candevice.checkInterface(inf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", inf, err)
 		}
 	}
-	return canparameter
-}
 
-func getCanInterfaces() (*canInterfaces, error) {
-	var err error
+	// the lock is only held for the swap, so that a send blocked on the
+	// old bus does not stall the reconnect
+	sck, bcm, err := candevice.openSocket()
+	if err != nil {
+		return err
+	}
+	txIndex := candevice.txIfindex()
+	candevice.busMu.Lock()
+	oldBus, oldBcm := candevice.Bus, candevice.Bcm
+	candevice.Sck, candevice.Bus, candevice.Bcm = sck, sck, bcm
+	candevice.txIndex = txIndex
+	candevice.busMu.Unlock()
+	oldBus.Close()
+	if oldBcm != nil {
+		oldBcm.Close()
+	}
 
-	ci := &canInterfaces{}
-	re := regexp.MustCompile(`\d+:\s(?P<inf>\w+):`)
+	candevice.CanStatstic.restartDrops()
+	if candevice.cyclic != nil {
+		frame := *candevice.cyclic
+		candevice.cyclic = nil
+		err = candevice.StartCyclic(frame, candevice.cyclicPeriod)
+		if err != nil {
+			log.Printf("cyclic frame not restarted: %v\n", err)
+		}
+	}
+	candevice.disconnected.Store(false)
+	candevice.UpdateParams()
+	return nil
+}
 
-	// Type can
-	output, err := exec.Command("ip", "link", "show", "type", "can").Output()
+// reopenBus replaces the bus of a device without SocketCAN with a newly
+// opened one and installs the filters again
+func (candevice *CanDevice) reopenBus() error {
+	bus, err := candevice.reopen()
 	if err != nil {
-		log.Println(err)
-		return &canInterfaces{}, err
+		return err
 	}
-	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")[:]
-	for _, line := range lines {
-		matches := re.FindStringSubmatch(line)
-		if matches != nil {
-			ci.can = append(ci.can, matches[re.SubexpIndex("inf")])
+	candevice.busMu.Lock()
+	old := candevice.Bus
+	candevice.Bus = bus
+	candevice.busMu.Unlock()
+	old.Close()
+	if plan := candevice.filter.Load(); plan != nil {
+		err = candevice.SetFilter(plan.set)
+		if err != nil {
+			log.Println(err)
 		}
 	}
+	candevice.CanStatstic.restartDrops()
+	candevice.disconnected.Store(false)
+	return nil
+}
+
+func (canDev *CanDevice) getCanParameter(caninf string) *canParameter {
+	link, err := getLink(caninf)
+	if err != nil {
+		log.Println(err)
+		return &canParameter{}
+	}
+	return &link.Params
+}
 
-	// Type vcan
-	output, err = exec.Command("ip", "link", "show", "type", "vcan").Output()
+func getCanInterfaces() (*canInterfaces, error) {
+	links, err := getLinks()
 	if err != nil {
 		log.Println(err)
 		return &canInterfaces{}, err
 	}
-	lines = strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")[:]
-	for _, line := range lines {
-		matches := re.FindStringSubmatch(line)
-		if matches != nil {
-			ci.vcan = append(ci.vcan, matches[re.SubexpIndex("inf")])
+
+	ci := &canInterfaces{}
+	for _, link := range links {
+		switch {
+		case link.isVirtual():
+			ci.vcan = append(ci.vcan, link.Name)
+		case link.isCAN():
+			ci.can = append(ci.can, link.Name)
 		}
 	}
 	return ci, nil
@@ -0,0 +1,182 @@
+package candevice
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestBusDevice(t *testing.T) {
+	vb := canbus.NewVirtualBus("vbus0")
+	peer := vb.Open()
+	defer peer.Close()
+	dev := NewBusDevice(vb.Open())
+	defer dev.Close()
+	if err := dev.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	peer.Send(canbus.Frame{ID: 0x321, Data: []byte{0xAA}})
+	msg, err := dev.RecFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.CanStatstic.Update(time.Now())
+	if rx := dev.CanStatstic.Snapshot().RxFrameSum; msg.ID != 0x321 || rx != 1 {
+		t.Errorf("got %+v, rx frames %d", msg, rx)
+	}
+
+	if err := dev.SendFrame(canbus.Frame{ID: 0x10}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := peer.Recv(); err != nil || msg.ID != 0x10 {
+		t.Errorf("peer got %+v, %v", msg, err)
+	}
+	dev.CanStatstic.Update(time.Now())
+	if tx := dev.CanStatstic.Snapshot().TxFrameSum; tx != 1 {
+		t.Errorf("tx frames = %d, want 1", tx)
+	}
+}
+
+func TestStateHistory(t *testing.T) {
+	dev := NewBusDevice(canbus.NewVirtualBus("vbus0").Open())
+	defer dev.Close()
+	dev.CanParams.State = "ERROR-ACTIVE"
+
+	states := []string{"ERROR-ACTIVE", "ERROR-WARNING", "ERROR-WARNING", "ERROR-PASSIVE", "BUS-OFF", "ERROR-ACTIVE"}
+	changes := 0
+	for i, state := range states {
+		change := dev.updateState(canParameter{State: state, TxErrors: uint16(100 * i)})
+		if change != nil {
+			changes++
+			if change.From != states[max(i-1, 0)] || change.To != state || change.TxErrors != uint16(100*i) {
+				t.Errorf("change %d = %+v", i, change)
+			}
+		}
+	}
+	if changes != 4 || len(dev.StateHistory()) != 4 {
+		t.Fatalf("%d changes, history %d, want 4", changes, len(dev.StateHistory()))
+	}
+	if dev.CanParams.State != "ERROR-ACTIVE" || dev.CanParams.TxErrors != 500 {
+		t.Errorf("params = %+v", dev.CanParams)
+	}
+
+	for i := 0; i < stateHistoryLen; i++ {
+		dev.updateState(canParameter{State: states[i%2]})
+	}
+	history := dev.StateHistory()
+	if len(history) != stateHistoryLen || history[len(history)-1].To != states[(stateHistoryLen-1)%2] {
+		t.Errorf("history len %d, last %+v", len(history), history[len(history)-1])
+	}
+}
+
+// downBus fails like a socket on an interface that went down
+type downBus struct {
+	*canbus.VirtualEndpoint
+}
+
+func (downBus) Recv() (canbus.Frame, error) {
+	return canbus.Frame{}, syscall.ENETDOWN
+}
+
+func (downBus) Send(canbus.Frame) (int, error) {
+	return 0, syscall.ENODEV
+}
+
+func TestDisconnected(t *testing.T) {
+	dev := NewBusDevice(downBus{canbus.NewVirtualBus("vbus0").Open()})
+	defer dev.Close()
+	if dev.Disconnected() {
+		t.Fatal("disconnected before an error")
+	}
+	if _, err := dev.RecFrame(); !errors.Is(err, ErrDisconnected) || !errors.Is(err, syscall.ENETDOWN) {
+		t.Errorf("recv error = %v", err)
+	}
+	if !dev.Disconnected() {
+		t.Error("not disconnected after ENETDOWN")
+	}
+	if err := dev.SendFrame(canbus.Frame{ID: 0x10}); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("send error = %v", err)
+	}
+	if err := dev.Reconnect(); err == nil {
+		t.Error("reconnected a virtual bus")
+	}
+}
+
+// lostBus fails like the serial line of an unplugged adapter
+type lostBus struct {
+	*canbus.VirtualEndpoint
+}
+
+func (lostBus) Recv() (canbus.Frame, error) {
+	return canbus.Frame{}, syscall.EIO
+}
+
+func TestReopen(t *testing.T) {
+	vb := canbus.NewVirtualBus("vbus0")
+	peer := vb.Open()
+	defer peer.Close()
+	dev := NewBusDevice(lostBus{vb.Open()})
+	defer dev.Close()
+	dev.reopen = func() (canbus.Bus, error) {
+		return vb.Open(), nil
+	}
+	dev.SetFilter(&FilterSet{Rules: []Rule{{Enabled: true, IDs: []uint32{0x20}}}})
+
+	if _, err := dev.RecFrame(); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("recv error = %v", err)
+	}
+	if err := dev.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if dev.Disconnected() {
+		t.Error("disconnected after reconnect")
+	}
+	// the filter is installed on the new bus
+	peer.Send(canbus.Frame{ID: 0x10})
+	peer.Send(canbus.Frame{ID: 0x20})
+	if msg, err := dev.RecFrame(); err != nil || msg.ID != 0x20 {
+		t.Errorf("got %+v, %v", msg, err)
+	}
+
+	// frames sent by another goroutine while the bus is replaced
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := dev.SendFrame(canbus.Frame{ID: 0x30}); err != nil {
+				t.Errorf("send: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := dev.Reconnect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+func TestCyclic(t *testing.T) {
+	dev := NewBusDevice(canbus.NewVirtualBus("vbus0").Open())
+	defer dev.Close()
+	frame := canbus.Frame{ID: 0x10, Data: []byte{1}}
+	if err := dev.StartCyclic(frame, 0); err == nil || errors.Is(err, ErrNoBCM) {
+		t.Errorf("period 0: err = %v", err)
+	}
+	if err := dev.StartCyclic(frame, 10*time.Millisecond); !errors.Is(err, ErrNoBCM) {
+		t.Errorf("err = %v, want %v", err, ErrNoBCM)
+	}
+
+	// the looped back frames of the broadcast manager are counted as sent
+	dev.countRx(&canbus.Frame{ID: 0x10, Data: []byte{1}, Local: true})
+	dev.countRx(&canbus.Frame{ID: 0x20, Data: []byte{2}})
+	dev.CanStatstic.Update(time.Now())
+	if snap := dev.CanStatstic.Snapshot(); snap.TxFrameSum != 1 || snap.RxFrameSum != 1 {
+		t.Errorf("tx frames %d, rx frames %d, want 1, 1", snap.TxFrameSum, snap.RxFrameSum)
+	}
+}
@@ -0,0 +1,390 @@
+package candevice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// Rule of a software filter. A frame matches the rule if it matches all
+// conditions that are set: one of the IDs, ranges or masks, one of the
+// kinds, one of the data lengths and all data bytes.
+type Rule struct {
+	Enabled bool
+	Exclude bool             `json:",omitempty"` // drop instead of pass matching frames
+	Negate  bool             `json:",omitempty"` // match the frames the conditions do not match
+	IDs     []uint32         `json:",omitempty"`
+	Ranges  []canbus.IDRange `json:",omitempty"`
+	Masks   []IDMask         `json:",omitempty"`
+	Kinds   []canbus.Kind    `json:",omitempty"`
+	DLCs    []uint8          `json:",omitempty"` // data length codes
+	Data    []DataMatch      `json:",omitempty"`
+}
+
+// IDMask matches the IDs whose bits selected by Mask equal those of ID
+type IDMask struct {
+	ID   uint32
+	Mask uint32
+}
+
+// DataMatch matches the frames whose data byte at Index has the Value
+// in the bits selected by Mask
+type DataMatch struct {
+	Index int
+	Mask  uint8
+	Value uint8
+}
+
+// FilterSet is a named list of rules. The first enabled rule matching a
+// frame decides whether the frame passes. A frame no rule matches passes
+// only if no enabled rule includes frames.
+type FilterSet struct {
+	Name  string
+	Rules []Rule
+}
+
+// names of the frame kinds in the rule text
+var kindNames = []struct {
+	kind canbus.Kind
+	name string
+}{
+	{canbus.SFF, "SFF"},
+	{canbus.EFF, "EFF"},
+	{canbus.RTR_SFF, "RTR_SFF"},
+	{canbus.RTR_EFF, "RTR_EFF"},
+}
+
+// Match reports whether the frame matches the rule
+func (rule *Rule) Match(msg *canbus.Frame) bool {
+	return rule.matchConditions(msg) != rule.Negate
+}
+
+func (rule *Rule) matchConditions(msg *canbus.Frame) bool {
+	if !rule.matchID(msg.ID) {
+		return false
+	}
+	if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, msg.Kind) {
+		return false
+	}
+	if len(rule.DLCs) > 0 && !slices.Contains(rule.DLCs, msg.DLC()) {
+		return false
+	}
+	for _, dm := range rule.Data {
+		if dm.Index >= len(msg.Data) || msg.Data[dm.Index]&dm.Mask != dm.Value&dm.Mask {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule *Rule) matchID(id uint32) bool {
+	if len(rule.IDs) == 0 && len(rule.Ranges) == 0 && len(rule.Masks) == 0 {
+		return true
+	}
+	if slices.Contains(rule.IDs, id) {
+		return true
+	}
+	for _, r := range rule.Ranges {
+		if id >= r.Start && id <= r.End {
+			return true
+		}
+	}
+	for _, m := range rule.Masks {
+		if id&m.Mask == m.ID&m.Mask {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the set has an enabled rule
+func (fs *FilterSet) Active() bool {
+	return slices.ContainsFunc(fs.Rules, func(rule Rule) bool { return rule.Enabled })
+}
+
+// Match reports whether the frame passes the filter set
+func (fs *FilterSet) Match(msg *canbus.Frame) bool {
+	include := false
+	for i := range fs.Rules {
+		rule := &fs.Rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Match(msg) {
+			return !rule.Exclude
+		}
+		include = include || !rule.Exclude
+	}
+	return !include
+}
+
+// Clone returns a deep copy of the filter set
+func (fs *FilterSet) Clone() *FilterSet {
+	clone := &FilterSet{Name: fs.Name, Rules: slices.Clone(fs.Rules)}
+	for i := range clone.Rules {
+		rule := &clone.Rules[i]
+		rule.IDs = slices.Clone(rule.IDs)
+		rule.Ranges = slices.Clone(rule.Ranges)
+		rule.Masks = slices.Clone(rule.Masks)
+		rule.Kinds = slices.Clone(rule.Kinds)
+		rule.DLCs = slices.Clone(rule.DLCs)
+		rule.Data = slices.Clone(rule.Data)
+	}
+	return clone
+}
+
+// String returns the rule in one line, as shown in the filter list
+func (rule Rule) String() string {
+	text := "include"
+	if rule.Exclude {
+		text = "exclude"
+	}
+	if rule.Negate {
+		text += " not"
+	}
+	conds := []string{}
+	if s := rule.IDText(); s != "" {
+		conds = append(conds, "id "+s)
+	}
+	if s := rule.KindText(); s != "" {
+		conds = append(conds, "kind "+s)
+	}
+	if s := rule.DLCText(); s != "" {
+		conds = append(conds, "dlc "+s)
+	}
+	if s := rule.DataText(); s != "" {
+		conds = append(conds, "data "+s)
+	}
+	if len(conds) == 0 {
+		return text + " all"
+	}
+	return text + " " + strings.Join(conds, " ")
+}
+
+// IDText returns the IDs, ranges and masks of the rule as comma
+// separated hex values: 123,200-2FF,700/7F0
+func (rule *Rule) IDText() string {
+	var items []string
+	for _, id := range rule.IDs {
+		items = append(items, fmt.Sprintf("%X", id))
+	}
+	for _, r := range rule.Ranges {
+		items = append(items, fmt.Sprintf("%X-%X", r.Start, r.End))
+	}
+	for _, m := range rule.Masks {
+		items = append(items, fmt.Sprintf("%X/%X", m.ID, m.Mask))
+	}
+	return strings.Join(items, ",")
+}
+
+// SetIDs sets the IDs, ranges and masks of the rule from the text format
+// of IDText
+func (rule *Rule) SetIDs(s string) error {
+	var ids []uint32
+	var ranges []canbus.IDRange
+	var masks []IDMask
+	for _, item := range splitList(s) {
+		switch {
+		case strings.Contains(item, "-"):
+			start, end, _ := strings.Cut(item, "-")
+			r := canbus.IDRange{Start: parseHex32(start), End: parseHex32(end)}
+			if !validHex32(start) || !validHex32(end) || r.Start > r.End {
+				return fmt.Errorf("invalid ID range %q", item)
+			}
+			ranges = append(ranges, r)
+		case strings.Contains(item, "/"):
+			id, mask, _ := strings.Cut(item, "/")
+			if !validHex32(id) || !validHex32(mask) {
+				return fmt.Errorf("invalid ID mask %q", item)
+			}
+			masks = append(masks, IDMask{ID: parseHex32(id), Mask: parseHex32(mask)})
+		default:
+			if !validHex32(item) {
+				return fmt.Errorf("invalid ID %q", item)
+			}
+			ids = append(ids, parseHex32(item))
+		}
+	}
+	rule.IDs, rule.Ranges, rule.Masks = ids, ranges, masks
+	return nil
+}
+
+// KindText returns the frame kinds of the rule: SFF,RTR_SFF
+func (rule *Rule) KindText() string {
+	var items []string
+	for _, kind := range rule.Kinds {
+		for _, kn := range kindNames {
+			if kn.kind == kind {
+				items = append(items, kn.name)
+			}
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// SetKinds sets the frame kinds of the rule from the text format of
+// KindText
+func (rule *Rule) SetKinds(s string) error {
+	var kinds []canbus.Kind
+	for _, item := range splitList(s) {
+		found := false
+		for _, kn := range kindNames {
+			if strings.EqualFold(item, kn.name) {
+				kinds = append(kinds, kn.kind)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid frame kind %q", item)
+		}
+	}
+	rule.Kinds = kinds
+	return nil
+}
+
+// DLCText returns the data length codes of the rule: 0-3,8
+func (rule *Rule) DLCText() string {
+	var items []string
+	for i := 0; i < len(rule.DLCs); {
+		j := i
+		for j+1 < len(rule.DLCs) && rule.DLCs[j+1] == rule.DLCs[j]+1 {
+			j++
+		}
+		if j > i {
+			items = append(items, fmt.Sprintf("%d-%d", rule.DLCs[i], rule.DLCs[j]))
+		} else {
+			items = append(items, strconv.Itoa(int(rule.DLCs[i])))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ",")
+}
+
+// SetDLCs sets the data length codes of the rule from the text format of
+// DLCText
+func (rule *Rule) SetDLCs(s string) error {
+	var dlcs []uint8
+	for _, item := range splitList(s) {
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := strconv.ParseUint(first, 10, 4)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.ParseUint(last, 10, 4)
+		}
+		if err != nil || start > end {
+			return fmt.Errorf("invalid DLC %q", item)
+		}
+		for dlc := start; dlc <= end; dlc++ {
+			dlcs = append(dlcs, uint8(dlc))
+		}
+	}
+	slices.Sort(dlcs)
+	rule.DLCs = slices.Compact(dlcs)
+	return nil
+}
+
+// DataText returns the data byte matches of the rule as index=value or
+// index&mask=value with hex mask and value: 0=12,3&F0=A0
+func (rule *Rule) DataText() string {
+	var items []string
+	for _, dm := range rule.Data {
+		if dm.Mask == 0xFF {
+			items = append(items, fmt.Sprintf("%d=%02X", dm.Index, dm.Value))
+		} else {
+			items = append(items, fmt.Sprintf("%d&%02X=%02X", dm.Index, dm.Mask, dm.Value))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// SetData sets the data byte matches of the rule from the text format of
+// DataText
+func (rule *Rule) SetData(s string) error {
+	var data []DataMatch
+	for _, item := range splitList(s) {
+		left, value, ok := strings.Cut(item, "=")
+		index, mask, hasMask := strings.Cut(left, "&")
+		i, err := strconv.Atoi(index)
+		if !ok || err != nil || i < 0 || i >= canbus.MaxXLDataLen {
+			return fmt.Errorf("invalid data match %q", item)
+		}
+		dm := DataMatch{Index: i, Mask: 0xFF}
+		v, err := strconv.ParseUint(value, 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid data match %q", item)
+		}
+		dm.Value = uint8(v)
+		if hasMask {
+			m, err := strconv.ParseUint(mask, 16, 8)
+			if err != nil {
+				return fmt.Errorf("invalid data match %q", item)
+			}
+			dm.Mask = uint8(m)
+		}
+		data = append(data, dm)
+	}
+	rule.Data = data
+	return nil
+}
+
+// split a comma or space separated list
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func validHex32(s string) bool {
+	_, err := strconv.ParseUint(s, 16, 32)
+	return err == nil
+}
+
+func parseHex32(s string) uint32 {
+	v, _ := strconv.ParseUint(s, 16, 32)
+	return uint32(v)
+}
+
+// FilterSetsFile returns the file the named filter sets are saved in
+func FilterSetsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "socanui", "filters.json"), nil
+}
+
+// LoadFilterSets reads the named filter sets from a file, a missing file
+// has no sets
+func LoadFilterSets(path string) ([]FilterSet, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sets []FilterSet
+	err = json.Unmarshal(b, &sets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sets, nil
+}
+
+// SaveFilterSets writes the named filter sets to a file
+func SaveFilterSets(path string, sets []FilterSet) error {
+	b, err := json.MarshalIndent(sets, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
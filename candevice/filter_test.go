@@ -0,0 +1,124 @@
+package candevice
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestRuleText(t *testing.T) {
+	var rule Rule
+	if err := rule.SetIDs("123, 200-2ff,700/7F0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rule.SetKinds("sff,RTR_SFF"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rule.SetDLCs("8,0-3,2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rule.SetData("0=12 3&f0=A0"); err != nil {
+		t.Fatal(err)
+	}
+	rule.Exclude = true
+	want := "exclude id 123,200-2FF,700/7F0 kind SFF,RTR_SFF dlc 0-3,8 data 0=12,3&F0=A0"
+	if s := rule.String(); s != want {
+		t.Errorf("rule = %q, want %q", s, want)
+	}
+
+	for _, s := range []string{"12G", "300-200", "1/", "-5"} {
+		if err := rule.SetIDs(s); err == nil {
+			t.Errorf("SetIDs(%q) = nil", s)
+		}
+	}
+	if err := rule.SetKinds("ERR"); err == nil {
+		t.Error("SetKinds(ERR) = nil")
+	}
+	for _, s := range []string{"16", "5-3", "x"} {
+		if err := rule.SetDLCs(s); err == nil {
+			t.Errorf("SetDLCs(%q) = nil", s)
+		}
+	}
+	for _, s := range []string{"0", "0=100", "-1=1", "1&1FF=1"} {
+		if err := rule.SetData(s); err == nil {
+			t.Errorf("SetData(%q) = nil", s)
+		}
+	}
+}
+
+func TestFilterSetMatch(t *testing.T) {
+	rule := func(text string, exclude, negate bool) Rule {
+		r := Rule{Enabled: true, Exclude: exclude, Negate: negate}
+		if err := r.SetIDs(text); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	data := Rule{Enabled: true, Data: []DataMatch{{Index: 1, Mask: 0xF0, Value: 0x50}}, DLCs: []uint8{2}}
+
+	for _, tc := range []struct {
+		name  string
+		rules []Rule
+		pass  []uint32
+		drop  []uint32
+	}{
+		{"empty", nil, []uint32{0x000, 0x7FF}, nil},
+		{"include", []Rule{rule("100-1FF", false, false)}, []uint32{0x100, 0x1FF}, []uint32{0x0FF, 0x200}},
+		{"exclude", []Rule{rule("123,456", true, false)}, []uint32{0x124}, []uint32{0x123, 0x456}},
+		{"first match", []Rule{rule("150", true, false), rule("100-1FF", false, false)},
+			[]uint32{0x100, 0x151}, []uint32{0x150, 0x200}},
+		{"negate", []Rule{rule("700/700", false, true)}, []uint32{0x0FF}, []uint32{0x700, 0x7FF}},
+		{"disabled", []Rule{{IDs: []uint32{1}}}, []uint32{0, 1}, nil},
+	} {
+		fs := FilterSet{Rules: tc.rules}
+		for _, id := range tc.pass {
+			if !fs.Match(&canbus.Frame{ID: id}) {
+				t.Errorf("%s: %X dropped", tc.name, id)
+			}
+		}
+		for _, id := range tc.drop {
+			if fs.Match(&canbus.Frame{ID: id}) {
+				t.Errorf("%s: %X passed", tc.name, id)
+			}
+		}
+	}
+
+	fs := FilterSet{Rules: []Rule{data}}
+	for _, tc := range []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte{0x00, 0x5A}, true},
+		{[]byte{0x00, 0x6A}, false},
+		{[]byte{0x00}, false},
+		{[]byte{0x00, 0x5A, 0x00}, false},
+	} {
+		if got := fs.Match(&canbus.Frame{ID: 1, Data: tc.data}); got != tc.want {
+			t.Errorf("data %X: match = %v", tc.data, got)
+		}
+	}
+}
+
+func TestFilterSetsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socanui", "filters.json")
+	sets, err := LoadFilterSets(path)
+	if err != nil || sets != nil {
+		t.Fatalf("missing file: %v, %v", sets, err)
+	}
+	sets = []FilterSet{
+		{Name: "engine", Rules: []Rule{{Enabled: true, IDs: []uint32{0x100}, Kinds: []canbus.Kind{canbus.SFF}}}},
+		{Name: "no diag", Rules: []Rule{{Exclude: true, Ranges: []canbus.IDRange{{Start: 0x7E0, End: 0x7EF}}}}},
+	}
+	if err := SaveFilterSets(path, sets); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadFilterSets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sets) {
+		t.Errorf("loaded %+v, want %+v", got, sets)
+	}
+}
@@ -0,0 +1,196 @@
+package candevice
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// FilterPlace tells where a rule of the software filter is checked
+type FilterPlace uint8
+
+const (
+	FilterOff       FilterPlace = iota // rule disabled
+	FilterUserspace                    // checked for every received frame
+	FilterKernel                       // installed as CAN_RAW_FILTER on the socket
+	FilterBoth                         // kernel prefilter by ID and kind, checked again in userspace
+)
+
+func (place FilterPlace) String() string {
+	switch place {
+	case FilterUserspace:
+		return "user"
+	case FilterKernel:
+		return "kernel"
+	case FilterBoth:
+		return "kernel+user"
+	}
+	return "off"
+}
+
+// filterPlan is a filter set split into the kernel filters installed on
+// the socket and the check of the received frames in userspace
+type filterPlan struct {
+	set      *FilterSet
+	kernel   *canbus.FilterSet // nil passes all frames
+	software bool              // set.Match needed for the received frames
+	places   []FilterPlace     // of the rules
+}
+
+// compileFilter splits the filter set into kernel filters and userspace
+// checks. The kernel passes a superset of the frames the set passes:
+//   - with include rules the frames matching the ID and kind of any
+//     include rule; excluded frames and the data conditions are checked
+//     in userspace
+//   - with only exclude rules the frames matching none of the exclude
+//     rules with only ID and kind conditions, as joined inverted filters
+//
+// Negated rules, and include rules without an ID or kind condition, pass
+// all frames in the kernel.
+func compileFilter(fs *FilterSet) *filterPlan {
+	if fs == nil || !fs.Active() {
+		return &filterPlan{}
+	}
+	plan := &filterPlan{set: fs, places: make([]FilterPlace, len(fs.Rules))}
+
+	includes := false
+	for _, rule := range fs.Rules {
+		includes = includes || rule.Enabled && !rule.Exclude
+	}
+
+	var filters []canbus.Filter
+	prefilter := true // the kernel filters cover all rules of their kind
+	exact := true     // no userspace check needed
+	for i := range fs.Rules {
+		rule := &fs.Rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		plan.places[i] = FilterUserspace
+		if rule.Exclude && includes {
+			// the kernel filters are the include rules
+			exact = false
+			continue
+		}
+		rf, ok := rule.kernelFilters()
+		if !ok {
+			prefilter = prefilter && !includes
+			exact = false
+			continue
+		}
+		if !rule.idKindOnly() {
+			exact = false
+			if rule.Exclude {
+				// the kernel must not drop frames the data does not match
+				continue
+			}
+		}
+		if rule.Exclude {
+			for j := range rf {
+				rf[j] = rf[j].Inverted()
+			}
+		}
+		filters = append(filters, rf...)
+		plan.places[i] = FilterKernel
+	}
+
+	if !prefilter || len(filters) == 0 || len(filters) > unix.CAN_RAW_FILTER_MAX {
+		return userspaceFilter(fs)
+	}
+	plan.kernel = &canbus.FilterSet{Filters: filters, Join: !includes}
+	plan.software = !exact
+	if plan.software {
+		for i, place := range plan.places {
+			if place == FilterKernel {
+				plan.places[i] = FilterBoth
+			}
+		}
+	}
+	return plan
+}
+
+// userspaceFilter returns the plan to check all rules in userspace
+func userspaceFilter(fs *FilterSet) *filterPlan {
+	if fs == nil || !fs.Active() {
+		return &filterPlan{}
+	}
+	plan := &filterPlan{set: fs, software: true, places: make([]FilterPlace, len(fs.Rules))}
+	for i, rule := range fs.Rules {
+		if rule.Enabled {
+			plan.places[i] = FilterUserspace
+		}
+	}
+	return plan
+}
+
+// idKindOnly reports whether the rule has only ID and kind conditions
+func (rule *Rule) idKindOnly() bool {
+	return len(rule.DLCs) == 0 && len(rule.Data) == 0
+}
+
+// kernelFilters returns the kernel filters matching the IDs and kinds of
+// the rule, false if they can not be expressed or match all frames
+func (rule *Rule) kernelFilters() ([]canbus.Filter, bool) {
+	if rule.Negate {
+		return nil, false
+	}
+	type format struct {
+		format canbus.Format
+		rtr    canbus.RTRMatch
+	}
+	formats := []format{{canbus.AnyFormat, canbus.AnyRTR}}
+	if len(rule.Kinds) > 0 {
+		formats = formats[:0]
+		for _, kind := range rule.Kinds {
+			switch kind {
+			case canbus.SFF:
+				formats = append(formats, format{canbus.SFFOnly, canbus.DataOnly})
+			case canbus.EFF:
+				formats = append(formats, format{canbus.EFFOnly, canbus.DataOnly})
+			case canbus.RTR_SFF:
+				formats = append(formats, format{canbus.SFFOnly, canbus.RTROnly})
+			case canbus.RTR_EFF:
+				formats = append(formats, format{canbus.EFFOnly, canbus.RTROnly})
+			default:
+				return nil, false
+			}
+		}
+	}
+	allIDs := len(rule.IDs) == 0 && len(rule.Ranges) == 0 && len(rule.Masks) == 0
+	if allIDs && len(rule.Kinds) == 0 {
+		return nil, false
+	}
+
+	var filters []canbus.Filter
+	for _, f := range formats {
+		// the ID bits beyond the format can not match
+		idMask := uint32(unix.CAN_EFF_MASK)
+		if f.format == canbus.SFFOnly {
+			idMask = unix.CAN_SFF_MASK
+		}
+		add := func(filter canbus.Filter) {
+			filters = append(filters, filter.WithRTR(f.rtr))
+		}
+		if allIDs {
+			add(canbus.MaskID(0, 0, f.format))
+		}
+		for _, id := range rule.IDs {
+			if id&^idMask == 0 {
+				add(canbus.ExactID(id, f.format))
+			}
+		}
+		for _, r := range rule.Ranges {
+			if r.Start&^idMask == 0 {
+				for _, filter := range canbus.RangeID(r.Start, r.End, f.format) {
+					add(filter)
+				}
+			}
+		}
+		for _, m := range rule.Masks {
+			if m.ID&m.Mask&^idMask == 0 {
+				add(canbus.MaskID(m.ID, m.Mask, f.format))
+			}
+		}
+	}
+	return filters, true
+}
@@ -0,0 +1,135 @@
+package candevice
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestCompileFilter(t *testing.T) {
+	rule := func(ids, kinds string, exclude bool) Rule {
+		r := Rule{Enabled: true, Exclude: exclude}
+		if err := r.SetIDs(ids); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SetKinds(kinds); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	data := rule("300", "", false)
+	data.Data = []DataMatch{{Index: 0, Mask: 0xFF, Value: 0x11}}
+	negate := rule("123", "", false)
+	negate.Negate = true
+	disabled := rule("400", "", false)
+	disabled.Enabled = false
+
+	tests := []struct {
+		name     string
+		rules    []Rule
+		kernel   bool
+		join     bool
+		software bool
+		places   []FilterPlace
+	}{
+		{"include", []Rule{rule("123,200-2FF", "", false), rule("7E0/7F0", "SFF", false), disabled},
+			true, false, false, []FilterPlace{FilterKernel, FilterKernel, FilterOff}},
+		{"include data", []Rule{rule("123", "", false), data},
+			true, false, true, []FilterPlace{FilterBoth, FilterBoth}},
+		{"mixed", []Rule{rule("120", "", true), rule("100-1FF", "", false)},
+			true, false, true, []FilterPlace{FilterUserspace, FilterBoth}},
+		{"exclude", []Rule{rule("123", "", true), rule("", "RTR_SFF,RTR_EFF", true)},
+			true, true, false, []FilterPlace{FilterKernel, FilterKernel}},
+		{"exclude data", []Rule{rule("123", "", true), {Enabled: true, Exclude: true, DLCs: []uint8{0}}},
+			true, true, true, []FilterPlace{FilterBoth, FilterUserspace}},
+		{"negate", []Rule{rule("123", "", false), negate},
+			false, false, true, []FilterPlace{FilterUserspace, FilterUserspace}},
+		{"include all", []Rule{rule("123", "", true), rule("", "", false)},
+			false, false, true, []FilterPlace{FilterUserspace, FilterUserspace}},
+	}
+
+	frames := []canbus.Frame{
+		{ID: 0x120, Data: []byte{0x11}},
+		{ID: 0x123, Data: []byte{0x22}},
+		{ID: 0x123, Kind: canbus.RTR_SFF},
+		{ID: 0x123, Kind: canbus.EFF},
+		{ID: 0x250},
+		{ID: 0x300, Data: []byte{0x11}},
+		{ID: 0x300, Data: []byte{0x12}},
+		{ID: 0x400},
+		{ID: 0x7E5},
+		{ID: 0x7E5, Kind: canbus.EFF},
+		{ID: 0x1ABCDEF, Kind: canbus.RTR_EFF},
+	}
+
+	for _, test := range tests {
+		fs := &FilterSet{Rules: test.rules}
+		plan := compileFilter(fs)
+		if (plan.kernel != nil) != test.kernel || plan.software != test.software {
+			t.Errorf("%s: kernel %v, software %v", test.name, plan.kernel, plan.software)
+			continue
+		}
+		if plan.kernel != nil && plan.kernel.Join != test.join {
+			t.Errorf("%s: join = %v", test.name, plan.kernel.Join)
+		}
+		if !reflect.DeepEqual(plan.places, test.places) {
+			t.Errorf("%s: places = %v, want %v", test.name, plan.places, test.places)
+		}
+		// the kernel passes all frames of the set, and only those without
+		// a userspace check
+		for _, f := range frames {
+			want := fs.Match(&f)
+			kernel := plan.kernel == nil || plan.kernel.Match(f)
+			if want && !kernel {
+				t.Errorf("%s: kernel drops %+v", test.name, f)
+			}
+			if !plan.software && kernel != want {
+				t.Errorf("%s: kernel passes %+v", test.name, f)
+			}
+		}
+	}
+
+	if plan := compileFilter(&FilterSet{Rules: []Rule{disabled}}); plan.kernel != nil || plan.software {
+		t.Errorf("disabled set: %+v", plan)
+	}
+}
+
+func TestSetFilter(t *testing.T) {
+	vb := canbus.NewVirtualBus("vbus0")
+	peer := vb.Open()
+	defer peer.Close()
+	dev := NewBusDevice(vb.Open())
+	defer dev.Close()
+	if err := dev.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &FilterSet{Rules: []Rule{{Enabled: true, IDs: []uint32{0x10}}, {Enabled: true, IDs: []uint32{0x30}}}}
+	if err := dev.SetFilter(fs); err != nil {
+		t.Fatal(err)
+	}
+	if !dev.FilterActive() || !reflect.DeepEqual(dev.FilterPlaces(), []FilterPlace{FilterKernel, FilterKernel}) {
+		t.Errorf("active %v, places %v", dev.FilterActive(), dev.FilterPlaces())
+	}
+	for id := uint32(0x10); id <= 0x40; id += 0x10 {
+		peer.Send(canbus.Frame{ID: id})
+	}
+	for _, want := range []uint32{0x10, 0x30} {
+		msg, err := dev.RecFrame()
+		if err != nil || msg.ID != want || !dev.Accept(&msg) {
+			t.Errorf("got %+v, %v, want ID %X", msg, err, want)
+		}
+	}
+
+	if err := dev.SetFilter(nil); err != nil {
+		t.Fatal(err)
+	}
+	peer.Send(canbus.Frame{ID: 0x20})
+	if msg, err := dev.RecFrame(); err != nil || msg.ID != 0x20 {
+		t.Errorf("got %+v, %v after reset", msg, err)
+	}
+	if dev.FilterActive() {
+		t.Error("filter active after reset")
+	}
+}
@@ -0,0 +1,153 @@
+package candevice
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// control modes of a CAN controller
+const (
+	CtrlLoopback       = unix.CAN_CTRLMODE_LOOPBACK
+	CtrlListenOnly     = unix.CAN_CTRLMODE_LISTENONLY
+	CtrlTripleSampling = unix.CAN_CTRLMODE_3_SAMPLES
+	CtrlOneShot        = unix.CAN_CTRLMODE_ONE_SHOT
+	CtrlBerrReporting  = unix.CAN_CTRLMODE_BERR_REPORTING
+	CtrlFD             = unix.CAN_CTRLMODE_FD
+)
+
+// LinkConfig holds the CAN parameters to change on an interface, nil
+// fields and control modes outside of CtrlMask are left unchanged
+type LinkConfig struct {
+	Timing     *BitTiming // Bitrate with an optional SamplePoint, or Tq with the segments
+	DataTiming *BitTiming // CAN FD data phase, like Timing
+	CtrlMask   uint32     // control modes to change
+	CtrlMode   uint32     // new values of the control modes in CtrlMask
+	RestartMs  *uint32    // automatic restart delay after bus-off, 0 disables
+}
+
+// attrs returns the IFLA_LINKINFO attribute with the configuration
+func (cfg *LinkConfig) attrs() []byte {
+	var data []byte
+	if cfg.Timing != nil {
+		data = appendAttr(data, unix.IFLA_CAN_BITTIMING, encodeBitTiming(*cfg.Timing))
+	}
+	if cfg.DataTiming != nil {
+		data = appendAttr(data, unix.IFLA_CAN_DATA_BITTIMING, encodeBitTiming(*cfg.DataTiming))
+	}
+	if cfg.CtrlMask != 0 {
+		// struct can_ctrlmode: mask, flags
+		cm := make([]byte, 0, 8)
+		cm = binary.NativeEndian.AppendUint32(cm, cfg.CtrlMask)
+		cm = binary.NativeEndian.AppendUint32(cm, cfg.CtrlMode&cfg.CtrlMask)
+		data = appendAttr(data, unix.IFLA_CAN_CTRLMODE, cm)
+	}
+	if cfg.RestartMs != nil {
+		data = appendU32Attr(data, unix.IFLA_CAN_RESTART_MS, *cfg.RestartMs)
+	}
+	return canLinkInfo(data)
+}
+
+// canLinkInfo returns the IFLA_LINKINFO attribute of kind can with the
+// IFLA_CAN_* attributes in data
+func canLinkInfo(data []byte) []byte {
+	info := appendAttr(nil, unix.IFLA_INFO_KIND, []byte("can"))
+	info = appendAttr(info, unix.IFLA_INFO_DATA|unix.NLA_F_NESTED, data)
+	return appendAttr(nil, unix.IFLA_LINKINFO|unix.NLA_F_NESTED, info)
+}
+
+// encodeBitTiming returns a struct can_bittiming. The kernel calculates
+// the timing from the bitrate, unless Tq is set for an explicit timing.
+func encodeBitTiming(bt BitTiming) []byte {
+	b := make([]byte, 0, 32)
+	if bt.Tq != 0 {
+		b = binary.NativeEndian.AppendUint32(b, 0)
+		b = binary.NativeEndian.AppendUint32(b, 0)
+		b = binary.NativeEndian.AppendUint32(b, uint32(bt.Tq))
+		b = binary.NativeEndian.AppendUint32(b, bt.PropSeg)
+		b = binary.NativeEndian.AppendUint32(b, bt.PhaseSeg1)
+		b = binary.NativeEndian.AppendUint32(b, bt.PhaseSeg2)
+		b = binary.NativeEndian.AppendUint32(b, bt.Sjw)
+		return binary.NativeEndian.AppendUint32(b, 0)
+	}
+	b = binary.NativeEndian.AppendUint32(b, uint32(bt.Bitrate))
+	b = binary.NativeEndian.AppendUint32(b, uint32(math.Round(bt.SamplePoint*1000)))
+	return append(b, make([]byte, 24)...)
+}
+
+// link index and up state of the interface to configure
+func (candevice *CanDevice) link() (int, bool, error) {
+	inf, err := net.InterfaceByName(candevice.TxInf())
+	if err != nil {
+		return 0, false, err
+	}
+	return inf.Index, inf.Flags&net.FlagUp != 0, nil
+}
+
+// Configure changes the CAN parameters of the interface. The link is
+// taken down for the change and brought up again if it was up.
+func (candevice *CanDevice) Configure(cfg LinkConfig) error {
+	index, up, err := candevice.link()
+	if err != nil {
+		return err
+	}
+	if up {
+		err = setLink(index, 0, unix.IFF_UP, nil)
+		if err != nil {
+			return fmt.Errorf("set link down: %w", err)
+		}
+	}
+	err = setLink(index, 0, 0, cfg.attrs())
+	if err != nil {
+		err = fmt.Errorf("configure link: %w", err)
+	}
+	if up {
+		// bring the link up again, also with an invalid configuration
+		if uerr := setLink(index, unix.IFF_UP, unix.IFF_UP, nil); uerr != nil && err == nil {
+			err = fmt.Errorf("set link up: %w", uerr)
+		}
+	}
+	candevice.UpdateParams()
+	return err
+}
+
+// SetLinkUp brings the interface up or down
+func (candevice *CanDevice) SetLinkUp(up bool) error {
+	index, _, err := candevice.link()
+	if err != nil {
+		return err
+	}
+	var flags uint32
+	if up {
+		flags = unix.IFF_UP
+	}
+	err = setLink(index, flags, unix.IFF_UP, nil)
+	candevice.UpdateParams()
+	return err
+}
+
+// Restart restarts the CAN controller after bus-off
+func (candevice *CanDevice) Restart() error {
+	index, _, err := candevice.link()
+	if err != nil {
+		return err
+	}
+	err = setLink(index, 0, 0, canLinkInfo(appendU32Attr(nil, unix.IFLA_CAN_RESTART, 1)))
+	candevice.UpdateParams()
+	return err
+}
+
+// UpdateParams reads the CAN parameters of the interface again
+func (candevice *CanDevice) UpdateParams() error {
+	link, err := getLink(candevice.TxInf())
+	if err != nil {
+		return err
+	}
+	*candevice.CanParams = link.Params
+	candevice.setBitrates()
+	candevice.CanStatstic.setLink(link.Params.LinkStats)
+	return nil
+}
@@ -0,0 +1,382 @@
+package candevice
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// BitTiming is the bit timing of the arbitration or the data phase
+type BitTiming struct {
+	Bitrate     uint64
+	SamplePoint float64 // 0.875 for 87.5%
+	Tq          uint64  // time quantum in ns
+	PropSeg     uint32
+	PhaseSeg1   uint32
+	PhaseSeg2   uint32
+	Sjw         uint32
+	Brp         uint32
+}
+
+// network interface as reported by rtnetlink
+type canLink struct {
+	Index  int
+	Name   string
+	Kind   string // link kind: can, vcan, vxcan, empty for other drivers
+	Type   uint16 // ARPHRD_* device type
+	Flags  uint32 // IFF_* flags
+	Params canParameter
+}
+
+// isCAN reports whether the link is a CAN interface
+func (link *canLink) isCAN() bool {
+	return link.Type == unix.ARPHRD_CAN
+}
+
+// isVirtual reports whether the link is a virtual CAN interface
+func (link *canLink) isVirtual() bool {
+	return link.Kind == "vcan" || link.Kind == "vxcan"
+}
+
+// names of the CAN_CTRLMODE_* flags as printed by iproute2
+var ctrlModeNames = []struct {
+	flag uint32
+	name string
+}{
+	{unix.CAN_CTRLMODE_LOOPBACK, "LOOPBACK"},
+	{unix.CAN_CTRLMODE_LISTENONLY, "LISTEN-ONLY"},
+	{unix.CAN_CTRLMODE_3_SAMPLES, "TRIPLE-SAMPLING"},
+	{unix.CAN_CTRLMODE_ONE_SHOT, "ONE-SHOT"},
+	{unix.CAN_CTRLMODE_BERR_REPORTING, "BERR-REPORTING"},
+	{unix.CAN_CTRLMODE_FD, "FD"},
+	{unix.CAN_CTRLMODE_PRESUME_ACK, "PRESUME-ACK"},
+	{unix.CAN_CTRLMODE_FD_NON_ISO, "FD-NON-ISO"},
+	{unix.CAN_CTRLMODE_CC_LEN8_DLC, "CC-LEN8-DLC"},
+	{unix.CAN_CTRLMODE_TDC_AUTO, "TDC-AUTO"},
+	{unix.CAN_CTRLMODE_TDC_MANUAL, "TDC-MANUAL"},
+}
+
+// names of the CAN_STATE_* values as printed by iproute2
+var stateNames = []string{
+	unix.CAN_STATE_ERROR_ACTIVE:  "ERROR-ACTIVE",
+	unix.CAN_STATE_ERROR_WARNING: "ERROR-WARNING",
+	unix.CAN_STATE_ERROR_PASSIVE: "ERROR-PASSIVE",
+	unix.CAN_STATE_BUS_OFF:       "BUS-OFF",
+	unix.CAN_STATE_STOPPED:       "STOPPED",
+	unix.CAN_STATE_SLEEPING:      "SLEEPING",
+}
+
+// ctrlModeList returns the names of the flags set in mode
+func ctrlModeList(mode uint32) []string {
+	var list []string
+	for _, cm := range ctrlModeNames {
+		if mode&cm.flag != 0 {
+			list = append(list, cm.name)
+		}
+	}
+	return list
+}
+
+// stateName returns the name of the CAN state
+func stateName(state uint32) string {
+	if int(state) < len(stateNames) {
+		return stateNames[state]
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", state)
+}
+
+// netlinkDial opens a rtnetlink socket
+func netlinkDial() (int, *unix.SockaddrNetlink, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return -1, nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	sa := &unix.SockaddrNetlink{Family: unix.AF_NETLINK}
+	err = unix.Bind(fd, sa)
+	if err != nil {
+		unix.Close(fd)
+		return -1, nil, fmt.Errorf("netlink bind: %w", err)
+	}
+	return fd, sa, nil
+}
+
+// netlinkMessage returns a netlink message with the header and body
+func netlinkMessage(typ, flags uint16, body []byte) []byte {
+	msg := make([]byte, unix.NLMSG_HDRLEN, unix.NLMSG_HDRLEN+len(body))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.NLMSG_HDRLEN+len(body)))
+	binary.NativeEndian.PutUint16(msg[4:6], typ)
+	binary.NativeEndian.PutUint16(msg[6:8], flags)
+	binary.NativeEndian.PutUint32(msg[8:12], 1)
+	return append(msg, body...)
+}
+
+// getLinks requests all network interfaces over rtnetlink
+func getLinks() ([]canLink, error) {
+	fd, sa, err := netlinkDial()
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	// RTM_GETLINK dump request with an empty ifinfomsg
+	req := netlinkMessage(unix.RTM_GETLINK, unix.NLM_F_REQUEST|unix.NLM_F_DUMP, make([]byte, unix.SizeofIfInfomsg))
+	err = unix.Sendto(fd, req, 0, sa)
+	if err != nil {
+		return nil, fmt.Errorf("netlink request: %w", err)
+	}
+
+	var links []canLink
+	buf := make([]byte, 8*os.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("netlink receive: %w", err)
+		}
+		var done bool
+		links, done, err = parseLinkMessages(buf[:n], links)
+		if err != nil || done {
+			return links, err
+		}
+	}
+}
+
+// setLink sends a RTM_NEWLINK request for the interface and waits for
+// the acknowledgement; flags and change are the IFF_* flags to set
+func setLink(index int, flags, change uint32, attrs []byte) error {
+	fd, sa, err := netlinkDial()
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	req := netlinkMessage(unix.RTM_NEWLINK, unix.NLM_F_REQUEST|unix.NLM_F_ACK, ifInfoMsg(index, flags, change, attrs))
+	err = unix.Sendto(fd, req, 0, sa)
+	if err != nil {
+		return fmt.Errorf("netlink request: %w", err)
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("netlink receive: %w", err)
+		}
+		_, done, err := parseLinkMessages(buf[:n], nil)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// ifInfoMsg returns an ifinfomsg followed by the attributes
+func ifInfoMsg(index int, flags, change uint32, attrs []byte) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg, unix.SizeofIfInfomsg+len(attrs))
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	binary.NativeEndian.PutUint32(b[12:16], change)
+	return append(b, attrs...)
+}
+
+// appendAttr appends a netlink attribute with padding
+func appendAttr(b []byte, typ uint16, data []byte) []byte {
+	l := unix.SizeofNlAttr + len(data)
+	b = binary.NativeEndian.AppendUint16(b, uint16(l))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, data...)
+	for ; l%unix.NLA_ALIGNTO != 0; l++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// appendU32Attr appends a netlink attribute with an u32 value
+func appendU32Attr(b []byte, typ uint16, v uint32) []byte {
+	return appendAttr(b, typ, binary.NativeEndian.AppendUint32(nil, v))
+}
+
+// getLink returns the network interface with the name
+func getLink(name string) (*canLink, error) {
+	links, err := getLinks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		if links[i].Name == name {
+			return &links[i], nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found", name)
+}
+
+// parseLinkMessages appends the links of the RTM_NEWLINK messages in b,
+// done is set at the end of the dump
+func parseLinkMessages(b []byte, links []canLink) (_ []canLink, done bool, err error) {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return links, false, fmt.Errorf("netlink message: %w", err)
+	}
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.NLMSG_DONE:
+			return links, true, nil
+		case unix.NLMSG_ERROR:
+			if len(m.Data) < 4 {
+				return links, true, errors.New("netlink error message too short")
+			}
+			errno := -int32(binary.NativeEndian.Uint32(m.Data[:4]))
+			if errno == 0 {
+				// acknowledgement of a request
+				return links, true, nil
+			}
+			return links, true, fmt.Errorf("netlink: %w", syscall.Errno(errno))
+		case unix.RTM_NEWLINK:
+			link, err := parseLink(m.Data)
+			if err != nil {
+				return links, false, err
+			}
+			links = append(links, link)
+		}
+	}
+	return links, false, nil
+}
+
+// parseLink parses an ifinfomsg with its attributes
+func parseLink(b []byte) (canLink, error) {
+	var link canLink
+	if len(b) < unix.SizeofIfInfomsg {
+		return link, errors.New("netlink ifinfomsg too short")
+	}
+	link.Type = binary.NativeEndian.Uint16(b[2:4])
+	link.Index = int(int32(binary.NativeEndian.Uint32(b[4:8])))
+	link.Flags = binary.NativeEndian.Uint32(b[8:12])
+
+	attrs := parseAttrs(b[unix.SizeofIfInfomsg:])
+	link.Name = strings.TrimRight(string(attrs[unix.IFLA_IFNAME]), "\x00")
+	info := parseAttrs(attrs[unix.IFLA_LINKINFO])
+	link.Kind = strings.TrimRight(string(info[unix.IFLA_INFO_KIND]), "\x00")
+	link.Params.Kind = link.Kind
+	link.Params.LinkStats = parseLinkStats(attrs[unix.IFLA_STATS64])
+	if link.Kind == "can" {
+		parseCanInfo(parseAttrs(info[unix.IFLA_INFO_DATA]), &link.Params)
+		link.Params.Stats = parseDeviceStats(info[unix.IFLA_INFO_XSTATS])
+	}
+	return link, nil
+}
+
+// parseCanInfo fills the parameter with the IFLA_CAN_* attributes
+func parseCanInfo(attrs map[uint16][]byte, params *canParameter) {
+	u32 := func(b []byte, i int) uint32 {
+		if len(b) < 4*(i+1) {
+			return 0
+		}
+		return binary.NativeEndian.Uint32(b[4*i:])
+	}
+	if b, ok := attrs[unix.IFLA_CAN_BITTIMING]; ok {
+		params.BitTiming = parseBitTiming(b)
+	}
+	if b, ok := attrs[unix.IFLA_CAN_DATA_BITTIMING]; ok {
+		params.DataTiming = parseBitTiming(b)
+	}
+	if b, ok := attrs[unix.IFLA_CAN_CLOCK]; ok {
+		params.Clock = u32(b, 0)
+	}
+	if b, ok := attrs[unix.IFLA_CAN_STATE]; ok {
+		params.State = stateName(u32(b, 0))
+	}
+	if b, ok := attrs[unix.IFLA_CAN_CTRLMODE]; ok {
+		// struct can_ctrlmode: mask, flags
+		params.CtrlMode = u32(b, 1)
+		params.Mode = ctrlModeList(params.CtrlMode)
+	}
+	if b, ok := attrs[unix.IFLA_CAN_RESTART_MS]; ok {
+		params.RestartTime = uint64(u32(b, 0))
+	}
+	if b, ok := attrs[unix.IFLA_CAN_BERR_COUNTER]; ok && len(b) >= 4 {
+		// struct can_berr_counter: txerr, rxerr
+		params.TxErrors = binary.NativeEndian.Uint16(b[0:2])
+		params.RxErrors = binary.NativeEndian.Uint16(b[2:4])
+	}
+}
+
+// parseLinkStats parses the first fields of a struct rtnl_link_stats64
+func parseLinkStats(b []byte) LinkStats {
+	var v [8]uint64
+	for i := range v {
+		if len(b) >= 8*(i+1) {
+			v[i] = binary.NativeEndian.Uint64(b[8*i:])
+		}
+	}
+	return LinkStats{
+		RxPackets: v[0],
+		TxPackets: v[1],
+		RxBytes:   v[2],
+		TxBytes:   v[3],
+		RxErrors:  v[4],
+		TxErrors:  v[5],
+		RxDropped: v[6],
+		TxDropped: v[7],
+	}
+}
+
+// parseDeviceStats parses a struct can_device_stats
+func parseDeviceStats(b []byte) DeviceStats {
+	var v [6]uint32
+	for i := range v {
+		if len(b) >= 4*(i+1) {
+			v[i] = binary.NativeEndian.Uint32(b[4*i:])
+		}
+	}
+	return DeviceStats{
+		BusError:        v[0],
+		ErrorWarning:    v[1],
+		ErrorPassive:    v[2],
+		BusOff:          v[3],
+		ArbitrationLost: v[4],
+		Restarts:        v[5],
+	}
+}
+
+// parseBitTiming parses a struct can_bittiming
+func parseBitTiming(b []byte) BitTiming {
+	var v [8]uint32
+	for i := range v {
+		if len(b) >= 4*(i+1) {
+			v[i] = binary.NativeEndian.Uint32(b[4*i:])
+		}
+	}
+	return BitTiming{
+		Bitrate:     uint64(v[0]),
+		SamplePoint: float64(v[1]) / 1000,
+		Tq:          uint64(v[2]),
+		PropSeg:     v[3],
+		PhaseSeg1:   v[4],
+		PhaseSeg2:   v[5],
+		Sjw:         v[6],
+		Brp:         v[7],
+	}
+}
+
+// parseAttrs returns the netlink attributes in b by type, the nested and
+// byte order flags are removed from the type
+func parseAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= unix.SizeofNlAttr {
+		l := int(binary.NativeEndian.Uint16(b[0:2]))
+		typ := binary.NativeEndian.Uint16(b[2:4]) &^ (unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+		if l < unix.SizeofNlAttr || l > len(b) {
+			break
+		}
+		attrs[typ] = b[unix.SizeofNlAttr:l]
+		l = (l + unix.NLA_ALIGNTO - 1) &^ (unix.NLA_ALIGNTO - 1)
+		if l > len(b) {
+			break
+		}
+		b = b[l:]
+	}
+	return attrs
+}
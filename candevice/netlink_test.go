@@ -0,0 +1,155 @@
+package candevice
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// RTM_NEWLINK dump of a can0 with CAN FD bit timing, a vcan0 and lo
+const linkDump = "" +
+	"1801000010000200010000009210000000001801050000004100010000000000" +
+	"0900030063616e300000000008000d000a000000050010000000000008000400" +
+	"48000000d40012800800010063616e00ac0002802400010020a107006b030000" +
+	"1900000022000000230000000a0000000100000001000000340002006d637032" +
+	"3531786664000000000000000200000000010000010000000001000080000000" +
+	"01000000000100000100000008000300005a620208000400010000000c000500" +
+	"ff0700003000000008000600640000000800080061000c002400090080841e00" +
+	"ee0200001900000007000000070000000500000001000000010000001c000300" +
+	"0700000003000000020000000100000004000000010000005400000010000200" +
+	"01000000921000000000180106000000c1400000000000000a0003007663616e" +
+	"3000000008000d000a0000000500100000000000080004004800000010001280" +
+	"090001007663616e000000004000000010000200010000009210000000000403" +
+	"010000004900010000000000070003006c6f000008000d000a00000005001000" +
+	"000000000800040010000000"
+
+// NLMSG_DONE at the end of the dump
+const linkDone = "1400000003000200010000009210000000000000"
+
+// NLMSG_ERROR with -ENODEV
+const linkError = "24000000020000000100000092100000edffffff20000000120001000100000092100000"
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseLinkMessages(t *testing.T) {
+	links, done, err := parseLinkMessages(decodeHex(t, linkDump), nil)
+	if err != nil || done {
+		t.Fatalf("done %v, err %v", done, err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("got %d links, want 3", len(links))
+	}
+	links, done, err = parseLinkMessages(decodeHex(t, linkDone), links)
+	if err != nil || !done || len(links) != 3 {
+		t.Fatalf("done %v, err %v, %d links", done, err, len(links))
+	}
+
+	can0, vcan0, lo := links[0], links[1], links[2]
+	if can0.Name != "can0" || can0.Index != 5 || !can0.isCAN() || can0.isVirtual() {
+		t.Errorf("can0: %+v", can0)
+	}
+	want := canParameter{
+		Kind:        "can",
+		Mode:        []string{"BERR-REPORTING", "FD"},
+		CtrlMode:    0x30,
+		State:       "ERROR-WARNING",
+		RestartTime: 100,
+		Clock:       40000000,
+		TxErrors:    97,
+		RxErrors:    12,
+		Stats: DeviceStats{
+			BusError: 7, ErrorWarning: 3, ErrorPassive: 2,
+			BusOff: 1, ArbitrationLost: 4, Restarts: 1,
+		},
+		BitTiming: BitTiming{
+			Bitrate: 500000, SamplePoint: 0.875, Tq: 25,
+			PropSeg: 34, PhaseSeg1: 35, PhaseSeg2: 10, Sjw: 1, Brp: 1,
+		},
+		DataTiming: BitTiming{
+			Bitrate: 2000000, SamplePoint: 0.75, Tq: 25,
+			PropSeg: 7, PhaseSeg1: 7, PhaseSeg2: 5, Sjw: 1, Brp: 1,
+		},
+	}
+	if !reflect.DeepEqual(can0.Params, want) {
+		t.Errorf("can0 params:\n got %+v\nwant %+v", can0.Params, want)
+	}
+	if vcan0.Name != "vcan0" || vcan0.Kind != "vcan" || !vcan0.isCAN() || !vcan0.isVirtual() {
+		t.Errorf("vcan0: %+v", vcan0)
+	}
+	if lo.Name != "lo" || lo.isCAN() || lo.Kind != "" {
+		t.Errorf("lo: %+v", lo)
+	}
+}
+
+func TestParseLinkError(t *testing.T) {
+	_, done, err := parseLinkMessages(decodeHex(t, linkError), nil)
+	if !done || !errors.Is(err, syscall.ENODEV) {
+		t.Errorf("done %v, err %v, want %v", done, err, syscall.ENODEV)
+	}
+}
+
+func TestLinkConfigAttrs(t *testing.T) {
+	restart := uint32(200)
+	cfg := LinkConfig{
+		Timing:     &BitTiming{Bitrate: 250000, SamplePoint: 0.8},
+		DataTiming: &BitTiming{Tq: 25, PropSeg: 7, PhaseSeg1: 7, PhaseSeg2: 5, Sjw: 1},
+		CtrlMask:   CtrlListenOnly | CtrlFD | CtrlOneShot,
+		CtrlMode:   CtrlListenOnly | CtrlFD | CtrlLoopback,
+		RestartMs:  &restart,
+	}
+	// parse the request like the link messages of the kernel
+	info := parseAttrs(parseAttrs(cfg.attrs())[unix.IFLA_LINKINFO])
+	if kind := string(info[unix.IFLA_INFO_KIND]); kind != "can" {
+		t.Fatalf("kind = %q, want can", kind)
+	}
+	data := parseAttrs(info[unix.IFLA_INFO_DATA])
+	var got canParameter
+	parseCanInfo(data, &got)
+
+	if got.Bitrate != 250000 || got.SamplePoint != 0.8 || got.Tq != 0 {
+		t.Errorf("timing = %+v", got.BitTiming)
+	}
+	wantData := BitTiming{Tq: 25, PropSeg: 7, PhaseSeg1: 7, PhaseSeg2: 5, Sjw: 1}
+	if got.DataTiming != wantData {
+		t.Errorf("data timing = %+v, want %+v", got.DataTiming, wantData)
+	}
+	if mask := binary.NativeEndian.Uint32(data[unix.IFLA_CAN_CTRLMODE]); mask != cfg.CtrlMask {
+		t.Errorf("ctrlmode mask = %#x, want %#x", mask, cfg.CtrlMask)
+	}
+	if got.CtrlMode != CtrlListenOnly|CtrlFD {
+		t.Errorf("ctrlmode = %#x, want %#x", got.CtrlMode, CtrlListenOnly|CtrlFD)
+	}
+	if got.RestartTime != 200 {
+		t.Errorf("restart-ms = %d, want 200", got.RestartTime)
+	}
+
+	if attrs := (&LinkConfig{}).attrs(); len(parseAttrs(parseAttrs(parseAttrs(attrs)[unix.IFLA_LINKINFO])[unix.IFLA_INFO_DATA])) != 0 {
+		t.Errorf("empty config has CAN attributes")
+	}
+}
+
+func TestParseLinkStats(t *testing.T) {
+	b := make([]byte, 0, 24*8)
+	for i := uint64(1); i <= 24; i++ {
+		b = binary.NativeEndian.AppendUint64(b, i)
+	}
+	want := LinkStats{1, 2, 3, 4, 5, 6, 7, 8}
+	if got := parseLinkStats(b); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if got := parseLinkStats(nil); got != (LinkStats{}) {
+		t.Errorf("stats without attribute = %+v", got)
+	}
+}
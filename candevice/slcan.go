@@ -0,0 +1,50 @@
+package candevice
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// NewSLCANDevice returns a connected device for a serial line CAN adapter
+// at path, e.g. /dev/ttyACM0, without slcand and the slcan interface
+func NewSLCANDevice(path string, opts canbus.SLCANOptions) (*CanDevice, error) {
+	sl, err := canbus.OpenSLCAN(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	dev := NewBusDevice(sl)
+	dev.CanParams.Kind = "slcan"
+	dev.CanParams.State = stateName(unix.CAN_STATE_ERROR_ACTIVE)
+	dev.CanParams.Bitrate = uint64(opts.Bitrate)
+	if opts.ListenOnly {
+		dev.CanParams.CtrlMode = unix.CAN_CTRLMODE_LISTENONLY
+		dev.CanParams.Mode = ctrlModeList(dev.CanParams.CtrlMode)
+	}
+	dev.reopen = func() (canbus.Bus, error) {
+		return canbus.OpenSLCAN(path, opts)
+	}
+	return dev, nil
+}
+
+// applySLCANStatus sets the status flags of the adapter in the state and
+// the error statistics
+func (candevice *CanDevice) applySLCANStatus(status canbus.SLCANStatus) *StateChange {
+	params := *candevice.CanParams
+	switch {
+	case status&canbus.SLCANErrorPassive != 0:
+		params.State = stateName(unix.CAN_STATE_ERROR_PASSIVE)
+	case status&canbus.SLCANErrorWarning != 0:
+		params.State = stateName(unix.CAN_STATE_ERROR_WARNING)
+	default:
+		params.State = stateName(unix.CAN_STATE_ERROR_ACTIVE)
+	}
+	// the flags are cleared when read
+	if status&canbus.SLCANBusError != 0 {
+		params.Stats.BusError++
+	}
+	if status&canbus.SLCANArbitrationLost != 0 {
+		params.Stats.ArbitrationLost++
+	}
+	return candevice.updateState(params)
+}
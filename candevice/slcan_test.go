@@ -0,0 +1,30 @@
+package candevice
+
+import (
+	"testing"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestSLCANStatus(t *testing.T) {
+	dev := NewBusDevice(canbus.NewVirtualBus("vbus0").Open())
+	defer dev.Close()
+	dev.CanParams.State = "ERROR-ACTIVE"
+
+	for i, tc := range []struct {
+		status canbus.SLCANStatus
+		state  string
+	}{
+		{canbus.SLCANErrorWarning | canbus.SLCANBusError, "ERROR-WARNING"},
+		{canbus.SLCANErrorPassive | canbus.SLCANErrorWarning | canbus.SLCANArbitrationLost, "ERROR-PASSIVE"},
+		{canbus.SLCANBusError, "ERROR-ACTIVE"},
+	} {
+		change := dev.ApplyState(PolledState{slcan: &tc.status})
+		if change == nil || change.To != tc.state {
+			t.Errorf("status %d: change %+v, want %s", i, change, tc.state)
+		}
+	}
+	if stats := dev.CanParams.Stats; stats.BusError != 2 || stats.ArbitrationLost != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
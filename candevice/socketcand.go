@@ -0,0 +1,20 @@
+package candevice
+
+import (
+	"github.com/miwagner/socanui/canbus"
+)
+
+// NewSocketCANDDevice returns a connected device for the interface iface
+// of a remote host running socketcand at addr, host:port
+func NewSocketCANDDevice(addr, iface string) (*CanDevice, error) {
+	sc, err := canbus.DialSocketCAND(addr, iface)
+	if err != nil {
+		return nil, err
+	}
+	dev := NewBusDevice(sc)
+	dev.CanParams.Kind = "socketcand"
+	dev.reopen = func() (canbus.Bus, error) {
+		return canbus.DialSocketCAND(addr, iface)
+	}
+	return dev, nil
+}
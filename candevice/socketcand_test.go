@@ -0,0 +1,92 @@
+package candevice
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// serveSocketCAND accepts connections like socketcand and passes them
+// after the raw mode is set
+func serveSocketCAND(t *testing.T) (net.Listener, chan net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no TCP: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conns := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.WriteString(conn, "< hi >")
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := r.ReadString('>')
+					if err != nil {
+						return
+					}
+					switch strings.TrimSpace(msg) {
+					case "< open can0 >", "< echo >":
+						io.WriteString(conn, "< ok >")
+					case "< rawmode >":
+						io.WriteString(conn, "< ok >")
+						conns <- conn
+					}
+				}
+			}()
+		}
+	}()
+	return ln, conns
+}
+
+func TestSocketCANDDevice(t *testing.T) {
+	ln, conns := serveSocketCAND(t)
+	dev, err := NewSocketCANDDevice(ln.Addr().String(), "can0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	if err := dev.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	conn := <-conns
+	if _, err := dev.PollState(); err != nil {
+		t.Errorf("poll state: %v", err)
+	}
+
+	io.WriteString(conn, "< frame 321 1700000000.000000 AA >")
+	msg, err := dev.RecFrame()
+	if err != nil || msg.ID != 0x321 || msg.Kind != canbus.SFF || len(msg.Data) != 1 {
+		t.Errorf("got %+v, %v", msg, err)
+	}
+
+	// error frames of the classes not subscribed are dropped
+	dev.SetErrorFilter(canbus.ErrBusOff)
+	io.WriteString(conn, "< error 004 1700000000.000000 >< error 040 1700000000.000000 >")
+	if msg, err := dev.RecFrame(); err != nil || msg.ID != uint32(canbus.ErrBusOff) || msg.Kind != canbus.ERR {
+		t.Errorf("got %+v, %v", msg, err)
+	}
+
+	// the server goes away and comes back
+	conn.Close()
+	if _, err := dev.RecFrame(); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("recv error = %v", err)
+	}
+	if err := dev.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	conn = <-conns
+	io.WriteString(conn, "< frame 12345678 1700000000.000000 >")
+	if msg, err := dev.RecFrame(); err != nil || msg.ID != 0x12345678 || msg.Kind != canbus.EFF {
+		t.Errorf("got %+v, %v after reconnect", msg, err)
+	}
+}
@@ -0,0 +1,125 @@
+package candevice
+
+import (
+	"slices"
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// DeviceStats are the error statistics of a CAN controller
+type DeviceStats struct {
+	BusError        uint32 // bus errors
+	ErrorWarning    uint32 // changes to error warning state
+	ErrorPassive    uint32 // changes to error passive state
+	BusOff          uint32 // changes to bus off state
+	ArbitrationLost uint32 // arbitration lost errors
+	Restarts        uint32 // CAN controller re-starts
+}
+
+// LinkStats are the kernel statistics of the interface
+type LinkStats struct {
+	RxPackets uint64
+	TxPackets uint64
+	RxBytes   uint64
+	TxBytes   uint64
+	RxErrors  uint64 // bad frames received
+	TxErrors  uint64 // frames not sent
+	RxDropped uint64 // no space in the receive buffers of the kernel
+	TxDropped uint64
+}
+
+// StateChange is a transition of the CAN controller state
+type StateChange struct {
+	Time     time.Time
+	From     string
+	To       string
+	TxErrors uint16
+	RxErrors uint16
+}
+
+// number of state transitions kept in the history
+const stateHistoryLen = 100
+
+// PolledState is the state of the interface read by PollState
+type PolledState struct {
+	params *canParameter       // link parameters, nil without rtnetlink
+	slcan  *canbus.SLCANStatus // status flags of a serial line adapter
+}
+
+// PollState reads the controller state, the error counters and the
+// error statistics of the interface. It does not change the device, so
+// the blocking requests can be made off the goroutine that reads
+// CanParams. The state is set with ApplyState.
+func (candevice *CanDevice) PollState() (PolledState, error) {
+	candevice.busMu.RLock()
+	bus, inf := candevice.Bus, candevice.TxInf()
+	candevice.busMu.RUnlock()
+	switch bus := bus.(type) {
+	case *canbus.SLCAN:
+		if candevice.Disconnected() {
+			return PolledState{}, ErrDisconnected
+		}
+		status, err := bus.Status()
+		if err != nil {
+			return PolledState{}, err
+		}
+		return PolledState{slcan: &status}, nil
+	case *canbus.SocketCAND:
+		// no state of the remote interface, check the connection
+		if candevice.Disconnected() {
+			return PolledState{}, ErrDisconnected
+		}
+		return PolledState{}, candevice.linkError(bus.Echo())
+	}
+	link, err := getLink(inf)
+	if err != nil {
+		return PolledState{}, err
+	}
+	return PolledState{params: &link.Params}, nil
+}
+
+// ApplyState sets the polled state in CanParams. A transition of the
+// state is added to the history and returned, nil if unchanged.
+func (candevice *CanDevice) ApplyState(state PolledState) *StateChange {
+	if state.slcan != nil {
+		return candevice.applySLCANStatus(*state.slcan)
+	}
+	if state.params == nil {
+		return nil
+	}
+	return candevice.updateState(*state.params)
+}
+
+// updateState sets the parameters and records a state transition
+func (candevice *CanDevice) updateState(params canParameter) *StateChange {
+	from := candevice.CanParams.State
+	*candevice.CanParams = params
+	candevice.setBitrates()
+	candevice.CanStatstic.setLink(params.LinkStats)
+	if from == params.State {
+		return nil
+	}
+
+	change := StateChange{
+		Time:     time.Now(),
+		From:     from,
+		To:       params.State,
+		TxErrors: params.TxErrors,
+		RxErrors: params.RxErrors,
+	}
+	candevice.stateMu.Lock()
+	defer candevice.stateMu.Unlock()
+	if len(candevice.stateHistory) == stateHistoryLen {
+		candevice.stateHistory = slices.Delete(candevice.stateHistory, 0, 1)
+	}
+	candevice.stateHistory = append(candevice.stateHistory, change)
+	return &change
+}
+
+// StateHistory returns the state transitions, the oldest first
+func (candevice *CanDevice) StateHistory() []StateChange {
+	candevice.stateMu.Lock()
+	defer candevice.stateMu.Unlock()
+	return slices.Clone(candevice.stateHistory)
+}
@@ -0,0 +1,246 @@
+package candevice
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+// number of seconds kept in the statistic history
+const statHistoryLen = 300
+
+// Statistic counts the received and sent frames of a device. The
+// counters are safe for concurrent use by the receive and send
+// goroutines. Update calculates the per second values once per second
+// and adds them to the history.
+type Statistic struct {
+	rxFrames      atomic.Uint64
+	txFrames      atomic.Uint64
+	rxErrorFrames atomic.Uint64 // error frames, not counted in rxFrames
+	rxFiltered    atomic.Uint64 // frames rejected by the software filter
+	rxBusTime     atomic.Int64  // bus time of the frames in ns, for the bus load
+	txBusTime     atomic.Int64
+	rxFirst       atomic.Int64 // time of the first and last frame in unix ns
+	rxLast        atomic.Int64
+	txFirst       atomic.Int64
+	txLast        atomic.Int64
+	drops         atomic.Uint32 // socket drop counter of the last received frame
+	dropsBase     atomic.Uint32 // drop counter at the last reset, subtracted in uint32 for the wrap around
+
+	mu      sync.Mutex // guards the fields below
+	runs    uint64
+	prev    statCounters // counter values at the last update
+	snap    StatSnapshot
+	history [statHistoryLen]StatSample
+	head    int // index of the next sample
+	samples int
+}
+
+// StatSnapshot holds the counters and the per second values of the
+// statistic at the last update
+type StatSnapshot struct {
+	RxFrameSum     uint64
+	TxFrameSum     uint64
+	RxFrameLastSec uint64
+	TxFrameLastSec uint64
+	RxFrameMaxSec  uint64
+	TxFrameMaxSec  uint64
+	RxFrameAveSec  uint64
+	TxFrameAveSec  uint64
+	RxErrorFrames  uint64  // error frames of the controller
+	RxFiltered     uint64  // rejected by the software filter
+	RxAccepted     uint64  // passed the software filter
+	RxDropped      uint64  // dropped by the kernel, socket receive queue full
+	RxLoadLastSec  float64 // bus load in percent
+	TxLoadLastSec  float64
+	RxLoadMaxSec   float64
+	TxLoadMaxSec   float64
+	RxLoadAveSec   float64
+	TxLoadAveSec   float64
+	Link           LinkStats // kernel statistics of the interface
+}
+
+// StatSample holds the values of one second of the statistic history
+type StatSample struct {
+	Time          time.Time
+	RxFrames      uint64
+	TxFrames      uint64
+	RxErrorFrames uint64
+	RxFiltered    uint64
+	RxLoad        float64 // bus load in percent
+	TxLoad        float64
+}
+
+// counter values of the statistic
+type statCounters struct {
+	rxFrames, txFrames   uint64
+	rxErrorFrames        uint64
+	rxFiltered           uint64
+	rxBusTime, txBusTime int64
+}
+
+func newStatistic() *Statistic {
+	return &Statistic{runs: 1}
+}
+
+// countRx counts a received frame with its bus time
+func (stat *Statistic) countRx(msg *canbus.Frame, busTime time.Duration) {
+	if msg.Kind == canbus.ERR {
+		stat.rxErrorFrames.Add(1)
+		return
+	}
+	stat.rxFrames.Add(1)
+	stat.rxBusTime.Add(int64(busTime))
+	ts := time.Now().UnixNano()
+	if !msg.Timestamp.IsZero() {
+		ts = msg.Timestamp.UnixNano()
+	}
+	stat.rxFirst.CompareAndSwap(0, ts)
+	stat.rxLast.Store(ts)
+}
+
+// countTx counts a sent frame with its bus time
+func (stat *Statistic) countTx(busTime time.Duration) {
+	stat.txFrames.Add(1)
+	stat.txBusTime.Add(int64(busTime))
+	ts := time.Now().UnixNano()
+	stat.txFirst.CompareAndSwap(0, ts)
+	stat.txLast.Store(ts)
+}
+
+// countFiltered counts a frame rejected by the software filter
+func (stat *Statistic) countFiltered() {
+	stat.rxFiltered.Add(1)
+}
+
+// setDrops sets the drop counter of the socket
+func (stat *Statistic) setDrops(drops uint32) {
+	stat.drops.Store(drops)
+}
+
+// restartDrops continues the dropped frames count with the counter of a
+// new socket, which starts at 0
+func (stat *Statistic) restartDrops() {
+	dropped := stat.drops.Load() - stat.dropsBase.Load()
+	stat.drops.Store(0)
+	stat.dropsBase.Store(-dropped)
+}
+
+// setLink sets the kernel statistics of the interface
+func (stat *Statistic) setLink(link LinkStats) {
+	stat.mu.Lock()
+	defer stat.mu.Unlock()
+	stat.snap.Link = link
+}
+
+// Update calculates the frames and the bus load of the last second, the
+// maxima and averages, and adds the second to the history
+func (stat *Statistic) Update(now time.Time) {
+	stat.mu.Lock()
+	defer stat.mu.Unlock()
+	cur := statCounters{
+		rxFrames:      stat.rxFrames.Load(),
+		txFrames:      stat.txFrames.Load(),
+		rxErrorFrames: stat.rxErrorFrames.Load(),
+		rxFiltered:    stat.rxFiltered.Load(),
+		rxBusTime:     stat.rxBusTime.Load(),
+		txBusTime:     stat.txBusTime.Load(),
+	}
+	sample := StatSample{
+		Time:          now,
+		RxFrames:      cur.rxFrames - stat.prev.rxFrames,
+		TxFrames:      cur.txFrames - stat.prev.txFrames,
+		RxErrorFrames: cur.rxErrorFrames - stat.prev.rxErrorFrames,
+		RxFiltered:    cur.rxFiltered - stat.prev.rxFiltered,
+		RxLoad:        loadPercent(cur.rxBusTime-stat.prev.rxBusTime, 1),
+		TxLoad:        loadPercent(cur.txBusTime-stat.prev.txBusTime, 1),
+	}
+	stat.prev = cur
+
+	snap := &stat.snap
+	snap.RxFrameSum = cur.rxFrames
+	snap.TxFrameSum = cur.txFrames
+	snap.RxFrameLastSec = sample.RxFrames
+	snap.TxFrameLastSec = sample.TxFrames
+	snap.RxFrameMaxSec = max(snap.RxFrameMaxSec, sample.RxFrames)
+	snap.TxFrameMaxSec = max(snap.TxFrameMaxSec, sample.TxFrames)
+	snap.RxFrameAveSec = aveFrames(cur.rxFrames, stat.rxFirst.Load(), stat.rxLast.Load(), stat.runs)
+	snap.TxFrameAveSec = aveFrames(cur.txFrames, stat.txFirst.Load(), stat.txLast.Load(), stat.runs)
+	snap.RxErrorFrames = cur.rxErrorFrames
+	snap.RxFiltered = cur.rxFiltered
+	snap.RxAccepted = cur.rxFrames - min(cur.rxFiltered, cur.rxFrames)
+	snap.RxDropped = uint64(stat.drops.Load() - stat.dropsBase.Load())
+	snap.RxLoadLastSec = sample.RxLoad
+	snap.TxLoadLastSec = sample.TxLoad
+	snap.RxLoadMaxSec = max(snap.RxLoadMaxSec, sample.RxLoad)
+	snap.TxLoadMaxSec = max(snap.TxLoadMaxSec, sample.TxLoad)
+	snap.RxLoadAveSec = loadPercent(cur.rxBusTime, stat.runs)
+	snap.TxLoadAveSec = loadPercent(cur.txBusTime, stat.runs)
+	stat.runs++
+
+	stat.history[stat.head] = sample
+	stat.head = (stat.head + 1) % statHistoryLen
+	stat.samples = min(stat.samples+1, statHistoryLen)
+}
+
+// Snapshot returns the statistic of the last update
+func (stat *Statistic) Snapshot() StatSnapshot {
+	stat.mu.Lock()
+	defer stat.mu.Unlock()
+	return stat.snap
+}
+
+// History returns the samples of the last seconds, the oldest first
+func (stat *Statistic) History() []StatSample {
+	stat.mu.Lock()
+	defer stat.mu.Unlock()
+	history := make([]StatSample, 0, stat.samples)
+	start := (stat.head - stat.samples + statHistoryLen) % statHistoryLen
+	for i := 0; i < stat.samples; i++ {
+		history = append(history, stat.history[(start+i)%statHistoryLen])
+	}
+	return history
+}
+
+// Reset clears the counters and the history, the kernel statistics of
+// the interface are kept
+func (stat *Statistic) Reset() {
+	stat.mu.Lock()
+	defer stat.mu.Unlock()
+	stat.rxFrames.Store(0)
+	stat.txFrames.Store(0)
+	stat.rxErrorFrames.Store(0)
+	stat.rxFiltered.Store(0)
+	stat.rxBusTime.Store(0)
+	stat.txBusTime.Store(0)
+	stat.rxFirst.Store(0)
+	stat.rxLast.Store(0)
+	stat.txFirst.Store(0)
+	stat.txLast.Store(0)
+	stat.dropsBase.Store(stat.drops.Load())
+
+	stat.runs = 1
+	stat.prev = statCounters{}
+	stat.snap = StatSnapshot{Link: stat.snap.Link}
+	stat.head = 0
+	stat.samples = 0
+}
+
+// average frames per second between the first and last frame timestamp
+func aveFrames(sum uint64, first, last int64, runs uint64) uint64 {
+	d := time.Duration(last - first)
+	if first == 0 || d < time.Second {
+		return sum / runs
+	}
+	return uint64(float64(sum) / d.Seconds())
+}
+
+// bus time in ns in percent of a number of seconds
+func loadPercent(busTime int64, secs uint64) float64 {
+	if secs == 0 {
+		return 0
+	}
+	return 100 * time.Duration(busTime).Seconds() / float64(secs)
+}
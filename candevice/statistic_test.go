@@ -0,0 +1,97 @@
+package candevice
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miwagner/socanui/canbus"
+)
+
+func TestStatistic(t *testing.T) {
+	dev := NewBusDevice(canbus.NewVirtualBus("vbus0").Open())
+	defer dev.Close()
+	// a negated rule is checked in userspace, not by the kernel filters
+	dev.SetFilter(&FilterSet{Rules: []Rule{{Enabled: true, Exclude: true, Negate: true, Ranges: []canbus.IDRange{{Start: 0x100, End: 0x1FF}}}}})
+	stat := dev.CanStatstic
+
+	// receive and send goroutines with a concurrent reset and update
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := uint32(0); id < 0x400; id++ {
+				msg := canbus.Frame{ID: id, Timestamp: time.Now()}
+				dev.countRx(&msg)
+				dev.Accept(&msg)
+				stat.countTx(0)
+			}
+		}()
+	}
+	go stat.Update(time.Now())
+	go stat.Reset()
+	wg.Wait()
+
+	stat.Reset()
+	for id := uint32(0); id < 0x400; id++ {
+		msg := canbus.Frame{ID: id}
+		dev.countRx(&msg)
+		dev.Accept(&msg)
+	}
+	dev.countRx(&canbus.Frame{ID: 0x40, Kind: canbus.ERR})
+	stat.Update(time.Now())
+	snap := stat.Snapshot()
+	if snap.RxFrameSum != 0x400 || snap.RxAccepted != 0x100 || snap.RxFiltered != 0x300 || snap.RxErrorFrames != 1 || snap.TxFrameSum != 0 {
+		t.Errorf("snapshot = %+v", snap)
+	}
+}
+
+func TestStatisticHistory(t *testing.T) {
+	stat := newStatistic()
+	start := time.Now()
+	for i := 0; i < statHistoryLen+10; i++ {
+		for j := 0; j < i; j++ {
+			stat.countTx(0)
+		}
+		stat.Update(start.Add(time.Duration(i) * time.Second))
+	}
+	history := stat.History()
+	if len(history) != statHistoryLen {
+		t.Fatalf("history length %d", len(history))
+	}
+	for i, sample := range history {
+		if sample.TxFrames != uint64(i+10) || !sample.Time.Equal(start.Add(time.Duration(i+10)*time.Second)) {
+			t.Fatalf("sample %d = %+v", i, sample)
+		}
+	}
+	if snap := stat.Snapshot(); snap.TxFrameMaxSec != statHistoryLen+9 || snap.TxFrameLastSec != statHistoryLen+9 {
+		t.Errorf("snapshot = %+v", snap)
+	}
+
+	stat.Reset()
+	if len(stat.History()) != 0 || stat.Snapshot().TxFrameSum != 0 {
+		t.Error("not reset")
+	}
+}
+
+func TestStatisticDrops(t *testing.T) {
+	stat := newStatistic()
+	stat.setDrops(0xFFFFFFF0)
+	stat.Reset()
+
+	// the drop counter of the socket wraps around
+	stat.setDrops(0x10)
+	stat.Update(time.Now())
+	if n := stat.Snapshot().RxDropped; n != 0x20 {
+		t.Errorf("dropped %d, want %d", n, 0x20)
+	}
+
+	// the counter of a new socket starts at 0
+	stat.restartDrops()
+	stat.setDrops(5)
+	stat.Update(time.Now())
+	if n := stat.Snapshot().RxDropped; n != 0x25 {
+		t.Errorf("dropped %d after restart, want %d", n, 0x25)
+	}
+}
@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/miwagner/socanui/canbus"
 	"github.com/miwagner/socanui/candevice"
 	"github.com/miwagner/socanui/ui"
 	"github.com/rivo/tview"
@@ -21,6 +26,11 @@ func main() {
 	uselog := flag.Bool("l", false, "log file")
 	usehelp := flag.Bool("h", false, "help")
 	useversion := flag.Bool("v", false, "version")
+	useerrors := flag.String("e", "", "error frame classes")
+	userecvbuf := flag.Int("b", 0, "socket receive buffer size")
+	usebitrate := flag.String("r", "", "bitrate for the bus load")
+	useworstcase := flag.Bool("w", false, "bus load with worst case bit stuffing")
+	usexl := flag.Bool("x", false, "CAN XL frames")
 	flag.Parse()
 	log.SetOutput(io.Discard)
 	if *uselog {
@@ -48,13 +58,33 @@ func main() {
 		os.Exit(1)
 	}
 	log.Printf("Interface: %s", caninf)
+	errmask, err := canbus.ParseErrorClass(*useerrors)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	bitrate, dbitrate, err := parseBitrate(*usebitrate)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// CAN bus
-	candev, err := candevice.NewDevice(caninf)
+	var candev *candevice.CanDevice
+	local := false
+	switch {
+	case strings.HasPrefix(caninf, "slcan:"):
+		candev, err = openSLCAN(caninf, uint32(bitrate))
+	case strings.HasPrefix(caninf, "socketcand:"):
+		candev, err = openSocketCAND(caninf)
+	default:
+		local = true
+		candev, err = candevice.NewDevice(caninf)
+	}
 	if err != nil {
 		log.Println(err)
 		fmt.Printf("Error: %v\n", err)
-		if err.Error() != "Interface is not up" {
+		if local && err.Error() != "Interface is not up" {
 			fmt.Println("########################################")
 			fmt.Println("You can add a virtual CAN Interface:")
 			fmt.Println("sudo modprobe vcan")
@@ -68,19 +98,26 @@ func main() {
 	}
 
 	// CAN connect
+	candev.ErrorMask = errmask
+	candev.RecvBufSize = *userecvbuf
+	candev.Bitrate = bitrate
+	candev.DataBitrate = dbitrate
+	candev.StuffWorstCase = *useworstcase
+	candev.XLFrames = *usexl
 	err = candev.Connect()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer candev.Sck.Close()
+	defer candev.Close()
 
 	// tview application
 	app := tview.NewApplication()
 	defer app.Stop()
 
 	// create ui
-	ui.CreateSocanUI(app, candev)
+	socanui := ui.CreateSocanUI(app, candev)
+	defer socanui.Stop()
 
 	if err = app.EnableMouse(true).Run(); err != nil {
 		panic(err)
@@ -97,9 +134,24 @@ socanui [options] interface
 
 Interface:
 SocketCAN Interface such as "can0", "vcan0", "slcan0"
+"any" for all CAN interfaces or a list such as "can0,can1"
+slcan:device[?options] for a serial line CAN adapter without slcand,
+options baud=speed, listen and timestamps separated by "&"
+socketcand://host[:port]/interface for an interface of a remote host
+running socketcand, port 29536 if not set
 
 Options:
   -l            log debug to file "socanui.log"
+  -e classes    receive error frames of the comma separated classes
+                txtimeout, lostarb, ctrl, prot, trx, ack, busoff,
+                buserror, restarted, cnt or all
+  -b bytes      socket receive buffer size
+  -r rate[:data]
+                bitrate and optional CAN FD data bitrate for the bus load
+                of interfaces without bit timing such as vcan, the
+                bitrate of a serial line CAN adapter
+  -w            bus load with worst case instead of computed bit stuffing
+  -x            receive and send CAN XL frames (Linux 6.2 and later)
   -h            display this help and exit
   -v            output version information and exit
   
@@ -108,5 +160,73 @@ socanui can0
      (connect to can0 interface)
 socanui -l vcan0
      (connect to vcan0 interface and write debug log)
+socanui can0,can1
+     (merged trace of can0 and can1, send on can0)
+socanui -e busoff,ctrl,restarted can0
+     (connect to can0 interface and show bus-off and error state changes)
+socanui -r 500000:2000000 vcan0
+     (bus load of vcan0 as a CAN FD bus with 500 kbit/s and 2 Mbit/s)
+socanui -r 250000 slcan:/dev/ttyACM0
+     (open the serial line CAN adapter with 250 kbit/s)
+socanui socketcand://raspberrypi:29536/can0
+     (connect to can0 of the remote host raspberrypi)
 	`)
 }
+
+// open a serial line CAN adapter "slcan:/dev/ttyACM0?baud=115200&listen"
+func openSLCAN(arg string, bitrate uint32) (*candevice.CanDevice, error) {
+	u, err := url.Parse(arg)
+	if err != nil || u.Path == "" {
+		return nil, fmt.Errorf("invalid serial device %q", arg)
+	}
+	query := u.Query()
+	opts := canbus.SLCANOptions{
+		Bitrate:    bitrate,
+		ListenOnly: query.Has("listen"),
+		Timestamps: query.Has("timestamps"),
+	}
+	if baud := query.Get("baud"); baud != "" {
+		opts.Baud, err = strconv.Atoi(baud)
+		if err != nil {
+			return nil, fmt.Errorf("invalid serial speed %q", baud)
+		}
+	}
+	return candevice.NewSLCANDevice(u.Path, opts)
+}
+
+// connect to socketcand "socketcand://host:29536/can0"
+func openSocketCAND(arg string) (*candevice.CanDevice, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socketcand address %q", arg)
+	}
+	iface := strings.Trim(u.Path, "/")
+	if u.Hostname() == "" || iface == "" || strings.Contains(iface, "/") {
+		return nil, fmt.Errorf("invalid socketcand address %q", arg)
+	}
+	port := u.Port()
+	if port == "" {
+		port = strconv.Itoa(canbus.SocketCANDPort)
+	}
+	return candevice.NewSocketCANDDevice(net.JoinHostPort(u.Hostname(), port), iface)
+}
+
+// parse "bitrate[:databitrate]"
+func parseBitrate(s string) (uint64, uint64, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	rate, data, _ := strings.Cut(s, ":")
+	bitrate, err := strconv.ParseUint(rate, 10, 32)
+	if err != nil || bitrate == 0 {
+		return 0, 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	var dbitrate uint64
+	if data != "" {
+		dbitrate, err = strconv.ParseUint(data, 10, 32)
+		if err != nil || dbitrate == 0 {
+			return 0, 0, fmt.Errorf("invalid data bitrate %q", s)
+		}
+	}
+	return bitrate, dbitrate, nil
+}
@@ -0,0 +1,113 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/miwagner/socanui/canbus"
+	"github.com/rivo/tview"
+)
+
+type ErrorView struct {
+	cev    *tview.Frame
+	cevV   *tview.TextView
+	counts map[string]uint64
+	last   map[string]time.Time
+	order  []string
+	sum    uint64
+	tec    uint8
+	rec    uint8
+}
+
+// create error view
+func (socanui *Socanui) createErrorView() *ErrorView {
+	errorview := &ErrorView{}
+	errorview.reset()
+	errorview.cevV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextColor(tcell.ColorYellow).
+		SetScrollable(true)
+
+	form := tview.NewForm().
+		AddButton("Clear", func() {
+			errorview.reset()
+			errorview.cevV.SetText(errorview.text())
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	form.SetButtonsAlign(tview.AlignCenter)
+
+	// error classes to subscribe to
+	classForm := tview.NewForm()
+	for _, class := range canbus.ErrorClasses() {
+		class := class
+		classForm.AddCheckbox(class.String(), socanui.candev.ErrorMask&class != 0, func(checked bool) {
+			mask := socanui.candev.ErrorMask &^ class
+			if checked {
+				mask |= class
+			}
+			err := socanui.candev.SetErrorFilter(mask)
+			if err != nil {
+				log.Println(err)
+			}
+		})
+	}
+	classForm.SetItemPadding(0).SetBorderPadding(0, 0, 1, 1)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(errorview.cevV, 0, 1, false).
+			AddItem(classForm, 26, 0, true), 0, 1, true).
+		AddItem(form, 3, 0, false)
+
+	errorview.cev = tview.NewFrame(layout).
+		SetBorders(0, 0, 1, 0, 1, 1).
+		AddText("Count   Last             Error", true, tview.AlignLeft, tcell.ColorWhite)
+	errorview.cev.SetBorder(true).SetTitle("Error Frames")
+	return errorview
+}
+
+// add decoded error frame
+func (errorview *ErrorView) add(msg *canbus.Frame) {
+	info := canbus.DecodeError(*msg)
+	msgs := info.Messages()
+	if len(msgs) == 0 && info.Class&canbus.ErrCounter == 0 {
+		msgs = []string{info.String()}
+	}
+	if info.Class&canbus.ErrCounter != 0 {
+		errorview.tec = info.TxErrCounter
+		errorview.rec = info.RxErrCounter
+	}
+	errorview.sum++
+	for _, m := range msgs {
+		if _, found := errorview.counts[m]; !found {
+			errorview.order = append(errorview.order, m)
+		}
+		errorview.counts[m]++
+		errorview.last[m] = msg.Timestamp
+	}
+}
+
+// error list as text
+func (errorview *ErrorView) text() string {
+	out := fmt.Sprintf("[blue::b]Error frames: %d  TEC: %d  REC: %d[-::-]\n", errorview.sum, errorview.tec, errorview.rec)
+	for _, m := range errorview.order {
+		out += fmt.Sprintf("%5d   %s  %s\n", errorview.counts[m], errorview.last[m].Format("15:04:05.000000"), m)
+	}
+	if errorview.sum == 0 {
+		out = "[green]No error frames received"
+	}
+	return out
+}
+
+func (errorview *ErrorView) reset() {
+	errorview.counts = make(map[string]uint64)
+	errorview.last = make(map[string]time.Time)
+	errorview.order = nil
+	errorview.sum = 0
+	errorview.tec = 0
+	errorview.rec = 0
+}
@@ -0,0 +1,368 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/miwagner/socanui/candevice"
+	"github.com/rivo/tview"
+)
+
+type FilterView struct {
+	cfv      *tview.Frame
+	cfvSets  *tview.Form
+	cfvList  *tview.List
+	cfvRule  *tview.Form
+	cfvMsg   *tview.TextView
+	set      candevice.FilterSet // rules being edited, active as filter
+	places   []candevice.FilterPlace
+	sets     []candevice.FilterSet // saved filter sets
+	setsFile string
+}
+
+// rule actions in the form order
+var ruleActions = []string{"Include", "Exclude"}
+
+// create filter view
+func (socanui *Socanui) createFilterView() *FilterView {
+	filterview := &FilterView{}
+	var err error
+	filterview.setsFile, err = candevice.FilterSetsFile()
+	if err == nil {
+		filterview.sets, err = candevice.LoadFilterSets(filterview.setsFile)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	filterview.cfvMsg = tview.NewTextView().
+		SetDynamicColors(true)
+
+	// saved filter sets
+	filterview.cfvSets = tview.NewForm().
+		SetHorizontal(true).
+		AddDropDown("Set", nil, 0, nil).
+		AddInputField("Name", "", 16, nil, nil).
+		AddButton("Load", func() {
+			filterview.load(socanui)
+		}).
+		AddButton("Save", func() {
+			filterview.save()
+		}).
+		AddButton("Delete", func() {
+			filterview.deleteSet()
+		})
+	filterview.cfvSets.SetItemPadding(1)
+	filterview.setOptions()
+
+	// rules in the order they are checked
+	filterview.cfvList = tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true).
+		SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+			filterview.edit(index)
+		}).
+		SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+			// toggle the rule
+			filterview.set.Rules[index].Enabled = !filterview.set.Rules[index].Enabled
+			filterview.apply(socanui)
+		})
+	filterview.cfvList.SetBorder(true).SetTitle("Rules")
+
+	// rule editor
+	filterview.cfvRule = tview.NewForm().
+		AddCheckbox("Enabled", true, nil).
+		AddDropDown("Action", ruleActions, 0, nil).
+		AddCheckbox("Negate", false, nil).
+		AddInputField("IDs", "", 24, nil, nil).
+		AddInputField("Kinds", "", 24, nil, nil).
+		AddInputField("DLCs", "", 24, nil, nil).
+		AddInputField("Data", "", 24, nil, nil).
+		AddButton("Set", func() {
+			filterview.setRule(socanui, false)
+		}).
+		AddButton("Add", func() {
+			filterview.setRule(socanui, true)
+		}).
+		AddButton("Del", func() {
+			filterview.deleteRule(socanui)
+		}).
+		AddButton("Up", func() {
+			filterview.move(socanui, -1)
+		}).
+		AddButton("Down", func() {
+			filterview.move(socanui, 1)
+		})
+	filterview.cfvRule.SetItemPadding(0)
+
+	// switch between the rule list and the forms
+	focus := []tview.Primitive{filterview.cfvList, filterview.cfvRule, filterview.cfvSets}
+	next := func(p tview.Primitive) {
+		i := slices.Index(focus, p)
+		socanui.app.SetFocus(focus[(i+1)%len(focus)])
+	}
+	filterview.cfvList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTab || event.Key() == tcell.KeyEscape {
+			next(filterview.cfvList)
+			return nil
+		}
+		return event
+	})
+	filterview.cfvRule.SetCancelFunc(func() {
+		next(filterview.cfvRule)
+	})
+	filterview.cfvSets.SetCancelFunc(func() {
+		next(filterview.cfvSets)
+	})
+
+	buttons := tview.NewForm().
+		AddButton("Clear", func() {
+			filterview.set.Rules = nil
+			filterview.apply(socanui)
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	buttons.SetButtonsAlign(tview.AlignRight)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(filterview.cfvSets, 3, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(filterview.cfvList, 0, 1, true).
+			AddItem(filterview.cfvRule, 36, 0, false), 0, 1, true).
+		AddItem(tview.NewFlex().
+			AddItem(filterview.cfvMsg, 0, 1, false).
+			AddItem(buttons, 22, 0, false), 3, 0, false)
+
+	filterview.cfv = tview.NewFrame(layout).
+		SetBorders(0, 0, 0, 0, 1, 1).
+		AddText("First matching rule decides. Enter: enable/disable, Esc: next panel", false, tview.AlignLeft, tcell.ColorYellow)
+	filterview.cfv.SetBorder(true).SetTitle("Filter")
+	filterview.refresh()
+	return filterview
+}
+
+// show the rules of the edited set
+func (filterview *FilterView) refresh() {
+	current := filterview.cfvList.GetCurrentItem()
+	filterview.cfvList.Clear()
+	places := filterview.places
+	for i, rule := range filterview.set.Rules {
+		mark := "[ ]"
+		if rule.Enabled {
+			mark = "[X]"
+		}
+		place := ""
+		if i < len(places) && places[i] != candevice.FilterOff {
+			place = places[i].String()
+		}
+		filterview.cfvList.AddItem(fmt.Sprintf("%s %s%-11s[-] %s", tview.Escape(mark), placeColor(places, i), place, tview.Escape(rule.String())), "", 0, nil)
+	}
+	if current < len(filterview.set.Rules) {
+		filterview.cfvList.SetCurrentItem(current)
+	}
+}
+
+// show a rule in the editor
+func (filterview *FilterView) edit(index int) {
+	if index < 0 || index >= len(filterview.set.Rules) {
+		return
+	}
+	rule := filterview.set.Rules[index]
+	form := filterview.cfvRule
+	form.GetFormItemByLabel("Enabled").(*tview.Checkbox).SetChecked(rule.Enabled)
+	action := 0
+	if rule.Exclude {
+		action = 1
+	}
+	form.GetFormItemByLabel("Action").(*tview.DropDown).SetCurrentOption(action)
+	form.GetFormItemByLabel("Negate").(*tview.Checkbox).SetChecked(rule.Negate)
+	form.GetFormItemByLabel("IDs").(*tview.InputField).SetText(rule.IDText())
+	form.GetFormItemByLabel("Kinds").(*tview.InputField).SetText(rule.KindText())
+	form.GetFormItemByLabel("DLCs").(*tview.InputField).SetText(rule.DLCText())
+	form.GetFormItemByLabel("Data").(*tview.InputField).SetText(rule.DataText())
+}
+
+// rule of the editor
+func (filterview *FilterView) rule() (candevice.Rule, error) {
+	form := filterview.cfvRule
+	rule := candevice.Rule{
+		Enabled: form.GetFormItemByLabel("Enabled").(*tview.Checkbox).IsChecked(),
+		Negate:  form.GetFormItemByLabel("Negate").(*tview.Checkbox).IsChecked(),
+	}
+	action, _ := form.GetFormItemByLabel("Action").(*tview.DropDown).GetCurrentOption()
+	rule.Exclude = action == 1
+	err := rule.SetIDs(form.GetFormItemByLabel("IDs").(*tview.InputField).GetText())
+	if err == nil {
+		err = rule.SetKinds(form.GetFormItemByLabel("Kinds").(*tview.InputField).GetText())
+	}
+	if err == nil {
+		err = rule.SetDLCs(form.GetFormItemByLabel("DLCs").(*tview.InputField).GetText())
+	}
+	if err == nil {
+		err = rule.SetData(form.GetFormItemByLabel("Data").(*tview.InputField).GetText())
+	}
+	return rule, err
+}
+
+// set the selected rule or add a rule after it from the editor
+func (filterview *FilterView) setRule(socanui *Socanui, add bool) {
+	rule, err := filterview.rule()
+	if err != nil {
+		filterview.message(err)
+		return
+	}
+	index := filterview.cfvList.GetCurrentItem()
+	switch {
+	case add || len(filterview.set.Rules) == 0:
+		index = min(index+1, len(filterview.set.Rules))
+		filterview.set.Rules = slices.Insert(filterview.set.Rules, index, rule)
+	default:
+		filterview.set.Rules[index] = rule
+	}
+	filterview.apply(socanui)
+	filterview.cfvList.SetCurrentItem(index)
+}
+
+// delete the selected rule
+func (filterview *FilterView) deleteRule(socanui *Socanui) {
+	index := filterview.cfvList.GetCurrentItem()
+	if index < 0 || index >= len(filterview.set.Rules) {
+		return
+	}
+	filterview.set.Rules = slices.Delete(filterview.set.Rules, index, index+1)
+	filterview.apply(socanui)
+}
+
+// move the selected rule up or down
+func (filterview *FilterView) move(socanui *Socanui, delta int) {
+	index := filterview.cfvList.GetCurrentItem()
+	to := index + delta
+	if index < 0 || to < 0 || to >= len(filterview.set.Rules) {
+		return
+	}
+	rules := filterview.set.Rules
+	rules[index], rules[to] = rules[to], rules[index]
+	filterview.apply(socanui)
+	filterview.cfvList.SetCurrentItem(to)
+}
+
+// activate the edited rules as filter, in the kernel where possible
+func (filterview *FilterView) apply(socanui *Socanui) {
+	err := socanui.candev.SetFilter(&filterview.set)
+	filterview.places = socanui.candev.FilterPlaces()
+	filterview.refresh()
+	if err != nil {
+		log.Println(err)
+		filterview.message(fmt.Errorf("kernel filter: %w, checked in userspace", err))
+	} else {
+		filterview.message(nil)
+	}
+	socanui.setHeadBarStatus()
+}
+
+// color of the place a rule is checked
+func placeColor(places []candevice.FilterPlace, i int) string {
+	if i >= len(places) {
+		return "[-]"
+	}
+	switch places[i] {
+	case candevice.FilterKernel:
+		return "[green]"
+	case candevice.FilterBoth:
+		return "[yellow]"
+	case candevice.FilterUserspace:
+		return "[orange]"
+	}
+	return "[-]"
+}
+
+// show an error or the number of enabled rules
+func (filterview *FilterView) message(err error) {
+	if err != nil {
+		filterview.cfvMsg.SetText(fmt.Sprintf("[red]%v", err))
+		return
+	}
+	var enabled, kernel int
+	for i, rule := range filterview.set.Rules {
+		if rule.Enabled {
+			enabled++
+		}
+		if i < len(filterview.places) && filterview.places[i] != candevice.FilterUserspace && filterview.places[i] != candevice.FilterOff {
+			kernel++
+		}
+	}
+	filterview.cfvMsg.SetText(fmt.Sprintf("[green]%d of %d rules enabled, %d in the kernel", enabled, len(filterview.set.Rules), kernel))
+}
+
+// names of the saved sets in the drop down
+func (filterview *FilterView) setOptions() {
+	names := make([]string, len(filterview.sets))
+	for i, fs := range filterview.sets {
+		names[i] = fs.Name
+	}
+	dropdown := filterview.cfvSets.GetFormItemByLabel("Set").(*tview.DropDown)
+	dropdown.SetOptions(names, func(text string, index int) {
+		filterview.cfvSets.GetFormItemByLabel("Name").(*tview.InputField).SetText(text)
+	})
+}
+
+// load the selected set
+func (filterview *FilterView) load(socanui *Socanui) {
+	index, _ := filterview.cfvSets.GetFormItemByLabel("Set").(*tview.DropDown).GetCurrentOption()
+	if index < 0 || index >= len(filterview.sets) {
+		return
+	}
+	filterview.set = *filterview.sets[index].Clone()
+	filterview.cfvList.SetCurrentItem(0)
+	filterview.apply(socanui)
+	filterview.edit(0)
+}
+
+// save the edited rules under the name
+func (filterview *FilterView) save() {
+	name := filterview.cfvSets.GetFormItemByLabel("Name").(*tview.InputField).GetText()
+	if name == "" {
+		filterview.message(fmt.Errorf("name of the filter set missing"))
+		return
+	}
+	filterview.set.Name = name
+	fs := *filterview.set.Clone()
+	i := slices.IndexFunc(filterview.sets, func(s candevice.FilterSet) bool { return s.Name == name })
+	if i >= 0 {
+		filterview.sets[i] = fs
+	} else {
+		filterview.sets = append(filterview.sets, fs)
+		i = len(filterview.sets) - 1
+	}
+	filterview.writeSets()
+	filterview.cfvSets.GetFormItemByLabel("Set").(*tview.DropDown).SetCurrentOption(i)
+}
+
+// delete the selected saved set
+func (filterview *FilterView) deleteSet() {
+	index, _ := filterview.cfvSets.GetFormItemByLabel("Set").(*tview.DropDown).GetCurrentOption()
+	if index < 0 || index >= len(filterview.sets) {
+		return
+	}
+	filterview.sets = slices.Delete(filterview.sets, index, index+1)
+	filterview.writeSets()
+}
+
+// write the saved sets to the file
+func (filterview *FilterView) writeSets() {
+	filterview.setOptions()
+	if filterview.setsFile == "" {
+		filterview.message(fmt.Errorf("no configuration directory"))
+		return
+	}
+	err := candevice.SaveFilterSets(filterview.setsFile, filterview.sets)
+	if err != nil {
+		log.Println(err)
+		filterview.message(err)
+		return
+	}
+	filterview.cfvMsg.SetText(fmt.Sprintf("[green]Saved to %s", filterview.setsFile))
+}
@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/miwagner/socanui/canbus"
@@ -10,11 +9,12 @@ import (
 )
 
 type FrameList struct {
-	cfl  *tview.Frame
-	cflV *tview.TextView
-	out  string
-	last int64
-	br   string
+	cfl       *tview.Frame
+	cflV      *tview.TextView
+	out       string
+	last      int64
+	br        string
+	showIface bool
 }
 
 const (
@@ -32,30 +32,35 @@ func (socanui *Socanui) createFrameList() *FrameList {
 			socanui.app.Draw()
 		})
 
+	header := "Time             ID       DLC  DATA                       ASCII"
+	if socanui.candev.MultiInterface() {
+		framelist.showIface = true
+		header = "Time             IF     ID       DLC  DATA                       ASCII"
+	}
 	framelist.cfl = tview.NewFrame(framelist.cflV).
 		SetBorders(0, 0, 0, 0, 1, 1).
-		AddText("ID       DLC  DATA                       ASCII", true, tview.AlignLeft, tcell.ColorWhite)
+		AddText(header, true, tview.AlignLeft, tcell.ColorWhite)
 
 	return framelist
 }
 
 func (framelist *FrameList) add(msg *canbus.Frame) string {
 	var data string
-	now := time.Now().UnixMilli()
-	for _, t := range msg.Data {
+	now := msg.Timestamp.UnixMilli()
+	shown, more := shownData(msg.Data, msg.Flags)
+	for _, t := range shown {
 		data += fmt.Sprintf("%02X ", t)
 	}
-	var id string
-	if msg.Kind == canbus.SFF || msg.Kind == canbus.RTR_SFF {
-		id = fmt.Sprintf("%03X", msg.ID)
-	}
-	if msg.Kind == canbus.EFF || msg.Kind == canbus.RTR_EFF {
-		id = fmt.Sprintf("%08X", msg.ID)
-	}
+	data += more
+	id := idText(msg.ID, msg.Kind, msg.Flags, msg.VCID)
 	if msg.Kind == canbus.RTR_SFF || msg.Kind == canbus.RTR_EFF {
 		data = "---RTR---"
 	}
-	framelist.out += fmt.Sprintf("%s%-8s [%d]  %-25s  |%-8s|", framelist.br, id, len(msg.Data), data, toASCII(msg.Data))
+	ts := msg.Timestamp.Format("15:04:05.000000")
+	if framelist.showIface {
+		ts += fmt.Sprintf("  %-6s", msg.Iface)
+	}
+	framelist.out += fmt.Sprintf("%s%s  %-8s [%d]  %-25s  |%-8s|", framelist.br, ts, id, len(msg.Data), data, toASCII(shown))
 	framelist.br = "\n"
 	if now-framelist.last >= DIFFVIEWMS {
 		outret := framelist.out
@@ -1,8 +1,9 @@
 package ui
 
 import (
+	"cmp"
 	"fmt"
-	"time"
+	"slices"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/miwagner/socanui/canbus"
@@ -16,20 +17,31 @@ type FrameTable struct {
 
 type TableData struct {
 	tview.TableContentReadOnly
+	showIface bool
+}
+
+// row key, the same ID on different interfaces has separate rows
+type tkey struct {
+	id      uint32
+	ifindex int
 }
 
 type trow struct {
-	id     uint32
-	dlc    uint8
-	data   []byte
-	kind   canbus.Kind
-	period int64
-	last   int64
-	count  uint64
-	cell   *tview.TableCell
+	id      uint32
+	ifindex int
+	iface   string
+	dlc     int
+	data    []byte
+	kind    canbus.Kind
+	flags   canbus.Flags
+	vcid    uint8
+	period  int64
+	last    int64
+	count   uint64
+	cell    *tview.TableCell
 }
 
-var lookuptable = make(map[uint32]int) // lookup table
+var lookuptable = make(map[tkey]int) // lookup table
 var trows = make([]trow, 0)
 var tabledata = &TableData{}
 
@@ -40,9 +52,14 @@ func (socanui *Socanui) createFrameTable() *FrameTable {
 		SetBorders(false).
 		SetContent(tabledata).
 		SetSelectable(false, false)
+	header := "ID       DLC  DATA                       Period    Count  ASCII"
+	if socanui.candev.MultiInterface() {
+		tabledata.showIface = true
+		header = "IF     " + header
+	}
 	frametable.cft = tview.NewFrame(frametable.cftT).
 		SetBorders(0, 0, 0, 0, 1, 1).
-		AddText("ID       DLC  DATA                       Period    Count  ASCII", true, tview.AlignLeft, tcell.ColorWhite)
+		AddText(header, true, tview.AlignLeft, tcell.ColorWhite)
 
 	frametable.cftT.SetFocusFunc(func() {
 		frametable.cft.SetBackgroundColor(tcell.ColorGrey)
@@ -53,38 +70,46 @@ func (socanui *Socanui) createFrameTable() *FrameTable {
 	return frametable
 }
 
-func newTRow(id uint32, dlc uint8, data []byte, kind canbus.Kind) trow {
+func newTRow(msg *canbus.Frame) trow {
 	row := trow{
-		id:     id,
-		count:  1,
-		data:   data,
-		dlc:    dlc,
-		kind:   kind,
-		period: 0,
-		last:   time.Now().UnixMilli(),
-		cell:   tview.NewTableCell(""),
+		id:      msg.ID,
+		ifindex: msg.Ifindex,
+		iface:   msg.Iface,
+		count:   1,
+		data:    msg.Data,
+		dlc:     len(msg.Data),
+		kind:    msg.Kind,
+		flags:   msg.Flags,
+		vcid:    msg.VCID,
+		period:  0,
+		last:    msg.Timestamp.UnixMilli(),
+		cell:    tview.NewTableCell(""),
 	}
 	row.cell.SetText(row.cellText())
 	row.cell.SetTextColor(tcell.ColorOrange)
 	return row
 }
 
+func (row *trow) key() tkey {
+	return tkey{id: row.id, ifindex: row.ifindex}
+}
+
 func (row *trow) cellText() string {
 	var data string
-	for _, rd := range row.data {
+	shown, more := shownData(row.data, row.flags)
+	for _, rd := range shown {
 		data += fmt.Sprintf("%02X ", rd)
 	}
+	data += more
 	if row.kind == canbus.RTR_SFF || row.kind == canbus.RTR_EFF {
 		data = "---RTR---"
 	}
-	var id string
-	if row.kind == canbus.SFF || row.kind == canbus.RTR_SFF {
-		id = fmt.Sprintf("%03X", row.id)
-	}
-	if row.kind == canbus.EFF || row.kind == canbus.RTR_EFF {
-		id = fmt.Sprintf("%08X", row.id)
+	id := idText(row.id, row.kind, row.flags, row.vcid)
+	text := fmt.Sprintf("%-8s [%1d]  %-25s %7d %8d  |%-8s|", id, row.dlc, data, row.period, row.count, toASCII(shown))
+	if tabledata.showIface {
+		text = fmt.Sprintf("%-6s %s", row.iface, text)
 	}
-	return fmt.Sprintf("%-8s [%1d]  %-25s %7d %8d  |%-8s|", id, row.dlc, data, row.period, row.count, toASCII(row.data))
+	return text
 }
 
 func (tdata *TableData) GetCell(row, column int) *tview.TableCell {
@@ -103,63 +128,45 @@ func (tdata *TableData) GetColumnCount() int {
 }
 
 func (tdata *TableData) Clear() {
-	lookuptable = make(map[uint32]int)
+	lookuptable = make(map[tkey]int)
 	trows = make([]trow, 0)
 }
 
 func lookupTableUpdate() {
-	lookuptable = make(map[uint32]int, len(trows))
+	lookuptable = make(map[tkey]int, len(trows))
 	for i, tr := range trows {
-		lookuptable[tr.id] = i
+		lookuptable[tr.key()] = i
 	}
 }
 
-func (tdata *TableData) InsertOrUpdateRow(id uint32, dlc uint8, data []byte, kind canbus.Kind) {
+func (tdata *TableData) InsertOrUpdateRow(msg *canbus.Frame) {
 	// error frame
-	if kind == canbus.ERR {
+	if msg.Kind == canbus.ERR {
 		return
 	}
-	row, found := lookuptable[id]
+	key := tkey{id: msg.ID, ifindex: msg.Ifindex}
+	row, found := lookuptable[key]
 	if found {
 		// update
-		now := time.Now()
+		ts := msg.Timestamp.UnixMilli()
 		trows[row].count++
-		trows[row].data = data
-		trows[row].dlc = dlc
-		trows[row].period = now.UnixMilli() - trows[row].last
-		trows[row].last = now.UnixMilli()
+		trows[row].data = msg.Data
+		trows[row].dlc = len(msg.Data)
+		trows[row].flags = msg.Flags
+		trows[row].vcid = msg.VCID
+		trows[row].period = ts - trows[row].last
+		trows[row].last = ts
 		trows[row].cell.SetText(trows[row].cellText())
 	} else {
-		// new row => ta elements == 0: insert by 0; ta elements == 1; insert by 0 or 1;
-		// ta elements >= 2: insert by 0, between, end
-		row := newTRow(id, dlc, data, kind)
-		switch len(trows) {
-		case 0: // start
-			trows = make([]trow, 1)
-			trows[0] = row
-		case 1: // before or after
-			if id < trows[0].id {
-				trows = append([]trow{row}, trows...)
-			} else {
-				trows = append(trows, row)
-			}
-		default:
-			if id < trows[0].id {
-				trows = append([]trow{row}, trows...)
-			}
-			if id > trows[len(trows)-1].id {
-				trows = append(trows, row)
-			} else {
-				for i, tr := range trows {
-					if id > tr.id && id < trows[i+1].id {
-						trows = append(trows, trow{})
-						copy(trows[i+2:], trows[i+1:])
-						trows[i+1] = row
-						break
-					}
-				}
+		// new row, sorted by ID and interface
+		row := newTRow(msg)
+		i, _ := slices.BinarySearchFunc(trows, key, func(tr trow, k tkey) int {
+			if tr.id != k.id {
+				return cmp.Compare(tr.id, k.id)
 			}
-		}
+			return cmp.Compare(tr.ifindex, k.ifindex)
+		})
+		trows = slices.Insert(trows, i, row)
 		lookupTableUpdate()
 	}
 }
@@ -0,0 +1,171 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/miwagner/socanui/canbus"
+	"github.com/rivo/tview"
+)
+
+type ISOTPView struct {
+	ctp   *tview.Frame
+	ctpF  *tview.Form
+	ctpV  *tview.TextView
+	tp    *canbus.ISOTP
+	txid  uint32
+	rxid  uint32
+	state string
+}
+
+// create ISO-TP view
+func (socanui *Socanui) createISOTPView() *ISOTPView {
+	isotpview := &ISOTPView{state: "closed"}
+	hexCheck := func(textToCheck string, lastChar rune) bool {
+		_, err := strconv.ParseUint(textToCheck, 16, 32)
+		return err == nil
+	}
+	decCheck := func(textToCheck string, lastChar rune) bool {
+		_, err := strconv.ParseUint(textToCheck, 10, 8)
+		return err == nil
+	}
+
+	isotpview.ctpV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextColor(tcell.ColorYellow).
+		SetMaxLines(200).
+		SetChangedFunc(func() {
+			socanui.app.Draw()
+		})
+
+	isotpview.ctpF = tview.NewForm().
+		AddInputField("TX ID", "7E0", 9, hexCheck, nil).
+		AddInputField("RX ID", "7E8", 9, hexCheck, nil).
+		AddCheckbox("Extended", false, nil).
+		AddCheckbox("Padding", true, nil).
+		AddInputField("Block Size", "0", 4, decCheck, nil).
+		AddInputField("STmin ms", "0", 4, decCheck, nil).
+		AddInputField("Data", "", 30, func(textToCheck string, lastChar rune) bool {
+			return strings.ContainsRune("0123456789abcdefABCDEF ", lastChar)
+		}, nil).
+		AddButton("Open", func() {
+			isotpview.open(socanui)
+		}).
+		AddButton("Send", func() {
+			isotpview.send(socanui)
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	isotpview.ctpF.SetItemPadding(0)
+
+	layout := tview.NewFlex().
+		AddItem(isotpview.ctpF, 42, 0, true).
+		AddItem(isotpview.ctpV, 0, 1, false)
+
+	isotpview.ctp = tview.NewFrame(layout).
+		SetBorders(0, 0, 0, 0, 1, 1)
+	isotpview.ctp.SetBorder(true).SetTitle("ISO-TP")
+	return isotpview
+}
+
+// open ISO-TP connection with the form parameters
+func (isotpview *ISOTPView) open(socanui *Socanui) {
+	form := isotpview.ctpF
+	txid, _ := strconv.ParseUint(form.GetFormItem(0).(*tview.InputField).GetText(), 16, 32)
+	rxid, _ := strconv.ParseUint(form.GetFormItem(1).(*tview.InputField).GetText(), 16, 32)
+	bs, _ := strconv.ParseUint(form.GetFormItem(4).(*tview.InputField).GetText(), 10, 8)
+	stmin, _ := strconv.ParseUint(form.GetFormItem(5).(*tview.InputField).GetText(), 10, 8)
+	opts := canbus.ISOTPOptions{
+		TxID:      uint32(txid),
+		RxID:      uint32(rxid),
+		Extended:  form.GetFormItem(2).(*tview.Checkbox).IsChecked(),
+		Padding:   form.GetFormItem(3).(*tview.Checkbox).IsChecked(),
+		PadByte:   0xCC,
+		BlockSize: uint8(bs),
+		STmin:     time.Duration(stmin) * time.Millisecond,
+	}
+
+	if isotpview.tp != nil {
+		isotpview.tp.Close()
+		isotpview.tp = nil
+	}
+	tp, err := socanui.candev.OpenISOTP(opts)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(isotpview.ctpV, "[red]Open error: %v[-]\n", err)
+		return
+	}
+	isotpview.tp = tp
+	isotpview.txid = opts.TxID
+	isotpview.rxid = opts.RxID
+	isotpview.state = "userspace"
+	if tp.Kernel() {
+		isotpview.state = "kernel"
+	}
+	fmt.Fprintf(isotpview.ctpV, "[green]Open TX %X RX %X (%s)[-]\n", opts.TxID, opts.RxID, isotpview.state)
+
+	go func() {
+		for {
+			pdu, err := tp.Recv()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			fmt.Fprint(isotpview.ctpV, pduText(time.Now(), "RX", opts.RxID, pdu))
+		}
+	}()
+}
+
+// send PDU from the data field
+func (isotpview *ISOTPView) send(socanui *Socanui) {
+	if isotpview.tp == nil {
+		fmt.Fprint(isotpview.ctpV, "[red]Not open[-]\n")
+		return
+	}
+	pdu, err := parseHexBytes(isotpview.ctpF.GetFormItem(6).(*tview.InputField).GetText())
+	if err != nil || len(pdu) == 0 {
+		fmt.Fprint(isotpview.ctpV, "[red]Invalid data[-]\n")
+		return
+	}
+	tp, txid := isotpview.tp, isotpview.txid
+	go func() {
+		err := tp.Send(pdu)
+		if err != nil {
+			fmt.Fprintf(isotpview.ctpV, "[red]Send error: %v[-]\n", err)
+			return
+		}
+		socanui.blink = true
+		fmt.Fprint(isotpview.ctpV, pduText(time.Now(), "TX", txid, pdu))
+	}()
+}
+
+// PDU as text line
+func pduText(ts time.Time, dir string, id uint32, pdu []byte) string {
+	var data string
+	for _, b := range pdu {
+		data += fmt.Sprintf("%02X ", b)
+	}
+	return fmt.Sprintf("%s %s %X [%d] %s\n", ts.Format("15:04:05.000"), dir, id, len(pdu), data)
+}
+
+// hex string as bytes, with or without spaces
+func parseHexBytes(text string) ([]byte, error) {
+	text = strings.ReplaceAll(text, " ", "")
+	if len(text)%2 != 0 {
+		return nil, fmt.Errorf("odd number of hex digits")
+	}
+	data := make([]byte, len(text)/2)
+	for i := range data {
+		b, err := strconv.ParseUint(text[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = byte(b)
+	}
+	return data, nil
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/miwagner/socanui/canbus"
+	"github.com/rivo/tview"
+)
+
+type J1939View struct {
+	cjv  *tview.Frame
+	cjvF *tview.Form
+	cjvV *tview.TextView
+	sck  *canbus.J1939
+}
+
+// create J1939 view
+func (socanui *Socanui) createJ1939View() *J1939View {
+	j1939view := &J1939View{}
+	hexCheck := func(textToCheck string, lastChar rune) bool {
+		_, err := strconv.ParseUint(textToCheck, 16, 64)
+		return err == nil
+	}
+
+	j1939view.cjvV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextColor(tcell.ColorYellow).
+		SetMaxLines(200).
+		SetChangedFunc(func() {
+			socanui.app.Draw()
+		})
+
+	j1939view.cjvF = tview.NewForm().
+		AddInputField("NAME", "0", 17, hexCheck, nil).
+		AddInputField("Address", "FE", 3, hexCheck, nil).
+		AddCheckbox("Promiscuous", true, nil).
+		AddInputField("PGN", "EA00", 6, hexCheck, nil).
+		AddInputField("Destination", "FF", 3, hexCheck, nil).
+		AddInputField("Priority", "6", 2, func(textToCheck string, lastChar rune) bool {
+			p, err := strconv.ParseUint(textToCheck, 10, 8)
+			return err == nil && p <= 7
+		}, nil).
+		AddInputField("Data", "", 30, func(textToCheck string, lastChar rune) bool {
+			return strings.ContainsRune("0123456789abcdefABCDEF ", lastChar)
+		}, nil).
+		AddButton("Open", func() {
+			j1939view.open(socanui)
+		}).
+		AddButton("Send", func() {
+			j1939view.send(socanui)
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	j1939view.cjvF.SetItemPadding(0)
+
+	layout := tview.NewFlex().
+		AddItem(j1939view.cjvF, 42, 0, true).
+		AddItem(j1939view.cjvV, 0, 1, false)
+
+	j1939view.cjv = tview.NewFrame(layout).
+		SetBorders(0, 0, 0, 0, 1, 1)
+	j1939view.cjv.SetBorder(true).SetTitle("SAE J1939")
+	return j1939view
+}
+
+// open J1939 socket with the form parameters
+func (j1939view *J1939View) open(socanui *Socanui) {
+	form := j1939view.cjvF
+	name, _ := strconv.ParseUint(form.GetFormItem(0).(*tview.InputField).GetText(), 16, 64)
+	addr, _ := strconv.ParseUint(form.GetFormItem(1).(*tview.InputField).GetText(), 16, 8)
+	promisc := form.GetFormItem(2).(*tview.Checkbox).IsChecked()
+
+	if j1939view.sck != nil {
+		j1939view.sck.Close()
+		j1939view.sck = nil
+	}
+	sck, err := socanui.candev.OpenJ1939(name, uint8(addr), promisc)
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(j1939view.cjvV, "[red]Open error: %v[-]\n", err)
+		return
+	}
+	j1939view.sck = sck
+	fmt.Fprintf(j1939view.cjvV, "[green]Open NAME %016X address %02X[-]\n", name, addr)
+
+	go func() {
+		for {
+			msg, err := sck.Recv()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			fmt.Fprint(j1939view.cjvV, j1939Text(&msg))
+		}
+	}()
+}
+
+// send J1939 message from the form
+func (j1939view *J1939View) send(socanui *Socanui) {
+	if j1939view.sck == nil {
+		fmt.Fprint(j1939view.cjvV, "[red]Not open[-]\n")
+		return
+	}
+	form := j1939view.cjvF
+	pgn, err := strconv.ParseUint(form.GetFormItem(3).(*tview.InputField).GetText(), 16, 32)
+	if err != nil || pgn > canbus.J1939MaxPGN {
+		fmt.Fprint(j1939view.cjvV, "[red]Invalid PGN[-]\n")
+		return
+	}
+	dst, _ := strconv.ParseUint(form.GetFormItem(4).(*tview.InputField).GetText(), 16, 8)
+	prio, _ := strconv.ParseUint(form.GetFormItem(5).(*tview.InputField).GetText(), 10, 8)
+	data, err := parseHexBytes(form.GetFormItem(6).(*tview.InputField).GetText())
+	if err != nil {
+		fmt.Fprint(j1939view.cjvV, "[red]Invalid data[-]\n")
+		return
+	}
+
+	sck := j1939view.sck
+	go func() {
+		err := sck.SetPriority(uint8(prio))
+		if err == nil && dst == canbus.J1939NoAddr {
+			err = sck.SetBroadcast(true)
+		}
+		if err == nil {
+			err = sck.Send(uint32(pgn), uint8(dst), data)
+		}
+		if err != nil {
+			fmt.Fprintf(j1939view.cjvV, "[red]Send error: %v[-]\n", err)
+			return
+		}
+		socanui.blink = true
+		fmt.Fprintf(j1939view.cjvV, "TX PGN %05X -> %02X prio %d [%d] %s\n", pgn, dst, prio, len(data), hexText(data))
+	}()
+}
+
+// J1939 message as text line
+func j1939Text(msg *canbus.J1939Msg) string {
+	return fmt.Sprintf("%s RX PGN %05X %02X -> %02X prio %d [%d] %s\n",
+		msg.Timestamp.Format("15:04:05.000"), msg.PGN, msg.Src, msg.Dst, msg.Priority, len(msg.Data), hexText(msg.Data))
+}
+
+// bytes as hex text
+func hexText(data []byte) string {
+	var out string
+	for _, b := range data {
+		out += fmt.Sprintf("%02X ", b)
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/miwagner/socanui/candevice"
+	"github.com/rivo/tview"
+)
+
+type ParameterView struct {
+	cpv    *tview.Frame
+	cpvF   *tview.Form
+	cpvV   *tview.TextView
+	status string // result of the last change
+}
+
+// number of state transitions shown
+const historyShown = 6
+
+// control modes with a checkbox, in form order after the input fields
+var ctrlModes = []struct {
+	label string
+	mode  uint32
+}{
+	{"Listen-Only", candevice.CtrlListenOnly},
+	{"Loopback", candevice.CtrlLoopback},
+	{"One-Shot", candevice.CtrlOneShot},
+	{"Triple-Sampling", candevice.CtrlTripleSampling},
+	{"BERR-Reporting", candevice.CtrlBerrReporting},
+	{"FD", candevice.CtrlFD},
+}
+
+// number of input fields before the control mode checkboxes
+const paramInputs = 5
+
+// create parameter view
+func (socanui *Socanui) createParameterView() *ParameterView {
+	parameterview := &ParameterView{}
+	decCheck := func(textToCheck string, lastChar rune) bool {
+		_, err := strconv.ParseUint(textToCheck, 10, 32)
+		return err == nil
+	}
+	floatCheck := func(textToCheck string, lastChar rune) bool {
+		_, err := strconv.ParseFloat(textToCheck, 64)
+		return err == nil || textToCheck == "0." || textToCheck == "."
+	}
+
+	parameterview.cpvV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextColor(tcell.ColorYellow).
+		SetChangedFunc(func() {
+			socanui.app.Draw()
+		})
+
+	parameterview.cpvF = tview.NewForm().
+		AddInputField("Bitrate", "", 9, decCheck, nil).
+		AddInputField("Sample Point", "", 9, floatCheck, nil).
+		AddInputField("Data Bitrate", "", 9, decCheck, nil).
+		AddInputField("Data Sample Point", "", 9, floatCheck, nil).
+		AddInputField("Restart ms", "", 9, decCheck, nil)
+	for _, cm := range ctrlModes {
+		parameterview.cpvF.AddCheckbox(cm.label, false, nil)
+	}
+	parameterview.cpvF.
+		AddButton("Apply", func() {
+			parameterview.apply(socanui)
+		}).
+		AddButton("Up", func() {
+			parameterview.result(socanui, "Link up", socanui.candev.SetLinkUp(true))
+		}).
+		AddButton("Down", func() {
+			parameterview.result(socanui, "Link down", socanui.candev.SetLinkUp(false))
+		}).
+		AddButton("Restart", func() {
+			parameterview.result(socanui, "Restart", socanui.candev.Restart())
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	parameterview.cpvF.SetItemPadding(0)
+
+	layout := tview.NewFlex().
+		AddItem(parameterview.cpvF, 44, 0, true).
+		AddItem(parameterview.cpvV, 0, 1, false)
+
+	parameterview.cpv = tview.NewFrame(layout).
+		SetBorders(0, 0, 0, 0, 1, 1)
+	parameterview.cpv.SetBorder(true).SetTitle(fmt.Sprintf("%s Parameter", socanui.candev.TxInf()))
+	return parameterview
+}
+
+// fill the form with the current parameters
+func (parameterview *ParameterView) load(socanui *Socanui) {
+	params := socanui.candev.CanParams
+	form := parameterview.cpvF
+	form.GetFormItem(0).(*tview.InputField).SetText(strconv.FormatUint(params.Bitrate, 10))
+	form.GetFormItem(1).(*tview.InputField).SetText(strconv.FormatFloat(params.SamplePoint, 'f', 3, 64))
+	form.GetFormItem(2).(*tview.InputField).SetText(strconv.FormatUint(params.DataTiming.Bitrate, 10))
+	form.GetFormItem(3).(*tview.InputField).SetText(strconv.FormatFloat(params.DataTiming.SamplePoint, 'f', 3, 64))
+	form.GetFormItem(4).(*tview.InputField).SetText(strconv.FormatUint(params.RestartTime, 10))
+	for i, cm := range ctrlModes {
+		form.GetFormItem(paramInputs + i).(*tview.Checkbox).SetChecked(params.CtrlMode&cm.mode != 0)
+	}
+	parameterview.refresh(socanui)
+}
+
+// show the current parameters, state history and the last result
+func (parameterview *ParameterView) refresh(socanui *Socanui) {
+	text := socanui.parameterText()
+	history := socanui.candev.StateHistory()
+	if len(history) > 0 {
+		text += "\n[white::b]State History[-::-]\n"
+		for i := len(history) - 1; i >= max(len(history)-historyShown, 0); i-- {
+			change := history[i]
+			text += fmt.Sprintf("%s %s -> %s%s[-:-] %d/%d\n", change.Time.Format("15:04:05"),
+				change.From, stateColor(change.To), change.To, change.TxErrors, change.RxErrors)
+		}
+	}
+	parameterview.cpvV.SetText(text + parameterview.status)
+}
+
+// apply the form parameters to the interface
+func (parameterview *ParameterView) apply(socanui *Socanui) {
+	form := parameterview.cpvF
+	bitrate, _ := strconv.ParseUint(form.GetFormItem(0).(*tview.InputField).GetText(), 10, 32)
+	sp, _ := strconv.ParseFloat(form.GetFormItem(1).(*tview.InputField).GetText(), 64)
+	dbitrate, _ := strconv.ParseUint(form.GetFormItem(2).(*tview.InputField).GetText(), 10, 32)
+	dsp, _ := strconv.ParseFloat(form.GetFormItem(3).(*tview.InputField).GetText(), 64)
+	restart, _ := strconv.ParseUint(form.GetFormItem(4).(*tview.InputField).GetText(), 10, 32)
+
+	restartMs := uint32(restart)
+	cfg := candevice.LinkConfig{RestartMs: &restartMs}
+	if bitrate > 0 {
+		cfg.Timing = &candevice.BitTiming{Bitrate: bitrate, SamplePoint: sp}
+	}
+	for i, cm := range ctrlModes {
+		cfg.CtrlMask |= cm.mode
+		if form.GetFormItem(paramInputs + i).(*tview.Checkbox).IsChecked() {
+			cfg.CtrlMode |= cm.mode
+		}
+	}
+	if dbitrate > 0 && cfg.CtrlMode&candevice.CtrlFD != 0 {
+		cfg.DataTiming = &candevice.BitTiming{Bitrate: dbitrate, SamplePoint: dsp}
+	}
+	parameterview.result(socanui, "Apply", socanui.candev.Configure(cfg))
+}
+
+// show the result of a change and the new parameters
+func (parameterview *ParameterView) result(socanui *Socanui, action string, err error) {
+	if err != nil {
+		log.Printf("%s: %v", action, err)
+		parameterview.status = fmt.Sprintf("\n[red]%s: %v[-]", action, err)
+	} else {
+		parameterview.status = fmt.Sprintf("\n[green]%s: OK[-]", action)
+	}
+	parameterview.load(socanui)
+	socanui.parameter()
+	socanui.setHeadBarInterface()
+}
+
+// current parameters as text
+func (socanui *Socanui) parameterText() string {
+	params := socanui.candev.CanParams
+	text := fmt.Sprintf("Kind:              %s\n", params.Kind)
+	text += fmt.Sprintf("State:             %s%s[-:-]\n", stateColor(params.State), params.State)
+	text += fmt.Sprintf("Bitrate:           %d\n", params.Bitrate)
+	text += fmt.Sprintf("Samplepoint:       %.3f\n", params.SamplePoint)
+	text += fmt.Sprintf("TQ:                %d\n", params.Tq)
+	text += fmt.Sprintf("Prop-Seg:          %d\n", params.PropSeg)
+	text += fmt.Sprintf("Phase-Seg-1:       %d\n", params.PhaseSeg1)
+	text += fmt.Sprintf("Phase-Seg-2:       %d\n", params.PhaseSeg2)
+	text += fmt.Sprintf("SJW:               %d\n", params.Sjw)
+	text += fmt.Sprintf("BRP:               %d\n", params.Brp)
+	if params.DataTiming.Bitrate > 0 {
+		text += fmt.Sprintf("Data Bitrate:      %d\n", params.DataTiming.Bitrate)
+		text += fmt.Sprintf("Data Samplepoint:  %.3f\n", params.DataTiming.SamplePoint)
+	}
+	text += fmt.Sprintf("Restart ms:        %d\n", params.RestartTime)
+	text += fmt.Sprintf("Clock:             %d\n", params.Clock)
+	text += fmt.Sprintf("TX/RX Errors:      %d / %d\n", params.TxErrors, params.RxErrors)
+	if params.Kind == "can" {
+		stats := params.Stats
+		text += fmt.Sprintf("Bus Errors:        %d\n", stats.BusError)
+		text += fmt.Sprintf("Warning/Passive:   %d / %d\n", stats.ErrorWarning, stats.ErrorPassive)
+		text += fmt.Sprintf("Bus-Off/Restarts:  %d / %d\n", stats.BusOff, stats.Restarts)
+		text += fmt.Sprintf("Arbitration Lost:  %d\n", stats.ArbitrationLost)
+	}
+	return text
+}
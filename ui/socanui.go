@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -26,23 +29,31 @@ type Socanui struct {
 	frametable    *FrameTable
 	framelist     *FrameList
 	txview        *TXView
+	errorview     *ErrorView
+	isotpview     *ISOTPView
+	j1939view     *J1939View
+	parameterview *ParameterView
+	statisticview *StatisticView
+	filterview    *FilterView
 	params        *tview.TextView
 	statistics    *tview.TextView
 	buttonBar     *tview.TextView
 	txIndicate    *tview.TextView
 	layout        *tview.Grid
-	filter        *tview.Frame
 	stopSend      bool
 	blink         bool
 	receiveEnable bool
+	ctx           context.Context
+	cancel        context.CancelFunc
 }
 
 // create the TView application
-func CreateSocanUI(app *tview.Application, candev *candevice.CanDevice) {
+func CreateSocanUI(app *tview.Application, candev *candevice.CanDevice) *Socanui {
 	socanui := &Socanui{}
 	socanui.app = app
 	socanui.candev = candev
 	socanui.receiveEnable = true
+	socanui.ctx, socanui.cancel = context.WithCancel(context.Background())
 
 	// theme
 	tview.Styles = tview.Theme{
@@ -73,6 +84,16 @@ func CreateSocanUI(app *tview.Application, candev *candevice.CanDevice) {
 
 	// indicate CAN TX
 	go socanui.indicateTX()
+
+	// controller state
+	go socanui.monitorState()
+
+	return socanui
+}
+
+// stop the receive goroutine
+func (socanui *Socanui) Stop() {
+	socanui.cancel()
 }
 
 // create application
@@ -82,6 +103,12 @@ func (socanui *Socanui) createApp() {
 	socanui.frametable = socanui.createFrameTable()
 	socanui.framelist = socanui.createFrameList()
 	socanui.txview = socanui.createTXView()
+	socanui.errorview = socanui.createErrorView()
+	socanui.isotpview = socanui.createISOTPView()
+	socanui.j1939view = socanui.createJ1939View()
+	socanui.parameterview = socanui.createParameterView()
+	socanui.statisticview = socanui.createStatisticView()
+	socanui.filterview = socanui.createFilterView()
 
 	socanui.params = tview.NewTextView().
 		SetDynamicColors(true).
@@ -89,13 +116,9 @@ func (socanui *Socanui) createApp() {
 
 	socanui.statistics = tview.NewTextView().
 		SetDynamicColors(true).
-		SetTextColor(tcell.ColorGreen).
-		SetChangedFunc(func() {
-			socanui.app.Draw()
-		})
+		SetTextColor(tcell.ColorGreen)
 
 	socanui.createButtonBar()
-	socanui.createFilterWindows()
 	socanui.layout = socanui.createMainLayout()
 	socanui.pages = socanui.createPages()
 	socanui.pages.ShowPage("main")
@@ -155,7 +178,7 @@ func (socanui *Socanui) createFrameFromView() (*canbus.Frame, error) {
 // create main Layout
 func (socanui *Socanui) createMainLayout() (layout *tview.Grid) {
 	return tview.NewGrid().
-		SetRows(1, -1, 5, 1).
+		SetRows(1, -1, 9, 1).
 		SetColumns(-25, -10, -15).
 		SetBorders(true).
 		AddItem(socanui.headBar, 0, 0, 1, 3, 0, 0, false).
@@ -172,8 +195,12 @@ func (socanui *Socanui) createPages() (layout *tview.Pages) {
 	return tview.NewPages().
 		AddPage("main", socanui.layout, true, true).
 		AddPage("help", socanui.createHelpWindows(), true, false).
-		AddPage("parameter", socanui.createParameterWindows(), true, false).
-		AddPage("filter", socanui.filter, false, false).
+		AddPage("parameter", socanui.parameterview.cpv, false, false).
+		AddPage("filter", socanui.filterview.cfv, false, false).
+		AddPage("errors", socanui.errorview.cev, false, false).
+		AddPage("isotp", socanui.isotpview.ctp, false, false).
+		AddPage("j1939", socanui.j1939view.cjv, false, false).
+		AddPage("statistics", socanui.statisticview.csv, false, false).
 		AddPage("version", socanui.createVersionWindows(), true, false)
 }
 
@@ -181,20 +208,31 @@ func (socanui *Socanui) createPages() (layout *tview.Pages) {
 func (socanui *Socanui) showCANreceive() {
 	for {
 		if socanui.receiveEnable {
-			msg, err := socanui.candev.RecFrame()
+			msg, err := socanui.candev.RecFrameContext(socanui.ctx)
 			if err != nil {
-				log.Fatalf("recv error: %v\n", err)
+				if socanui.ctx.Err() != nil || errors.Is(err, os.ErrClosed) {
+					return
+				}
+				log.Printf("recv error: %v\n", err)
+				if errors.Is(err, candevice.ErrDisconnected) {
+					socanui.reconnect()
+				} else {
+					time.Sleep(time.Second)
+				}
+				continue
 			}
 			// error frame
 			if msg.Kind == canbus.ERR {
 				log.Printf("*** Error frame: %v", msg)
+				socanui.app.QueueUpdate(func() {
+					socanui.errorview.add(&msg)
+					socanui.errorview.cevV.SetText(socanui.errorview.text())
+				})
 				continue
 			}
 			// filter
-			if socanui.candev.CanFilter.RangeActiv {
-				if msg.ID < socanui.candev.CanFilter.IdStart || msg.ID > socanui.candev.CanFilter.IdEnd {
-					continue
-				}
+			if !socanui.candev.Accept(&msg) {
+				continue
 			}
 			// add list
 			out := socanui.framelist.add(&msg)
@@ -203,7 +241,7 @@ func (socanui *Socanui) showCANreceive() {
 			}
 			// update table
 			socanui.app.QueueUpdate(func() {
-				tabledata.InsertOrUpdateRow(msg.ID, uint8(len(msg.Data)), msg.Data, msg.Kind)
+				tabledata.InsertOrUpdateRow(&msg)
 			})
 		}
 	}
@@ -211,49 +249,70 @@ func (socanui *Socanui) showCANreceive() {
 
 // show statistic in the view
 func (socanui *Socanui) statistic() {
-	stat := socanui.candev.CanStatstic
-	stat.Runs = 1
-	for range time.Tick(time.Second) {
-		stat.RxFrameLastSec = stat.RxFrameSum - stat.RxFrameLast
-		stat.RxFrameLast = stat.RxFrameSum
-
-		stat.TxFrameLastSec = stat.TxFrameSum - stat.TxFrameLast
-		stat.TxFrameLast = stat.TxFrameSum
-
-		if stat.RxFrameLastSec > stat.RxFrameMaxSec {
-			stat.RxFrameMaxSec = stat.RxFrameLastSec
-		}
-		if stat.TxFrameLastSec > stat.TxFrameMaxSec {
-			stat.TxFrameMaxSec = stat.TxFrameLastSec
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-socanui.ctx.Done():
+			return
+		case now := <-ticker.C:
+			socanui.candev.CanStatstic.Update(now)
+			socanui.app.QueueUpdateDraw(func() {
+				socanui.statistics.SetText(socanui.statisticText())
+				socanui.statisticview.refresh(socanui)
+			})
 		}
+	}
+}
 
-		stat.RxFrameAveSec = stat.RxFrameSum / stat.Runs
-		stat.TxFrameAveSec = stat.TxFrameSum / stat.Runs
-		stat.Runs++
+// statistic panel text
+func (socanui *Socanui) statisticText() string {
+	stat := socanui.candev.CanStatstic.Snapshot()
+	out := "[blue::b]Statistics                 RX           TX[white::-]\n"
+	out += fmt.Sprintf("%s%12d %12d\n", "Number of Frames:", stat.RxFrameSum, stat.TxFrameSum)
+	out += fmt.Sprintf("%s%12d %12d\n", "Last Sec Frames: ", stat.RxFrameLastSec, stat.TxFrameLastSec)
+	out += fmt.Sprintf("%s%12d %12d\n", "Max Frames/s:    ", stat.RxFrameMaxSec, stat.TxFrameMaxSec)
+	out += fmt.Sprintf("%s%12d %12d\n", "Ave Frames/s:    ", stat.RxFrameAveSec, stat.TxFrameAveSec)
+	out += fmt.Sprintf("%s%12d %12s\n", "Dropped (socket):", stat.RxDropped, "-")
+	if socanui.candev.HasBitrate() {
+		out += fmt.Sprintf("%s%12.1f %12.1f\n", "Bus Load %:      ", stat.RxLoadLastSec, stat.TxLoadLastSec)
+		out += fmt.Sprintf("%s%12s %12s\n", "Max/Ave Load %:  ",
+			fmt.Sprintf("%.1f/%.1f", stat.RxLoadMaxSec, stat.RxLoadAveSec),
+			fmt.Sprintf("%.1f/%.1f", stat.TxLoadMaxSec, stat.TxLoadAveSec))
+		_, _, width, _ := socanui.statistics.GetInnerRect()
+		out += "Load " + loadGraph(socanui.candev.CanStatstic.History(), width-5)
+	} else {
+		out += "Bus Load:         no bitrate, use -r"
+	}
+	return out
+}
 
-		out := "[blue::b]Statistics                 RX           TX[white::-]\n"
-		out += fmt.Sprintf("%s%12d %12d\n", "Number of Frames:", stat.RxFrameSum, stat.TxFrameSum)
-		out += fmt.Sprintf("%s%12d %12d\n", "Last Sec Frames: ", stat.RxFrameLastSec, stat.TxFrameLastSec)
-		out += fmt.Sprintf("%s%12d %12d\n", "Max Frames/s:    ", stat.RxFrameMaxSec, stat.TxFrameMaxSec)
-		out += fmt.Sprintf("%s%12d %12d\n", "Ave Frames/s:    ", stat.RxFrameAveSec, stat.TxFrameAveSec)
+// levels of the bus load graph
+var loadBlocks = []rune(" ▁▂▃▄▅▆▇█")
 
-		socanui.statistics.SetText(out)
+// bus load history as a graph of the last width seconds, 100% is a full
+// block, with the bus load of the last second
+func loadGraph(history []candevice.StatSample, width int) string {
+	width = max(width-7, 0)
+	if len(history) > width {
+		history = history[len(history)-width:]
+	}
+	graph := make([]rune, 0, len(history))
+	last := 0.0
+	for _, sample := range history {
+		load := sample.RxLoad + sample.TxLoad
+		level := int(load/100*float64(len(loadBlocks)-1) + 0.5)
+		graph = append(graph, loadBlocks[min(max(level, 0), len(loadBlocks)-1)])
+	}
+	if len(history) > 0 {
+		last = history[len(history)-1].RxLoad + history[len(history)-1].TxLoad
 	}
+	return fmt.Sprintf("[yellow]%s[-] %5.1f%%", string(graph), last)
 }
 
 // clear can statistic
 func (socanui *Socanui) clearStatistic() {
-	socanui.candev.CanStatstic.Runs = 1
-	socanui.candev.CanStatstic.RxFrameLast = 0
-	socanui.candev.CanStatstic.TxFrameLast = 0
-	socanui.candev.CanStatstic.RxFrameLastSec = 0
-	socanui.candev.CanStatstic.TxFrameLastSec = 0
-	socanui.candev.CanStatstic.RxFrameAveSec = 0
-	socanui.candev.CanStatstic.TxFrameAveSec = 0
-	socanui.candev.CanStatstic.RxFrameSum = 0
-	socanui.candev.CanStatstic.TxFrameSum = 0
-	socanui.candev.CanStatstic.RxFrameMaxSec = 0
-	socanui.candev.CanStatstic.TxFrameMaxSec = 0
+	socanui.candev.CanStatstic.Reset()
 }
 
 // stop receivee
@@ -270,12 +329,85 @@ func (socanui *Socanui) startReceive() {
 func (socanui *Socanui) parameter() {
 	out := fmt.Sprintf("[blue::b]%s Parameters[white::-]\n", socanui.candev.CanInf)
 	out += fmt.Sprintf("Bitrate:\t\t%d\n", socanui.candev.CanParams.Bitrate)
-	out += fmt.Sprintf("State:\t\t\t%s\n", socanui.candev.CanParams.State)
+	out += fmt.Sprintf("State:\t\t\t%s%s[-:-]\n", stateColor(socanui.candev.CanParams.State), socanui.candev.CanParams.State)
 	out += fmt.Sprintf("Restart in ms:\t%d\n", socanui.candev.CanParams.RestartTime)
-	out += fmt.Sprintf("Sample Point:\t%.3f", socanui.candev.CanParams.SamplePoint)
+	out += fmt.Sprintf("Sample Point:\t%.3f\n", socanui.candev.CanParams.SamplePoint)
+	out += fmt.Sprintf("TX/RX Errors:\t%d / %d", socanui.candev.CanParams.TxErrors, socanui.candev.CanParams.RxErrors)
 	socanui.params.SetText(out)
 }
 
+// color tag of the controller state
+func stateColor(state string) string {
+	switch state {
+	case "ERROR-ACTIVE":
+		return "[black:green]"
+	case "ERROR-WARNING":
+		return "[black:yellow]"
+	case "ERROR-PASSIVE":
+		return "[black:orange]"
+	case "BUS-OFF":
+		return "[white:red]"
+	}
+	return "[black:grey]"
+}
+
+// poll the controller state and update the views
+func (socanui *Socanui) monitorState() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastErr := "" // logged once until the poll succeeds again
+	for {
+		select {
+		case <-socanui.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the requests block, only the views are updated on the UI goroutine
+		state, err := socanui.candev.PollState()
+		socanui.app.QueueUpdateDraw(func() {
+			if err != nil {
+				if err.Error() != lastErr {
+					log.Printf("CAN state not available: %v\n", err)
+					lastErr = err.Error()
+				}
+				return
+			}
+			lastErr = ""
+			change := socanui.candev.ApplyState(state)
+			if change != nil {
+				log.Printf("CAN state %s -> %s (TEC %d, REC %d)", change.From, change.To, change.TxErrors, change.RxErrors)
+			}
+			socanui.parameter()
+			socanui.setHeadBarInterface()
+			socanui.parameterview.refresh(socanui)
+		})
+	}
+}
+
+// number of data bytes shown of CAN XL frames
+const xlDataShown = 8
+
+// frame ID as hex, CAN XL priority with the VCID in front
+func idText(id uint32, kind canbus.Kind, flags canbus.Flags, vcid uint8) string {
+	switch {
+	case flags&canbus.XLF != 0:
+		return fmt.Sprintf("%02X:%03X", vcid, id)
+	case kind == canbus.SFF || kind == canbus.RTR_SFF:
+		return fmt.Sprintf("%03X", id)
+	case kind == canbus.EFF || kind == canbus.RTR_EFF:
+		return fmt.Sprintf("%08X", id)
+	}
+	return ""
+}
+
+// shown part of the data, CAN XL payloads are truncated
+func shownData(data []byte, flags canbus.Flags) ([]byte, string) {
+	if flags&canbus.XLF != 0 && len(data) > xlDataShown {
+		return data[:xlDataShown], "..."
+	}
+	return data, ""
+}
+
 // byte array to ascii
 func toASCII(data []byte) string {
 	ascii := make([]byte, len(data))
@@ -291,14 +423,55 @@ func toASCII(data []byte) string {
 // send CAN frame
 func (socanui *Socanui) sendFrame(frame canbus.Frame) {
 	socanui.blink = true
-	socanui.candev.SendFrame(frame)
+	err := socanui.candev.SendFrame(frame)
+	if err != nil {
+		log.Println(err)
+		// sendFrame is called on the UI goroutine and by the TX goroutines
+		if errors.Is(err, candevice.ErrDisconnected) {
+			go socanui.app.QueueUpdateDraw(socanui.setHeadBarStatus)
+		}
+	}
+}
+
+// wait until the interface is back and reconnect, the table and the
+// frame list are kept
+func (socanui *Socanui) reconnect() {
+	socanui.app.QueueUpdateDraw(socanui.setHeadBarStatus)
+	for {
+		select {
+		case <-socanui.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		// on the UI goroutine, which changes the device, frames sent by
+		// other goroutines meanwhile wait for the new socket
+		done := make(chan error, 1)
+		socanui.app.QueueUpdateDraw(func() {
+			err := socanui.candev.Reconnect()
+			if err == nil {
+				socanui.setHeadBarStatus()
+				socanui.setHeadBarInterface()
+				socanui.parameter()
+			}
+			done <- err
+		})
+		select {
+		case <-socanui.ctx.Done():
+			return
+		case err := <-done:
+			if err == nil {
+				log.Println("reconnected")
+				return
+			}
+		}
+	}
 }
 
 // indicate TX
 func (socanui *Socanui) indicateTX() {
 	for range time.Tick(time.Millisecond * 500) {
 		text := ""
-		if socanui.blink {
+		if socanui.blink || socanui.candev.CyclicActive() {
 			text = "[::bl]TX"
 			socanui.blink = false
 		}
@@ -324,20 +497,39 @@ func (socanui *Socanui) createHeadBar() *tview.Flex {
 		SetDynamicColors(true).
 		SetTextColor(tcell.ColorLightSteelBlue).
 		SetTextAlign(tview.AlignRight).
-		SetText(fmt.Sprintf("[:green:]%s[-:-:b] %s", strings.Join(socanui.candev.CanParams.Mode, ", "), socanui.candev.CanInf))
+		SetText(socanui.interfaceText())
 	return tview.NewFlex().
 		AddItem(headstatus, 0, 2, false).
 		AddItem(headtitle, 0, 5, true).
 		AddItem(headinf, 0, 2, false)
 }
 
+// mode, state and name of the interface
+func (socanui *Socanui) interfaceText() string {
+	params := socanui.candev.CanParams
+	text := fmt.Sprintf("[:green:]%s[-:-:b] ", strings.Join(params.Mode, ", "))
+	if params.State != "" {
+		text += fmt.Sprintf("%s %s [-:-:b] ", stateColor(params.State), params.State)
+	}
+	return text + socanui.candev.CanInf
+}
+
+// set head bar interface
+func (socanui *Socanui) setHeadBarInterface() {
+	socanui.headBar.GetItem(2).(*tview.TextView).SetText(socanui.interfaceText())
+}
+
 // set head bar status
 func (socanui *Socanui) setHeadBarStatus() {
 	status := ""
 	// filter
-	if socanui.candev.CanFilter.RangeActiv {
+	if socanui.candev.FilterActive() {
 		status = ("[red::b]Filter active [-:-:-]")
 	}
+	// interface
+	if socanui.candev.Disconnected() {
+		status += "[white:red:b]DISCONNECTED[-:-:-] "
+	}
 	// receive
 	if socanui.receiveEnable {
 		status += "[:green:b]RECEIVE"
@@ -351,22 +543,57 @@ func (socanui *Socanui) setHeadBarStatus() {
 func (socanui *Socanui) createButtonBar() {
 	socanui.buttonBar = tview.NewTextView().
 		SetTextColor(tcell.ColorRosyBrown).
-		SetText("Ctrl+C Quit | Ctrl+S Stop | Ctrl+T Start | Ctrl+F Filter | Ctrl+R Reset | Ctrl+P Parameter | Ctrl+V Version | Ctrl+H Help")
+		SetText("Ctrl+C Quit | Ctrl+S Stop | Ctrl+T Start | Ctrl+F Filter | Ctrl+E Errors | Ctrl+D ISO-TP | Ctrl+N J1939 | Ctrl+R Reset | Ctrl+B Statistics | Ctrl+P Parameter | Ctrl+V Version | Ctrl+H Help")
 
 	socanui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyCtrlH {
 			socanui.pages.ShowPage("help")
 		}
 		if event.Key() == tcell.KeyCtrlP {
+			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
+			x := (screenWidth - 90) / 2
+			y := (screenHeight - 24) / 2
+			socanui.parameterview.cpv.SetRect(x, y, 90, 24)
+			socanui.parameterview.load(socanui)
 			socanui.pages.ShowPage("parameter")
 		}
 		if event.Key() == tcell.KeyCtrlF {
 			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
-			x := (screenWidth - 36) / 2
-			y := (screenHeight - 20) / 2
-			socanui.filter.SetRect(x, y, 36, 20)
+			x := (screenWidth - 100) / 2
+			y := (screenHeight - 24) / 2
+			socanui.filterview.cfv.SetRect(x, y, 100, 24)
 			socanui.pages.ShowPage("filter")
 		}
+		if event.Key() == tcell.KeyCtrlE {
+			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
+			x := (screenWidth - 80) / 2
+			y := (screenHeight - 24) / 2
+			socanui.errorview.cev.SetRect(x, y, 80, 24)
+			socanui.errorview.cevV.SetText(socanui.errorview.text())
+			socanui.pages.ShowPage("errors")
+		}
+		if event.Key() == tcell.KeyCtrlD {
+			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
+			x := (screenWidth - 100) / 2
+			y := (screenHeight - 22) / 2
+			socanui.isotpview.ctp.SetRect(x, y, 100, 22)
+			socanui.pages.ShowPage("isotp")
+		}
+		if event.Key() == tcell.KeyCtrlN {
+			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
+			x := (screenWidth - 100) / 2
+			y := (screenHeight - 22) / 2
+			socanui.j1939view.cjv.SetRect(x, y, 100, 22)
+			socanui.pages.ShowPage("j1939")
+		}
+		if event.Key() == tcell.KeyCtrlB {
+			_, _, screenWidth, screenHeight := socanui.pages.GetRect()
+			x := (screenWidth - 64) / 2
+			y := (screenHeight - 34) / 2
+			socanui.statisticview.csv.SetRect(x, y, 64, 34)
+			socanui.statisticview.refresh(socanui)
+			socanui.pages.ShowPage("statistics")
+		}
 		if event.Key() == tcell.KeyCtrlV {
 			socanui.pages.ShowPage("version")
 		}
@@ -375,6 +602,8 @@ func (socanui *Socanui) createButtonBar() {
 			socanui.framelist.reset()
 			socanui.frametable.cftT.Clear()
 			socanui.framelist.cflV.Clear()
+			socanui.errorview.reset()
+			socanui.errorview.cevV.SetText(socanui.errorview.text())
 		}
 		if event.Key() == tcell.KeyCtrlS {
 			socanui.stopReceive()
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type StatisticView struct {
+	csv  *tview.Frame
+	csvV *tview.TextView
+}
+
+// number of seconds of the history shown
+const statHistoryShown = 10
+
+// create statistic view
+func (socanui *Socanui) createStatisticView() *StatisticView {
+	statisticview := &StatisticView{}
+	statisticview.csvV = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextColor(tcell.ColorYellow)
+
+	form := tview.NewForm().
+		AddButton("Reset", func() {
+			socanui.candev.CanStatstic.Reset()
+			statisticview.refresh(socanui)
+		}).
+		AddButton("Close", func() {
+			socanui.pages.SwitchToPage("main")
+		})
+	form.SetButtonsAlign(tview.AlignCenter)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(statisticview.csvV, 0, 1, false).
+		AddItem(form, 3, 0, true)
+
+	statisticview.csv = tview.NewFrame(layout).
+		SetBorders(0, 0, 0, 0, 1, 1)
+	statisticview.csv.SetBorder(true).SetTitle(fmt.Sprintf("%s Statistics", socanui.candev.CanInf))
+	return statisticview
+}
+
+// show the counters, the kernel statistics and the last seconds
+func (statisticview *StatisticView) refresh(socanui *Socanui) {
+	stat := socanui.candev.CanStatstic.Snapshot()
+	text := "[white::b]Frames                     RX           TX[-::-]\n"
+	text += fmt.Sprintf("%s%12d %12d\n", "Frames:          ", stat.RxFrameSum, stat.TxFrameSum)
+	text += fmt.Sprintf("%s%12d %12s\n", "Accepted:        ", stat.RxAccepted, "-")
+	text += fmt.Sprintf("%s%12d %12s\n", "Filtered:        ", stat.RxFiltered, "-")
+	text += fmt.Sprintf("%s%12d %12s\n", "Error Frames:    ", stat.RxErrorFrames, "-")
+	text += fmt.Sprintf("%s%12d %12s\n", "Dropped (socket):", stat.RxDropped, "-")
+
+	link := stat.Link
+	text += "\n[white::b]Interface                  RX           TX[-::-]\n"
+	text += fmt.Sprintf("%s%12d %12d\n", "Packets:         ", link.RxPackets, link.TxPackets)
+	text += fmt.Sprintf("%s%12d %12d\n", "Bytes:           ", link.RxBytes, link.TxBytes)
+	text += fmt.Sprintf("%s%12d %12d\n", "Errors:          ", link.RxErrors, link.TxErrors)
+	text += fmt.Sprintf("%s%12d %12d\n", "Dropped:         ", link.RxDropped, link.TxDropped)
+
+	history := socanui.candev.CanStatstic.History()
+	text += "\n[white::b]Time          RX     TX  Errors  Filtered  Load %[-::-]\n"
+	for i := len(history) - 1; i >= max(len(history)-statHistoryShown, 0); i-- {
+		sample := history[i]
+		text += fmt.Sprintf("%s %6d %6d %7d %9d %7.1f\n", sample.Time.Format("15:04:05"),
+			sample.RxFrames, sample.TxFrames, sample.RxErrorFrames, sample.RxFiltered, sample.RxLoad+sample.TxLoad)
+	}
+	statisticview.csvV.SetText(text)
+}
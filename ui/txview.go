@@ -1,12 +1,15 @@
 package ui
 
 import (
+	"errors"
+	"log"
 	"math/rand"
 	"strconv"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/miwagner/socanui/canbus"
+	"github.com/miwagner/socanui/candevice"
 	"github.com/rivo/tview"
 )
 
@@ -20,13 +23,18 @@ type TXView struct {
 // create txview
 func (socanui *Socanui) createTXView() *TXView {
 	txview := &TXView{}
+	// edits of a running cyclic frame are applied when confirmed
+	updateOnEnter := func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			socanui.updateCyclic()
+		}
+	}
 	txview.cftxData = make([]*tview.InputField, 8)
 	for i := 0; i < 8; i++ {
 		txview.cftxData[i] = tview.NewInputField().SetLabelWidth(1).
 			SetFieldWidth(3).
 			SetAcceptanceFunc(tview.InputFieldMaxLength(2)).
-			SetDoneFunc(func(key tcell.Key) {
-			})
+			SetDoneFunc(updateOnEnter)
 	}
 
 	txview.cftxF1 = tview.NewForm().
@@ -86,6 +94,8 @@ func (socanui *Socanui) createTXView() *TXView {
 				}
 			}
 		})
+	txview.cftxF1.GetFormItem(0).(*tview.InputField).SetDoneFunc(updateOnEnter)
+	txview.cftxF1.GetFormItem(3).(*tview.InputField).SetDoneFunc(updateOnEnter)
 	txview.cftxF1.SetBorder(false)
 	txview.cftxF1.SetHorizontal(true)
 	txview.cftxF1.SetBorderPadding(0, 0, 0, 0)
@@ -105,6 +115,24 @@ func (socanui *Socanui) createTXView() *TXView {
 			if err != nil {
 				return
 			}
+			if period <= 0 {
+				log.Println("period must be at least 1 ms")
+				return
+			}
+			// kernel timed with the broadcast manager
+			frame, err := socanui.createFrameFromView()
+			if err != nil {
+				return
+			}
+			err = socanui.candev.StartCyclic(*frame, time.Millisecond*time.Duration(period))
+			if err == nil {
+				return
+			}
+			log.Println(err)
+			if !errors.Is(err, candevice.ErrNoBCM) {
+				return
+			}
+			// fallback without broadcast manager
 			go func() {
 				ticker := time.NewTicker(time.Millisecond * time.Duration(period))
 				for range ticker.C {
@@ -126,6 +154,10 @@ func (socanui *Socanui) createTXView() *TXView {
 			if err != nil {
 				return
 			}
+			if period <= 0 {
+				log.Println("period must be at least 1 ms")
+				return
+			}
 			go func() {
 				ticker := time.NewTicker(time.Millisecond * time.Duration(period))
 				for range ticker.C {
@@ -153,6 +185,10 @@ func (socanui *Socanui) createTXView() *TXView {
 		}).
 		AddButton("Stop", func() {
 			socanui.stopSend = true
+			err := socanui.candev.StopCyclic()
+			if err != nil {
+				log.Println(err)
+			}
 		})
 	txview.cftxF2.SetBorder(false)
 	txview.cftxF2.SetHorizontal(true)
@@ -197,3 +233,19 @@ func (socanui *Socanui) createTXView() *TXView {
 
 	return txview
 }
+
+// updateCyclic passes the edited frame to the running cyclic frame of
+// the broadcast manager when the user confirms an edit with Enter
+func (socanui *Socanui) updateCyclic() {
+	if socanui.candev == nil || !socanui.candev.CyclicActive() {
+		return
+	}
+	frame, err := socanui.createFrameFromView()
+	if err != nil {
+		return
+	}
+	err = socanui.candev.UpdateCyclic(*frame)
+	if err != nil {
+		log.Println(err)
+	}
+}